@@ -0,0 +1,114 @@
+// Package webhooks signs and verifies webhook requests following the
+// Standard Webhooks specification (https://www.standardwebhooks.com), for
+// receivers of the webhook endpoints using the standard signing mode.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderID        = "webhook-id"
+	HeaderTimestamp = "webhook-timestamp"
+	HeaderSignature = "webhook-signature"
+
+	// SecretPrefix versions the secrets, the key follows it in base64.
+	SecretPrefix = "whsec_"
+
+	// signatureVersion prefixes the HMAC-SHA256 signatures.
+	signatureVersion = "v1"
+)
+
+// Tolerance is how far the timestamp of a request can be from the time it
+// is verified, to prevent replays.
+var Tolerance = 5 * time.Minute
+
+var (
+	ErrMissingHeaders      = errors.New("webhooks: missing required headers")
+	ErrInvalidTimestamp    = errors.New("webhooks: invalid timestamp")
+	ErrTimestampTooOld     = errors.New("webhooks: timestamp too old")
+	ErrTimestampTooNew     = errors.New("webhooks: timestamp too new")
+	ErrNoMatchingSignature = errors.New("webhooks: no matching signature found")
+)
+
+// Webhook signs and verifies the requests of a secret.
+type Webhook struct {
+	key []byte
+}
+
+// NewWebhook decodes the secret, with or without its prefix.
+func NewWebhook(secret string) (*Webhook, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, SecretPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("webhooks: invalid secret: %w", err)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("webhooks: empty secret")
+	}
+	return &Webhook{key: key}, nil
+}
+
+// NewSecret generates a random secret of 32 bytes, with its prefix.
+func NewSecret() (string, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return SecretPrefix + base64.StdEncoding.EncodeToString(key), nil
+}
+
+// Sign returns the versioned signature of the message, as sent in the
+// signature header.
+func (wh *Webhook) Sign(msgID string, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, wh.key)
+	fmt.Fprintf(mac, "%s.%d.", msgID, timestamp.Unix())
+	mac.Write(payload)
+	return signatureVersion + "," + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks that the headers of the request carry a signature of the
+// payload by the secret, with a timestamp within the tolerance.
+func (wh *Webhook) Verify(payload []byte, header http.Header) error {
+	return wh.verify(payload, header, time.Now())
+}
+
+func (wh *Webhook) verify(payload []byte, header http.Header, now time.Time) error {
+	msgID := header.Get(HeaderID)
+	rawTimestamp := header.Get(HeaderTimestamp)
+	signatures := header.Get(HeaderSignature)
+	if msgID == "" || rawTimestamp == "" || signatures == "" {
+		return ErrMissingHeaders
+	}
+
+	seconds, err := strconv.ParseInt(rawTimestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	timestamp := time.Unix(seconds, 0)
+	if now.Sub(timestamp) > Tolerance {
+		return ErrTimestampTooOld
+	}
+	if timestamp.Sub(now) > Tolerance {
+		return ErrTimestampTooNew
+	}
+
+	expected := wh.Sign(msgID, timestamp, payload)
+	// the header holds a signature per secret of the sender, separated by
+	// spaces, and may hold versions this package doesn't know
+	for _, signature := range strings.Fields(signatures) {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return ErrNoMatchingSignature
+}
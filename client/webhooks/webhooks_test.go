@@ -0,0 +1,83 @@
+package webhooks
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the example of the specification
+const (
+	specSecret    = "whsec_MfKQ9r8GKYqrTwjUPD8ILPZIo2LaLaSw"
+	specMsgID     = "msg_p5jXN8AQM9LWM0D4loKWxJek"
+	specTimestamp = 1614265330
+	specPayload   = `{"test": 2432232314}`
+	specSignature = "v1,g0hM9SsE+OTPJTGt/tmIKtSyZlE3uFJELVlNIOLJ1OE="
+)
+
+func specHeader(signature string) http.Header {
+	header := http.Header{}
+	header.Set(HeaderID, specMsgID)
+	header.Set(HeaderTimestamp, "1614265330")
+	header.Set(HeaderSignature, signature)
+	return header
+}
+
+func TestSign(t *testing.T) {
+	for _, secret := range []string{specSecret, strings.TrimPrefix(specSecret, SecretPrefix)} {
+		wh, err := NewWebhook(secret)
+		require.NoError(t, err)
+		assert.Equal(t, specSignature, wh.Sign(specMsgID, time.Unix(specTimestamp, 0), []byte(specPayload)))
+	}
+}
+
+func TestVerify(t *testing.T) {
+	wh, err := NewWebhook(specSecret)
+	require.NoError(t, err)
+	now := time.Unix(specTimestamp, 0)
+
+	cases := []struct {
+		name    string
+		payload string
+		header  http.Header
+		now     time.Time
+		err     error
+	}{
+		{"valid", specPayload, specHeader(specSignature), now, nil},
+		{"one of several signatures", specPayload, specHeader("v1,Ceo5qEr07ixe2NLpvHk3FH9bwy/WavXrAFQ/9tdO6mc= " + specSignature + " v2,unknown"), now, nil},
+		{"modified payload", `{"test": 2432232315}`, specHeader(specSignature), now, ErrNoMatchingSignature},
+		{"unknown version", specPayload, specHeader("v2" + strings.TrimPrefix(specSignature, "v1")), now, ErrNoMatchingSignature},
+		{"missing headers", specPayload, http.Header{}, now, ErrMissingHeaders},
+		{"too old", specPayload, specHeader(specSignature), now.Add(Tolerance + time.Second), ErrTimestampTooOld},
+		{"too new", specPayload, specHeader(specSignature), now.Add(-Tolerance - time.Second), ErrTimestampTooNew},
+	}
+	for _, c := range cases {
+		err := wh.verify([]byte(c.payload), c.header, c.now)
+		if c.err == nil {
+			assert.NoError(t, err, c.name)
+		} else {
+			assert.ErrorIs(t, err, c.err, c.name)
+		}
+	}
+
+	header := specHeader(specSignature)
+	header.Set(HeaderTimestamp, "yesterday")
+	assert.ErrorIs(t, wh.verify([]byte(specPayload), header, now), ErrInvalidTimestamp)
+}
+
+func TestNewSecret(t *testing.T) {
+	secret, err := NewSecret()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, SecretPrefix))
+
+	wh, err := NewWebhook(secret)
+	require.NoError(t, err)
+	assert.Len(t, wh.key, 32)
+
+	_, err = NewWebhook("whsec_not base64")
+	assert.Error(t, err)
+}
@@ -1,9 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/gofrs/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/supabase/gotrue/internal/api"
 	"github.com/supabase/gotrue/internal/conf"
 	"github.com/supabase/gotrue/internal/models"
 	"github.com/supabase/gotrue/internal/storage"
@@ -12,6 +19,10 @@ import (
 var autoconfirm, isAdmin bool
 var audience string
 
+var importFormat string
+var importDryRun bool
+var importBatchSize int
+
 func getAudience(c *conf.GlobalConfiguration) string {
 	if audience == "" {
 		return c.JWT.Aud
@@ -25,12 +36,16 @@ func adminCmd() *cobra.Command {
 		Use: "admin",
 	}
 
-	adminCmd.AddCommand(&adminCreateUserCmd, &adminDeleteUserCmd)
+	adminCmd.AddCommand(&adminCreateUserCmd, &adminDeleteUserCmd, &adminImportCmd)
 	adminCmd.PersistentFlags().StringVarP(&audience, "aud", "a", "", "Set the new user's audience")
 
 	adminCreateUserCmd.Flags().BoolVar(&autoconfirm, "confirm", false, "Automatically confirm user without sending an email")
 	adminCreateUserCmd.Flags().BoolVar(&isAdmin, "admin", false, "Create user with admin privileges")
 
+	adminImportCmd.Flags().StringVar(&importFormat, "format", "", "Format of the import file, ndjson or csv (defaults to the file extension)")
+	adminImportCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Validate the import and report the outcome without creating users")
+	adminImportCmd.Flags().IntVar(&importBatchSize, "batch-size", 0, "Number of users created per transaction")
+
 	return adminCmd
 }
 
@@ -58,6 +73,19 @@ var adminDeleteUserCmd = cobra.Command{
 	},
 }
 
+var adminImportCmd = cobra.Command{
+	Use:   "import",
+	Short: "Bulk import users with pre-hashed passwords from an NDJSON or CSV file",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			logrus.Fatal("Not enough arguments to import command. Expected the path of the file to import")
+			return
+		}
+
+		execWithConfigAndArgs(cmd, adminImport, args)
+	},
+}
+
 func adminCreateUser(config *conf.GlobalConfiguration, args []string) {
 	db, err := storage.Dial(config)
 	if err != nil {
@@ -129,3 +157,47 @@ func adminDeleteUser(config *conf.GlobalConfiguration, args []string) {
 
 	logrus.Infof("Removed user: %s", args[0])
 }
+
+func adminImport(config *conf.GlobalConfiguration, args []string) {
+	db, err := storage.Dial(config)
+	if err != nil {
+		logrus.Fatalf("Error opening database: %+v", err)
+	}
+	defer db.Close()
+
+	format := importFormat
+	if format == "" {
+		format = api.UserImportNDJSON
+		if strings.EqualFold(filepath.Ext(args[0]), ".csv") {
+			format = api.UserImportCSV
+		}
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		logrus.Fatalf("Error opening import file: %+v", err)
+	}
+	defer f.Close()
+
+	rows, err := api.ParseUserImport(f, format)
+	if err != nil {
+		logrus.Fatalf("Error reading import file (%s): %+v", args[0], err)
+	}
+
+	report, err := api.ImportUsers(context.Background(), db, config, rows, api.UserImportOptions{
+		Aud:       getAudience(config),
+		DryRun:    importDryRun,
+		BatchSize: importBatchSize,
+	})
+	if err != nil {
+		logrus.Fatalf("Error importing users: %+v", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		logrus.Fatalf("Error writing import report: %+v", err)
+	}
+
+	logrus.Infof("Imported users: %d created, %d skipped, %d failed (dry run: %v)", report.Created, report.Skipped, report.Failed, report.DryRun)
+}
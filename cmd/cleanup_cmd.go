@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/supabase/gotrue/internal/api"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+var cleanupCmd = cobra.Command{
+	Use:  "cleanup",
+	Long: "Delete expired auth artifacts once, with the retention of the cleanup configuration",
+	Run:  cleanup,
+}
+
+func cleanup(cmd *cobra.Command, args []string) {
+	config := loadGlobalConfig(cmd.Context())
+
+	db, err := storage.Dial(config)
+	if err != nil {
+		logrus.Fatalf("Error opening database: %+v", err)
+	}
+	defer db.Close()
+
+	// stops between batches when the command is interrupted
+	deleted, err := api.RunCleanup(cmd.Context(), db, config)
+	if err != nil {
+		logrus.Fatalf("Error cleaning up: %+v", err)
+	}
+
+	if err := json.NewEncoder(os.Stdout).Encode(deleted); err != nil {
+		logrus.Fatalf("Error writing cleanup report: %+v", err)
+	}
+}
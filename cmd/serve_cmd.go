@@ -32,6 +32,9 @@ func serve(ctx context.Context) {
 	}
 	defer db.Close()
 
+	api.StartCleanup(ctx, db, config)
+	api.StartWebhookDispatcher(ctx, db, config)
+
 	api := api.NewAPIWithVersion(ctx, config, db, utilities.Version)
 
 	addr := net.JoinHostPort(config.API.Host, config.API.Port)
@@ -23,7 +23,7 @@ require (
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/lestrrat-go/jwx v1.2.25
 	github.com/microcosm-cc/bluemonday v1.0.20 // indirect
-	github.com/mitchellh/mapstructure v1.1.2
+	github.com/mitchellh/mapstructure v1.5.0
 	github.com/mrjones/oauth v0.0.0-20190623134757-126b35219450
 	github.com/netlify/mailme v1.1.1
 	github.com/pkg/errors v0.9.1
@@ -39,7 +39,13 @@ require (
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
 )
 
-require github.com/gobuffalo/nulls v0.4.2 // indirect
+require (
+	github.com/fxamacker/cbor/v2 v2.4.0 // indirect
+	github.com/go-webauthn/revoke v0.1.6 // indirect
+	github.com/gobuffalo/nulls v0.4.2 // indirect
+	github.com/google/go-tpm v0.3.3 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+)
 
 require (
 	github.com/XSAM/otelsql v0.16.0
@@ -67,6 +73,7 @@ require (
 	github.com/crewjam/saml v0.4.13
 	github.com/deepmap/oapi-codegen v1.12.4
 	github.com/fatih/structs v1.1.0
+	github.com/go-webauthn/webauthn v0.5.0
 	github.com/gobuffalo/pop/v6 v6.1.1
 	github.com/jackc/pgx/v4 v4.17.2
 )
@@ -3,7 +3,6 @@ package api
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"net/http"
 	"strings"
 	"time"
@@ -11,7 +10,6 @@ import (
 	"github.com/fatih/structs"
 	"github.com/go-chi/chi"
 	"github.com/gofrs/uuid"
-	"github.com/sethvargo/go-password/password"
 	"github.com/supabase/gotrue/internal/api/provider"
 	"github.com/supabase/gotrue/internal/models"
 	"github.com/supabase/gotrue/internal/observability"
@@ -20,16 +18,19 @@ import (
 )
 
 type AdminUserParams struct {
-	Aud          string                 `json:"aud"`
-	Role         string                 `json:"role"`
-	Email        string                 `json:"email"`
-	Phone        string                 `json:"phone"`
-	Password     *string                `json:"password"`
-	EmailConfirm bool                   `json:"email_confirm"`
-	PhoneConfirm bool                   `json:"phone_confirm"`
-	UserMetaData map[string]interface{} `json:"user_metadata"`
-	AppMetaData  map[string]interface{} `json:"app_metadata"`
-	BanDuration  string                 `json:"ban_duration"`
+	Aud                 string                 `json:"aud"`
+	Role                string                 `json:"role"`
+	Email               string                 `json:"email"`
+	Phone               string                 `json:"phone"`
+	Password            *string                `json:"password"`
+	EmailConfirm        bool                   `json:"email_confirm"`
+	PhoneConfirm        bool                   `json:"phone_confirm"`
+	UserMetaData        map[string]interface{} `json:"user_metadata"`
+	AppMetaData         map[string]interface{} `json:"app_metadata"`
+	BanDuration         string                 `json:"ban_duration"`
+	SkipPasswordHistory bool                   `json:"skip_password_history"`
+	Unlock              bool                   `json:"unlock"`
+	StaffType           *string                `json:"staff_type"`
 }
 
 type adminUserDeleteParams struct {
@@ -164,20 +165,54 @@ func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 		}
 	}
 
-	if params.BanDuration != "" {
-		duration := time.Duration(0)
-		if params.BanDuration != "none" {
-			duration, err = time.ParseDuration(params.BanDuration)
-			if err != nil {
-				return badRequestError("invalid format for ban duration: %v", err)
+	if params.Password != nil {
+		if violations := utilities.ValidatePassword(&config.PasswordPolicy, *params.Password, user.GetEmail()); len(violations) > 0 {
+			return weakPasswordError(&config.PasswordPolicy, violations)
+		}
+		if err := a.checkBreachedPassword(ctx, *params.Password); err != nil {
+			return err
+		}
+		if !params.SkipPasswordHistory {
+			if err := a.checkRecentPassword(db, user, *params.Password); err != nil {
+				return err
 			}
 		}
-		if terr := user.Ban(a.db, duration); terr != nil {
-			return terr
+	}
+
+	if err := a.validateStaffType(params.StaffType); err != nil {
+		return err
+	}
+
+	banDuration := time.Duration(0)
+	if params.BanDuration != "" && params.BanDuration != "none" {
+		banDuration, err = time.ParseDuration(params.BanDuration)
+		if err != nil {
+			return badRequestError("invalid format for ban duration: %v", err)
 		}
 	}
 
 	err = db.Transaction(func(tx *storage.Connection) error {
+		if params.BanDuration != "" {
+			if terr := user.Ban(tx, banDuration); terr != nil {
+				return terr
+			}
+			if user.BannedUntil != nil {
+				if terr := models.NewAuditLogEntry(r, tx, adminUser, models.UserBannedAction, "", map[string]interface{}{
+					"user_id":      user.ID,
+					"user_email":   user.Email,
+					"user_phone":   user.Phone,
+					"banned_until": user.BannedUntil,
+				}); terr != nil {
+					return terr
+				}
+				if terr := triggerActionHooks(ctx, tx, models.UserBannedAction, user, map[string]interface{}{
+					"banned_until": user.BannedUntil,
+				}, config); terr != nil {
+					return terr
+				}
+			}
+		}
+
 		if params.Role != "" {
 			if terr := user.SetRole(tx, params.Role); terr != nil {
 				return terr
@@ -196,18 +231,37 @@ func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 			}
 		}
 
-		if params.Password != nil {
-			if len(*params.Password) < config.PasswordMinLength {
-				return invalidPasswordLengthError(config.PasswordMinLength)
+		if params.StaffType != nil {
+			if terr := a.setStaffType(r, tx, adminUser, user, *params.StaffType); terr != nil {
+				return terr
 			}
+		}
 
-			if err := utilities.ValidatePassword(*params.Password); err != "" {
-				return unprocessableEntityError(err)
+		if params.Unlock {
+			if terr := user.Unlock(tx); terr != nil {
+				return terr
 			}
+			if terr := models.NewAuditLogEntry(r, tx, adminUser, models.AccountUnlockedAction, "", map[string]interface{}{
+				"user_id":    user.ID,
+				"user_email": user.Email,
+				"user_phone": user.Phone,
+			}); terr != nil {
+				return terr
+			}
+		}
 
+		if params.Password != nil {
+			if terr := models.RememberPassword(tx, user, config.PasswordPolicy.HistorySize); terr != nil {
+				return terr
+			}
 			if terr := user.UpdatePassword(tx, *params.Password); terr != nil {
 				return terr
 			}
+			if terr := triggerActionHooks(ctx, tx, models.UserUpdatePasswordAction, user, map[string]interface{}{
+				"actor": "admin",
+			}, config); terr != nil {
+				return terr
+			}
 		}
 
 		var identities []models.Identity
@@ -267,7 +321,7 @@ func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 		user.Identities = append(user.Identities, identities...)
 
 		if params.AppMetaData != nil {
-			if terr := user.UpdateAppMetaData(tx, params.AppMetaData); terr != nil {
+			if terr := a.updateAppMetaData(r, tx, adminUser, user, params.AppMetaData); terr != nil {
 				return terr
 			}
 		}
@@ -289,9 +343,6 @@ func (a *API) adminUserUpdate(w http.ResponseWriter, r *http.Request) error {
 	})
 
 	if err != nil {
-		if errors.Is(err, invalidPasswordLengthError(config.PasswordMinLength)) {
-			return err
-		}
 		return internalServerError("Error updating user").WithInternalError(err)
 	}
 
@@ -358,17 +409,22 @@ func (a *API) adminUserCreate(w http.ResponseWriter, r *http.Request) error {
 	}
 
 	if params.Password == nil || *params.Password == "" {
-		password, err := password.Generate(30, 10, 1, false, true)
+		password, err := utilities.GeneratePassword(&config.PasswordPolicy)
 		if err != nil {
 			return internalServerError("Error generating password").WithInternalError(err)
 		}
 		params.Password = &password
+	} else {
+		if violations := utilities.ValidatePassword(&config.PasswordPolicy, *params.Password, params.Email); len(violations) > 0 {
+			return weakPasswordError(&config.PasswordPolicy, violations)
+		}
+		if err := a.checkBreachedPassword(ctx, *params.Password); err != nil {
+			return err
+		}
 	}
 
-	if params.Password != nil {
-		if err := utilities.ValidatePassword(*params.Password); err != "" {
-			return unprocessableEntityError(err)
-		}
+	if err := a.validateStaffType(params.StaffType); err != nil {
+		return err
 	}
 
 	user, err := models.NewUser(params.Phone, params.Email, *params.Password, aud, params.UserMetaData)
@@ -431,8 +487,14 @@ func (a *API) adminUserCreate(w http.ResponseWriter, r *http.Request) error {
 			return terr
 		}
 
+		if params.StaffType != nil {
+			if terr := a.setStaffType(r, tx, adminUser, user, *params.StaffType); terr != nil {
+				return terr
+			}
+		}
+
 		if params.AppMetaData != nil {
-			if terr := user.UpdateAppMetaData(tx, params.AppMetaData); terr != nil {
+			if terr := a.updateAppMetaData(r, tx, adminUser, user, params.AppMetaData); terr != nil {
 				return terr
 			}
 		}
@@ -507,6 +569,11 @@ func (a *API) adminUserDelete(w http.ResponseWriter, r *http.Request) error {
 		}); terr != nil {
 			return internalServerError("Error recording audit log entry").WithInternalError(terr)
 		}
+		if terr := triggerActionHooks(ctx, tx, models.UserDeletedAction, user, map[string]interface{}{
+			"soft_delete": params.ShouldSoftDelete,
+		}, a.config); terr != nil {
+			return terr
+		}
 
 		if params.ShouldSoftDelete {
 			if user.DeletedAt != nil {
@@ -560,6 +627,13 @@ func (a *API) adminUserDeleteFactor(w http.ResponseWriter, r *http.Request) erro
 		}); terr != nil {
 			return terr
 		}
+		if terr := triggerActionHooks(ctx, tx, models.DeleteFactorAction, user, map[string]interface{}{
+			"factor_id":   factor.ID,
+			"factor_type": factor.FactorType,
+			"actor":       "admin",
+		}, a.config); terr != nil {
+			return terr
+		}
 		if terr := tx.Destroy(factor); terr != nil {
 			return internalServerError("Database error deleting factor").WithInternalError(terr)
 		}
@@ -0,0 +1,611 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/gofrs/uuid"
+	"github.com/supabase/gotrue/internal/api/provider"
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/crypto"
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// Formats accepted by ParseUserImport.
+const (
+	UserImportNDJSON = "ndjson"
+	UserImportCSV    = "csv"
+)
+
+// Statuses of a row in a UserImportReport.
+const (
+	UserImportCreated = "created"
+	UserImportSkipped = "skipped"
+	UserImportFailed  = "failed"
+)
+
+const (
+	defaultUserImportBatchSize = 100
+	maxUserImportBatchSize     = 1000
+)
+
+// UserImportIdentity is an external identity to attach to an imported user.
+type UserImportIdentity struct {
+	Provider     string                 `json:"provider"`
+	ID           string                 `json:"id"`
+	IdentityData map[string]interface{} `json:"identity_data"`
+}
+
+// UserImportRow is a single user to import. Passwords are only accepted
+// pre-hashed in one of the formats known to crypto.FindLegacyHashVerifier.
+type UserImportRow struct {
+	ID                *uuid.UUID             `json:"id"`
+	Email             string                 `json:"email"`
+	Phone             string                 `json:"phone"`
+	Role              string                 `json:"role"`
+	PasswordHash      string                 `json:"password_hash"`
+	PasswordAlgorithm string                 `json:"password_algorithm"`
+	EmailConfirmed    bool                   `json:"email_confirmed"`
+	PhoneConfirmed    bool                   `json:"phone_confirmed"`
+	UserMetaData      map[string]interface{} `json:"user_metadata"`
+	AppMetaData       map[string]interface{} `json:"app_metadata"`
+	Identities        []UserImportIdentity   `json:"identities"`
+
+	// parseErr is set when the row could not be decoded, so it is reported
+	// as failed instead of aborting the whole import.
+	parseErr error
+}
+
+// UserImportResult is the outcome of importing a single row.
+type UserImportResult struct {
+	Row    int        `json:"row"`
+	Status string     `json:"status"`
+	UserID *uuid.UUID `json:"user_id,omitempty"`
+	Email  string     `json:"email,omitempty"`
+	Phone  string     `json:"phone,omitempty"`
+	Reason string     `json:"reason,omitempty"`
+}
+
+// UserImportReport is the per-row report of an import.
+type UserImportReport struct {
+	DryRun  bool                `json:"dry_run"`
+	Created int                 `json:"created"`
+	Skipped int                 `json:"skipped"`
+	Failed  int                 `json:"failed"`
+	Results []*UserImportResult `json:"results"`
+}
+
+// UserImportOptions controls how ImportUsers writes users.
+type UserImportOptions struct {
+	Aud       string
+	DryRun    bool
+	BatchSize int
+}
+
+var userImportCSVColumns = map[string]bool{
+	"id":                 true,
+	"email":              true,
+	"phone":              true,
+	"role":               true,
+	"password_hash":      true,
+	"password_algorithm": true,
+	"email_confirmed":    true,
+	"phone_confirmed":    true,
+	"user_metadata":      true,
+	"app_metadata":       true,
+	"identities":         true,
+}
+
+// ParseUserImport reads users to import as NDJSON (one JSON object per line)
+// or CSV with a header row. Malformed rows are returned with an error so they
+// can be reported, only unreadable input fails the whole parse.
+func ParseUserImport(r io.Reader, format string) ([]*UserImportRow, error) {
+	switch format {
+	case UserImportNDJSON, "":
+		return parseUserImportNDJSON(r)
+	case UserImportCSV:
+		return parseUserImportCSV(r)
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+}
+
+func parseUserImportNDJSON(r io.Reader) ([]*UserImportRow, error) {
+	var rows []*UserImportRow
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		row := &UserImportRow{}
+		if err := json.Unmarshal([]byte(line), row); err != nil {
+			row = &UserImportRow{parseErr: fmt.Errorf("invalid JSON: %v", err)}
+		}
+		rows = append(rows, row)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func parseUserImportCSV(r io.Reader) ([]*UserImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read CSV header: %v", err)
+	}
+	for i, column := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(column))
+		if !userImportCSVColumns[header[i]] {
+			return nil, fmt.Errorf("unknown CSV column %q", column)
+		}
+	}
+
+	var rows []*UserImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if _, ok := err.(*csv.ParseError); ok {
+				rows = append(rows, &UserImportRow{parseErr: err})
+				continue
+			}
+			return nil, err
+		}
+
+		row := &UserImportRow{}
+		for i, value := range record {
+			if err := row.setCSVField(header[i], strings.TrimSpace(value)); err != nil {
+				row = &UserImportRow{parseErr: err}
+				break
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func (row *UserImportRow) setCSVField(column, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	var err error
+	switch column {
+	case "id":
+		var id uuid.UUID
+		id, err = uuid.FromString(value)
+		row.ID = &id
+	case "email":
+		row.Email = value
+	case "phone":
+		row.Phone = value
+	case "role":
+		row.Role = value
+	case "password_hash":
+		row.PasswordHash = value
+	case "password_algorithm":
+		row.PasswordAlgorithm = value
+	case "email_confirmed":
+		row.EmailConfirmed, err = strconv.ParseBool(value)
+	case "phone_confirmed":
+		row.PhoneConfirmed, err = strconv.ParseBool(value)
+	case "user_metadata":
+		err = json.Unmarshal([]byte(value), &row.UserMetaData)
+	case "app_metadata":
+		err = json.Unmarshal([]byte(value), &row.AppMetaData)
+	case "identities":
+		err = json.Unmarshal([]byte(value), &row.Identities)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", column, err)
+	}
+	return nil
+}
+
+// validate normalizes the row's email and phone and checks that the rest of
+// the row can be imported.
+func (row *UserImportRow) validate() error {
+	if row.parseErr != nil {
+		return row.parseErr
+	}
+
+	var err error
+	if row.Email == "" && row.Phone == "" {
+		return fmt.Errorf("either email or phone is required")
+	}
+	if row.Email != "" {
+		if row.Email, err = validateEmail(row.Email); err != nil {
+			return err
+		}
+	}
+	if row.Phone != "" {
+		if row.Phone, err = validatePhone(row.Phone); err != nil {
+			return err
+		}
+	}
+
+	if row.PasswordHash != "" {
+		verifier, err := crypto.FindLegacyHashVerifier(row.PasswordAlgorithm, row.PasswordHash)
+		if err != nil {
+			return fmt.Errorf("unsupported password hash: %v", err)
+		}
+		if err := verifier.Check(row.PasswordHash); err != nil {
+			return fmt.Errorf("unsupported password hash: %v", err)
+		}
+		row.PasswordAlgorithm = verifier.Algorithm()
+	} else if row.PasswordAlgorithm != "" {
+		return fmt.Errorf("password_algorithm given without password_hash")
+	}
+
+	for _, identity := range row.Identities {
+		if identity.Provider == "" || identity.ID == "" {
+			return fmt.Errorf("identities require a provider and an id")
+		}
+		if identity.Provider == "email" || identity.Provider == "phone" {
+			return fmt.Errorf("%s identities are created from the %s column", identity.Provider, identity.Provider)
+		}
+	}
+
+	return nil
+}
+
+// create inserts the user, its identities and, for passwords not hashed with
+// bcrypt, a legacy credential that is migrated on the user's first login.
+func (row *UserImportRow) create(tx *storage.Connection, config *conf.GlobalConfiguration, aud string) (*models.User, error) {
+	id := uuid.Must(uuid.NewV4())
+	if row.ID != nil {
+		id = *row.ID
+	}
+
+	userMetaData := row.UserMetaData
+	if userMetaData == nil {
+		userMetaData = make(map[string]interface{})
+	}
+
+	user := &models.User{
+		ID:           id,
+		Aud:          aud,
+		Role:         config.JWT.DefaultGroupName,
+		Email:        storage.NullString(row.Email),
+		Phone:        storage.NullString(row.Phone),
+		UserMetaData: userMetaData,
+	}
+	if row.Role != "" {
+		user.Role = row.Role
+	}
+
+	now := time.Now()
+	if row.Email != "" && row.EmailConfirmed {
+		user.EmailConfirmedAt = &now
+	}
+	if row.Phone != "" && row.PhoneConfirmed {
+		user.PhoneConfirmedAt = &now
+	}
+
+	if row.PasswordAlgorithm == crypto.LegacyBcrypt {
+		user.EncryptedPassword = row.PasswordHash
+	}
+
+	var providers []string
+	var identities []*models.Identity
+	if row.Email != "" {
+		providers = append(providers, "email")
+		identity, err := models.NewIdentity(user, "email", structs.Map(provider.Claims{
+			Subject: user.ID.String(),
+			Email:   row.Email,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	if row.Phone != "" {
+		providers = append(providers, "phone")
+		identity, err := models.NewIdentity(user, "phone", structs.Map(provider.Claims{
+			Subject: user.ID.String(),
+			Phone:   row.Phone,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	for _, i := range row.Identities {
+		identityData := i.IdentityData
+		if identityData == nil {
+			identityData = make(map[string]interface{})
+		}
+		identityData["sub"] = i.ID
+		identity, err := models.NewIdentity(user, i.Provider, identityData)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+		providers = append(providers, i.Provider)
+	}
+
+	user.AppMetaData = map[string]interface{}{
+		"provider":  providers[0],
+		"providers": providers,
+	}
+	for k, v := range row.AppMetaData {
+		if k != "provider" && k != "providers" {
+			user.AppMetaData[k] = v
+		}
+	}
+
+	if err := tx.Create(user); err != nil {
+		return nil, err
+	}
+
+	for _, identity := range identities {
+		if err := tx.Create(identity); err != nil {
+			return nil, err
+		}
+		user.Identities = append(user.Identities, *identity)
+	}
+
+	if row.PasswordHash != "" && row.PasswordAlgorithm != crypto.LegacyBcrypt {
+		legacyCredential := &models.LegacyCredential{
+			ID:                uuid.Must(uuid.NewV4()),
+			Email:             storage.NullString(row.Email),
+			Phone:             storage.NullString(row.Phone),
+			EncryptedPassword: row.PasswordHash,
+			Algorithm:         storage.NullString(row.PasswordAlgorithm),
+		}
+		if err := tx.Create(legacyCredential); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// isDuplicate checks if a user with the row's email or phone already exists.
+func (row *UserImportRow) isDuplicate(tx *storage.Connection, aud string) (bool, error) {
+	if row.Email != "" {
+		if user, err := models.IsDuplicatedEmail(tx, row.Email, aud, nil); err != nil {
+			return false, err
+		} else if user != nil {
+			return true, nil
+		}
+	}
+	if row.Phone != "" {
+		if exists, err := models.IsDuplicatedPhone(tx, row.Phone, aud); err != nil {
+			return false, err
+		} else if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func userImportReason(err error) string {
+	if httpErr, ok := err.(*HTTPError); ok {
+		return httpErr.Message
+	}
+	return err.Error()
+}
+
+// ImportUsers validates every row, then creates users in batches, each batch
+// in its own transaction. A row that fails to be created only fails itself,
+// the other rows of its batch are still created. Rows whose email or phone
+// is already registered, or that repeat an earlier row, are skipped. With DryRun nothing is written
+// but the report is produced as if it had been.
+func ImportUsers(ctx context.Context, conn *storage.Connection, config *conf.GlobalConfiguration, rows []*UserImportRow, options UserImportOptions) (*UserImportReport, error) {
+	db := conn.WithContext(ctx)
+
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultUserImportBatchSize
+	} else if batchSize > maxUserImportBatchSize {
+		batchSize = maxUserImportBatchSize
+	}
+
+	report := &UserImportReport{
+		DryRun:  options.DryRun,
+		Results: make([]*UserImportResult, len(rows)),
+	}
+
+	seen := make(map[string]bool)
+	var pending []int
+	for i, row := range rows {
+		result := &UserImportResult{Row: i + 1, Email: row.Email, Phone: row.Phone}
+		report.Results[i] = result
+
+		if err := row.validate(); err != nil {
+			result.Status = UserImportFailed
+			result.Reason = userImportReason(err)
+			continue
+		}
+		// report the normalized values
+		result.Email = row.Email
+		result.Phone = row.Phone
+
+		if (row.Email != "" && seen["email:"+row.Email]) || (row.Phone != "" && seen["phone:"+row.Phone]) {
+			result.Status = UserImportSkipped
+			result.Reason = "duplicate of an earlier row"
+			continue
+		}
+		if row.Email != "" {
+			seen["email:"+row.Email] = true
+		}
+		if row.Phone != "" {
+			seen["phone:"+row.Phone] = true
+		}
+
+		pending = append(pending, i)
+	}
+
+	for start := 0; start < len(pending); start += batchSize {
+		end := start + batchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+
+		importBatch := func(tx *storage.Connection) error {
+			for _, i := range batch {
+				row, result := rows[i], report.Results[i]
+
+				if options.DryRun {
+					duplicate, err := row.isDuplicate(tx, options.Aud)
+					if err != nil {
+						return err
+					}
+					if duplicate {
+						result.Status = UserImportSkipped
+						result.Reason = "user already exists"
+						continue
+					}
+					result.Status = UserImportCreated
+					result.UserID = row.ID
+					continue
+				}
+
+				// every row has its own savepoint, a row that fails is
+				// rolled back alone and the rest of the batch is committed
+				if err := tx.RawQuery("SAVEPOINT import_row").Exec(); err != nil {
+					return err
+				}
+				duplicate, err := row.isDuplicate(tx, options.Aud)
+				var user *models.User
+				if err == nil && !duplicate {
+					user, err = row.create(tx, config, options.Aud)
+				}
+				if err != nil {
+					if rerr := tx.RawQuery("ROLLBACK TO SAVEPOINT import_row").Exec(); rerr != nil {
+						return rerr
+					}
+					result.Status = UserImportFailed
+					result.Reason = userImportReason(err)
+					continue
+				}
+				if err := tx.RawQuery("RELEASE SAVEPOINT import_row").Exec(); err != nil {
+					return err
+				}
+
+				if duplicate {
+					result.Status = UserImportSkipped
+					result.Reason = "user already exists"
+					continue
+				}
+				result.Status = UserImportCreated
+				result.UserID = &user.ID
+			}
+			return nil
+		}
+
+		var err error
+		if options.DryRun {
+			err = importBatch(db)
+		} else {
+			err = db.Transaction(importBatch)
+		}
+		if err != nil {
+			// the transaction was rolled back, so nothing in the batch was
+			// created, rows that failed on their own keep their reason
+			for _, i := range batch {
+				result := report.Results[i]
+				if result.Status != UserImportSkipped && result.Status != UserImportFailed {
+					result.Status = UserImportFailed
+					result.UserID = nil
+					result.Reason = "batch rolled back: " + err.Error()
+				}
+			}
+		}
+	}
+
+	for _, result := range report.Results {
+		switch result.Status {
+		case UserImportCreated:
+			report.Created++
+		case UserImportSkipped:
+			report.Skipped++
+		default:
+			report.Failed++
+		}
+	}
+
+	return report, nil
+}
+
+// adminUsersImport bulk imports users from NDJSON or CSV
+func (a *API) adminUsersImport(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+	adminUser := getAdminUser(ctx)
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = UserImportNDJSON
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			format = UserImportCSV
+		}
+	}
+
+	dryRun := false
+	if v := query.Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			return badRequestError("dry_run must be a boolean")
+		}
+	}
+
+	batchSize := 0
+	if v := query.Get("batch_size"); v != "" {
+		var err error
+		if batchSize, err = strconv.Atoi(v); err != nil || batchSize <= 0 {
+			return badRequestError("batch_size must be a positive integer")
+		}
+	}
+
+	rows, err := ParseUserImport(r.Body, format)
+	if err != nil {
+		return badRequestError("Could not read users to import: %v", err)
+	}
+
+	report, err := ImportUsers(ctx, a.db, a.config, rows, UserImportOptions{
+		Aud:       a.requestAud(ctx, r),
+		DryRun:    dryRun,
+		BatchSize: batchSize,
+	})
+	if err != nil {
+		return internalServerError("Error importing users").WithInternalError(err)
+	}
+
+	if !dryRun {
+		if terr := models.NewAuditLogEntry(r, db, adminUser, models.UsersImportedAction, "", map[string]interface{}{
+			"created": report.Created,
+			"skipped": report.Skipped,
+			"failed":  report.Failed,
+		}); terr != nil {
+			return internalServerError("Error recording audit log entry").WithInternalError(terr)
+		}
+	}
+
+	return sendJSON(w, http.StatusOK, report)
+}
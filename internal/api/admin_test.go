@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -456,7 +457,7 @@ func (ts *AdminTestSuite) TestAdminUserUpdatePasswordFailed() {
 	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
 
 	var updateEndpoint = fmt.Sprintf("/admin/users/%s", u.ID)
-	ts.Config.PasswordMinLength = 6
+	ts.Config.PasswordPolicy.MinLength = 6
 	ts.Run("Password doesn't meet minimum length", func() {
 		var buffer bytes.Buffer
 		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
@@ -479,7 +480,7 @@ func (ts *AdminTestSuite) TestAdminUserUpdateBannedUntilFailed() {
 	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
 
 	var updateEndpoint = fmt.Sprintf("/admin/users/%s", u.ID)
-	ts.Config.PasswordMinLength = 6
+	ts.Config.PasswordPolicy.MinLength = 6
 	ts.Run("Incorrect format for ban_duration", func() {
 		var buffer bytes.Buffer
 		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
@@ -812,3 +813,258 @@ func (ts *AdminTestSuite) TestAdminUserUpdateFactor() {
 	}
 
 }
+
+func (ts *AdminTestSuite) TestAdminUsersImportRowFailure() {
+	existing, err := models.NewUser("", "existing@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(existing))
+
+	// the second row reuses the ID of the existing user, which only the
+	// database rejects
+	ndjson := strings.Join([]string{
+		`{"email": "first@example.com"}`,
+		fmt.Sprintf(`{"id": "%s", "email": "conflict@example.com"}`, existing.ID),
+		`{"email": "third@example.com"}`,
+	}, "\n")
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/import?batch_size=3", strings.NewReader(ndjson))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	report := UserImportReport{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&report))
+	require.Equal(ts.T(), 2, report.Created)
+	require.Equal(ts.T(), 1, report.Failed)
+	require.Equal(ts.T(), UserImportFailed, report.Results[1].Status)
+	require.NotContains(ts.T(), report.Results[1].Reason, "batch rolled back")
+
+	for _, email := range []string{"first@example.com", "third@example.com"} {
+		_, err := models.FindUserByEmailAndAudience(ts.API.db, email, ts.Config.JWT.Aud)
+		require.NoError(ts.T(), err, email)
+	}
+}
+
+func (ts *AdminTestSuite) TestAdminUsersImport() {
+	existing, err := models.NewUser("", "existing@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(existing))
+
+	ndjson := strings.Join([]string{
+		`{"email": "bcrypt@example.com", "password_hash": "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga", "email_confirmed": true}`,
+		`{"email": "django@example.com", "password_hash": "pbkdf2_sha256$10000$seasalt$CWWFdHOWwPnki7HvkcqN9iA2T3KLW1cf2uZ5kvArtVY=", "user_metadata": {"name": "Django"}}`,
+		`{"email": "existing@example.com"}`,
+		`{"email": "bcrypt@example.com"}`,
+		`{"email": "not-an-email"}`,
+		`{"email": "unknown@example.com", "password_hash": "$md5$abc"}`,
+		`{"email": "costly@example.com", "password_hash": "pbkdf2_sha256$1000000000$seasalt$CWWFdHOWwPnki7HvkcqN9iA2T3KLW1cf2uZ5kvArtVY="}`,
+		`{"phone": "+1 234 567 890", "identities": [{"provider": "google", "id": "123", "identity_data": {"name": "Phone"}}]}`,
+		`not json`,
+	}, "\n")
+
+	cases := []struct {
+		desc   string
+		dryRun bool
+	}{
+		{"Dry run", true},
+		{"Import", false},
+	}
+
+	for _, c := range cases {
+		ts.Run(c.desc, func() {
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/users/import?dry_run=%v&batch_size=2", c.dryRun), strings.NewReader(ndjson))
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+			req.Header.Set("Content-Type", "application/x-ndjson")
+
+			w := httptest.NewRecorder()
+			ts.API.handler.ServeHTTP(w, req)
+			require.Equal(ts.T(), http.StatusOK, w.Code)
+
+			report := UserImportReport{}
+			require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&report))
+			require.Equal(ts.T(), c.dryRun, report.DryRun)
+			require.Len(ts.T(), report.Results, 9)
+
+			statuses := []string{}
+			for _, result := range report.Results {
+				statuses = append(statuses, result.Status)
+			}
+			require.Equal(ts.T(), []string{
+				UserImportCreated,
+				UserImportCreated,
+				UserImportSkipped,
+				UserImportSkipped,
+				UserImportFailed,
+				UserImportFailed,
+				UserImportFailed,
+				UserImportCreated,
+				UserImportFailed,
+			}, statuses)
+			require.Equal(ts.T(), 3, report.Created)
+			require.Equal(ts.T(), 2, report.Skipped)
+			require.Equal(ts.T(), 4, report.Failed)
+
+			_, err := models.FindUserByEmailAndAudience(ts.API.db, "django@example.com", ts.Config.JWT.Aud)
+			if c.dryRun {
+				require.True(ts.T(), models.IsNotFoundError(err))
+				return
+			}
+			require.NoError(ts.T(), err)
+
+			// bcrypt hashes are used as is, other formats go through legacy credentials
+			u, err := models.FindUserByEmailAndAudience(ts.API.db, "bcrypt@example.com", ts.Config.JWT.Aud)
+			require.NoError(ts.T(), err)
+			require.True(ts.T(), u.IsConfirmed())
+			require.True(ts.T(), u.Authenticate("allmine"))
+
+			legacy, err := models.FindUserByEmailFromLegacy(ts.API.db, "django@example.com")
+			require.NoError(ts.T(), err)
+			require.True(ts.T(), legacy.Authenticate("lètmein"))
+
+			u, err = models.FindUserByPhoneAndAudience(ts.API.db, "1234567890", ts.Config.JWT.Aud)
+			require.NoError(ts.T(), err)
+			require.Equal(ts.T(), []interface{}{"phone", "google"}, u.AppMetaData["providers"])
+		})
+	}
+}
+
+func (ts *AdminTestSuite) TestAdminUsersImportCSV() {
+	csv := "email,phone,password_hash,email_confirmed,user_metadata\n" +
+		"csv@example.com,,sha1$seasalt$cff36ea83f5706ce9aa7454e63e431fc726b2dc8,true,\"{\"\"plan\"\": \"\"gold\"\"}\"\n" +
+		"csv2@example.com,,,maybe,\n"
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/import", strings.NewReader(csv))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	req.Header.Set("Content-Type", "text/csv")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	report := UserImportReport{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&report))
+	require.Equal(ts.T(), 1, report.Created)
+	require.Equal(ts.T(), 1, report.Failed)
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, "csv@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), "gold", u.UserMetaData["plan"])
+
+	// unknown columns reject the whole file
+	req = httptest.NewRequest(http.MethodPost, "/admin/users/import?format=csv", strings.NewReader("email,favourite_colour\n"))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *AdminTestSuite) TestAdminUserUpdatePasswordHistory() {
+	ts.Config.PasswordPolicy.HistorySize = 1
+	defer func() {
+		ts.Config.PasswordPolicy.HistorySize = 0
+	}()
+
+	u, err := models.NewUser("", "test1@example.com", "Current-Pass1", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+
+	var updateEndpoint = fmt.Sprintf("/admin/users/%s", u.ID)
+	for _, c := range []struct {
+		desc                string
+		skipPasswordHistory bool
+		code                int
+	}{
+		{"Recent password is rejected", false, http.StatusUnprocessableEntity},
+		{"Recent password is allowed with skip_password_history", true, http.StatusOK},
+	} {
+		ts.Run(c.desc, func() {
+			var buffer bytes.Buffer
+			require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+				"password":              "Current-Pass1",
+				"skip_password_history": c.skipPasswordHistory,
+			}))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, updateEndpoint, &buffer)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+
+			ts.API.handler.ServeHTTP(w, req)
+			require.Equal(ts.T(), c.code, w.Code)
+		})
+	}
+}
+
+func (ts *AdminTestSuite) TestAdminUserUpdateUnlock() {
+	u, err := models.NewUser("", "test1@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+	lockedUntil := time.Now().Add(time.Hour)
+	u.FailedLoginAttempts = 2
+	u.LockoutCount = 1
+	u.LockedUntil = &lockedUntil
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"unlock": true,
+	}))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/admin/users/%s", u.ID), &buffer)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	data := models.User{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	require.Nil(ts.T(), data.LockedUntil)
+	require.Zero(ts.T(), data.LockoutCount)
+	require.Zero(ts.T(), data.FailedLoginAttempts)
+}
+
+func (ts *AdminTestSuite) TestAdminUserUpdateStaffType() {
+	staff := ts.Config.Staff
+	ts.Config.Staff = conf.StaffConfiguration{
+		Roles: map[string]string{"BOS": "service_role"},
+	}
+	defer func() {
+		ts.Config.Staff = staff
+	}()
+
+	u, err := models.NewUser("", "test1@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error creating user")
+
+	var updateEndpoint = fmt.Sprintf("/admin/users/%s", u.ID)
+	for _, c := range []struct {
+		desc      string
+		staffType string
+		code      int
+		expected  string
+	}{
+		{"Grant staff type", "BOS", http.StatusOK, "BOS"},
+		{"Unknown staff type", "MOCA", http.StatusUnprocessableEntity, "BOS"},
+		{"Revoke staff type", "", http.StatusOK, ""},
+	} {
+		ts.Run(c.desc, func() {
+			var buffer bytes.Buffer
+			require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+				"staff_type": c.staffType,
+			}))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, updateEndpoint, &buffer)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+
+			ts.API.handler.ServeHTTP(w, req)
+			require.Equal(ts.T(), c.code, w.Code)
+
+			user, err := models.FindUserByID(ts.API.db, u.ID)
+			require.NoError(ts.T(), err)
+			require.Equal(ts.T(), c.expected, string(user.StaffType))
+		})
+	}
+}
@@ -13,9 +13,11 @@ import (
 	"github.com/sebest/xff"
 	"github.com/sirupsen/logrus"
 	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/crypto"
 	"github.com/supabase/gotrue/internal/mailer"
 	"github.com/supabase/gotrue/internal/observability"
 	"github.com/supabase/gotrue/internal/storage"
+	"github.com/supabase/gotrue/internal/utilities"
 )
 
 const (
@@ -31,6 +33,8 @@ type API struct {
 	db      *storage.Connection
 	config  *conf.GlobalConfiguration
 	version string
+
+	breachedPasswords *crypto.BreachedPasswordCorpus
 }
 
 // NewAPI instantiates a new REST API
@@ -55,6 +59,9 @@ func (a *API) deprecationNotices(ctx context.Context) {
 // NewAPIWithVersion creates a new REST API using the specified version
 func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfiguration, db *storage.Connection, version string) *API {
 	api := &API{config: globalConfig, db: db, version: version}
+	if globalConfig.Security.BreachedPasswords.Enabled {
+		api.breachedPasswords = crypto.NewBreachedPasswordCorpus(globalConfig.Security.BreachedPasswords.Path, globalConfig.Security.BreachedPasswords.MinCount)
+	}
 
 	api.deprecationNotices(ctx)
 
@@ -95,6 +102,7 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 		r.UseBypass(logger)
 
 		r.Get("/settings", api.Settings)
+		r.Get("/.well-known/jwks.json", api.JWKS)
 
 		r.Get("/authorize", api.ExternalProviderRedirect)
 
@@ -133,6 +141,12 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 		r.With(api.requireAuthentication).Route("/user", func(r *router) {
 			r.Get("/", api.UserGet)
 			r.With(sharedLimiter).Put("/", api.UserUpdate)
+
+			r.Route("/sessions", func(r *router) {
+				r.Get("/", api.UserListSessions)
+				r.Delete("/", api.UserRevokeOtherSessions)
+				r.Delete("/{session_id}", api.UserRevokeSession)
+			})
 		})
 
 		r.With(api.requireAuthentication).Route("/factors", func(r *router) {
@@ -184,6 +198,7 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 			r.Route("/users", func(r *router) {
 				r.Get("/", api.adminUsers)
 				r.Post("/", api.adminUserCreate)
+				r.Post("/import", api.adminUsersImport)
 
 				r.Route("/{user_id}", func(r *router) {
 					r.Use(api.loadUser)
@@ -219,12 +234,31 @@ func NewAPIWithVersion(ctx context.Context, globalConfig *conf.GlobalConfigurati
 				})
 			})
 
+			r.Route("/webhooks", func(r *router) {
+				r.Get("/", api.adminWebhookEndpointsList)
+				r.Post("/", api.adminWebhookEndpointsCreate)
+
+				r.Route("/deliveries", func(r *router) {
+					r.Get("/", api.adminWebhookDeliveriesList)
+					r.Post("/{delivery_id}/replay", api.adminWebhookDeliveryReplay)
+				})
+
+				r.Route("/{endpoint_id}", func(r *router) {
+					r.Use(api.loadWebhookEndpoint)
+
+					r.Get("/", api.adminWebhookEndpointsGet)
+					r.Put("/", api.adminWebhookEndpointsUpdate)
+					r.Delete("/", api.adminWebhookEndpointsDelete)
+					r.Post("/rotate_secret", api.adminWebhookEndpointsRotateSecret)
+				})
+			})
+
 		})
 	})
 
 	corsHandler := cors.New(cors.Options{
 		AllowedMethods:   []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Client-IP", "X-Client-Info", audHeaderName, useCookieHeader},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-Client-IP", "X-Client-Info", utilities.DeviceLabelHeader, audHeaderName, useCookieHeader},
 		ExposedHeaders:   []string{"X-Total-Count", "Link"},
 		AllowCredentials: true,
 	})
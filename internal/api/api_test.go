@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -49,6 +51,12 @@ func setupAPIForTestWithCallback(cb func(*conf.GlobalConfiguration, *storage.Con
 	return NewAPIWithVersion(context.Background(), config, conn, apiTestVersion), config, nil
 }
 
+// passwordGrantRequest is the request of a password grant, for access tokens
+// generated directly by the tests.
+func passwordGrantRequest() *http.Request {
+	return httptest.NewRequest(http.MethodPost, "/token?grant_type=password", nil)
+}
+
 func TestEmailEnabledByDefault(t *testing.T) {
 	api, _, err := setupAPIForTest()
 	require.NoError(t, err)
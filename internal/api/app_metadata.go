@@ -0,0 +1,65 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	gosort "sort"
+	"strings"
+
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/storage"
+	"github.com/supabase/gotrue/internal/utilities"
+)
+
+const AppMetadataRestrictedErrorCode = "app_metadata_restricted"
+
+// checkUserAppMetaData rejects the app_metadata keys users aren't allowed to
+// set themselves, those can only be set through the admin API.
+func (a *API) checkUserAppMetaData(updates map[string]interface{}) error {
+	var rejected []string
+	for key := range updates {
+		if !utilities.StringContains(a.config.Security.UserAppMetadataKeys, key) {
+			rejected = append(rejected, key)
+		}
+	}
+	if len(rejected) == 0 {
+		return nil
+	}
+	gosort.Strings(rejected)
+
+	e := forbiddenError("Updating %s in app_metadata requires admin privileges", strings.Join(rejected, ", "))
+	e.ErrorCode = AppMetadataRestrictedErrorCode
+	e.Reasons = rejected
+	return e
+}
+
+// updateAppMetaData applies the updates to the user's app_metadata, recording
+// the values of the changed keys before and after the update in the audit log.
+func (a *API) updateAppMetaData(r *http.Request, tx *storage.Connection, actor, user *models.User, updates map[string]interface{}) error {
+	before := make(map[string]interface{}, len(updates))
+	for key := range updates {
+		before[key] = user.AppMetaData[key]
+	}
+
+	if err := user.UpdateAppMetaData(tx, updates); err != nil {
+		return err
+	}
+
+	after := make(map[string]interface{}, len(updates))
+	for key, value := range before {
+		if v := user.AppMetaData[key]; !reflect.DeepEqual(v, value) {
+			after[key] = v
+		} else {
+			delete(before, key)
+		}
+	}
+	if len(after) == 0 {
+		return nil
+	}
+
+	return models.NewAuditLogEntry(r, tx, actor, models.AppMetadataUpdatedAction, "", map[string]interface{}{
+		"user_id": user.ID,
+		"before":  before,
+		"after":   after,
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -27,6 +28,10 @@ func (a *API) requireAuthentication(w http.ResponseWriter, r *http.Request) (con
 		return ctx, err
 	}
 
+	if err := requirePasswordNotExpired(r, getClaims(ctx)); err != nil {
+		return nil, err
+	}
+
 	ctx, err = a.maybeLoadUserOrSession(ctx)
 	if err != nil {
 		a.clearCookieTokens(config, w)
@@ -43,6 +48,10 @@ func (a *API) requireAdmin(ctx context.Context, w http.ResponseWriter, r *http.R
 		return nil, unauthorizedError("Invalid token")
 	}
 
+	if err := requirePasswordNotExpired(r, claims); err != nil {
+		return nil, err
+	}
+
 	adminRoles := a.config.JWT.AdminRoles
 
 	if isStringInSlice(claims.Role, adminRoles) {
@@ -54,6 +63,34 @@ func (a *API) requireAdmin(ctx context.Context, w http.ResponseWriter, r *http.R
 	return nil, unauthorizedError("User not allowed")
 }
 
+const (
+	// passwordExpiredRole is the role of the access tokens of sessions with
+	// an expired password.
+	passwordExpiredRole = "password_expired"
+	// passwordExpiredTokenExp caps the lifetime of these access tokens.
+	passwordExpiredTokenExp = 5 * time.Minute
+)
+
+// requirePasswordNotExpired only lets tokens issued with an expired password
+// read the user, change the password, reauthenticating first if that's
+// required, and sign out.
+func requirePasswordNotExpired(r *http.Request, claims *GoTrueClaims) error {
+	if claims == nil || !claims.PasswordExpired {
+		return nil
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodGet && path == "/user",
+		r.Method == http.MethodPut && path == "/user",
+		r.Method == http.MethodGet && path == "/reauthenticate",
+		r.Method == http.MethodPost && path == "/logout":
+		return nil
+	}
+
+	return forbiddenError("Password has expired and must be changed")
+}
+
 func (a *API) extractBearerToken(r *http.Request) (string, error) {
 	authHeader := r.Header.Get("Authorization")
 	matches := bearerRegexp.FindStringSubmatch(authHeader)
@@ -66,12 +103,9 @@ func (a *API) extractBearerToken(r *http.Request) (string, error) {
 
 func (a *API) parseJWTClaims(bearer string, r *http.Request) (context.Context, error) {
 	ctx := r.Context()
-	config := a.config
 
-	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
-	token, err := p.ParseWithClaims(bearer, &GoTrueClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.JWT.Secret), nil
-	})
+	p := jwt.Parser{}
+	token, err := p.ParseWithClaims(bearer, &GoTrueClaims{}, a.jwtVerificationKey)
 	if err != nil {
 		return nil, unauthorizedError("invalid JWT: unable to parse or verify signature, %v", err)
 	}
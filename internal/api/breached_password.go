@@ -0,0 +1,27 @@
+package api
+
+import (
+	"context"
+
+	"github.com/supabase/gotrue/internal/utilities"
+)
+
+// checkBreachedPassword rejects passwords found in the breached passwords
+// corpus, when the check is enabled.
+func (a *API) checkBreachedPassword(ctx context.Context, password string) error {
+	breached, err := a.isBreachedPassword(ctx, password)
+	if err != nil {
+		return internalServerError("Error checking password").WithInternalError(err)
+	}
+	if breached {
+		return weakPasswordError(&a.config.PasswordPolicy, []utilities.PasswordViolation{utilities.PasswordBreached})
+	}
+	return nil
+}
+
+func (a *API) isBreachedPassword(ctx context.Context, password string) (bool, error) {
+	if a.breachedPasswords == nil {
+		return false, nil
+	}
+	return a.breachedPasswords.IsBreached(ctx, password)
+}
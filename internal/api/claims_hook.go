@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/storage"
+	"github.com/supabase/gotrue/internal/utilities"
+)
+
+// ClaimsHookRequest is sent to the claims hook before an access token is
+// signed, on every grant.
+type ClaimsHookRequest struct {
+	User                 *models.User       `json:"user"`
+	Session              *ClaimsHookSession `json:"session,omitempty"`
+	Claims               *GoTrueClaims      `json:"claims"`
+	AuthenticationMethod string             `json:"authentication_method"`
+	// GrantType is the grant_type of the token endpoint, implicit for the
+	// sessions issued by the other endpoints.
+	GrantType string `json:"grant_type"`
+}
+
+// ClaimsHookSession is the session the access token is issued for.
+type ClaimsHookSession struct {
+	ID          uuid.UUID  `json:"id"`
+	AAL         string     `json:"aal"`
+	CreatedAt   time.Time  `json:"created_at"`
+	NotAfter    *time.Time `json:"not_after,omitempty"`
+	UserAgent   string     `json:"user_agent,omitempty"`
+	IP          string     `json:"ip,omitempty"`
+	DeviceLabel string     `json:"device_label,omitempty"`
+}
+
+func newClaimsHookSession(session *models.Session) *ClaimsHookSession {
+	return &ClaimsHookSession{
+		ID:          session.ID,
+		AAL:         session.GetAAL(),
+		CreatedAt:   session.CreatedAt,
+		NotAfter:    session.NotAfter,
+		UserAgent:   string(session.UserAgent),
+		IP:          string(session.IP),
+		DeviceLabel: string(session.DeviceLabel),
+	}
+}
+
+// ClaimsHookResponse holds the claims added to the access token, claims
+// set by GoTrue can't be overridden except for the role.
+type ClaimsHookResponse struct {
+	Claims map[string]interface{} `json:"claims,omitempty"`
+	Role   string                 `json:"role,omitempty"`
+}
+
+// reservedClaims can't be set by the claims hook.
+var reservedClaims = []string{
+	"iss", "sub", "aud", "exp", "nbf", "iat", "jti",
+	"email", "phone", "app_metadata", "user_metadata", "role",
+	"aal", "amr", "session_id", "password_expired", "is_backoffice",
+}
+
+// runClaimsHook returns the claims extended by the claims hook, or nil when
+// there is no hook or it failed and the hook fails open.
+func (a *API) runClaimsHook(r *http.Request, tx *storage.Connection, user *models.User, session *models.Session, claims *GoTrueClaims, authenticationMethod models.AuthenticationMethod) (jwt.MapClaims, error) {
+	config := a.config.ClaimsHook
+	if !config.Enabled() {
+		return nil, nil
+	}
+
+	request := &ClaimsHookRequest{
+		User:                 user,
+		Claims:               claims,
+		AuthenticationMethod: authenticationMethod.String(),
+		GrantType:            claimsHookGrantType(r),
+	}
+	if session != nil {
+		request.Session = newClaimsHookSession(session)
+	}
+	if authenticationMethod == models.TokenRefresh {
+		// refreshes keep the authentication method of the session
+		if n := len(claims.AuthenticationMethodReference); n > 0 {
+			request.AuthenticationMethod = claims.AuthenticationMethodReference[n-1].Method
+		}
+	}
+
+	response, err := a.callClaimsHook(r.Context(), tx, &config, request)
+	if err != nil {
+		var txErr claimsHookTransactionError
+		if config.FailClosed || errors.As(err, &txErr) {
+			return nil, internalServerError("Error running claims hook").WithInternalError(err)
+		}
+		logrus.WithError(err).WithField("component", "claims_hook").Warn("claims hook failed, issuing access token without custom claims")
+		return nil, nil
+	}
+
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	mapClaims := jwt.MapClaims{}
+	if err := json.Unmarshal(data, &mapClaims); err != nil {
+		return nil, err
+	}
+
+	for name, value := range response.Claims {
+		if utilities.StringContains(reservedClaims, name) {
+			logrus.WithField("component", "claims_hook").Warnf("claims hook cannot set the %q claim", name)
+			continue
+		}
+		mapClaims[name] = value
+	}
+	// the role of tokens with an expired password stays restricted
+	if response.Role != "" && !claims.PasswordExpired {
+		mapClaims["role"] = response.Role
+	}
+
+	return mapClaims, nil
+}
+
+// claimsHookGrantType returns the grant_type of the token endpoint, or
+// implicit for the sessions issued by sign up, verification, the OAuth and
+// SAML callbacks and MFA verification.
+func claimsHookGrantType(r *http.Request) string {
+	if strings.TrimSuffix(r.URL.Path, "/") == "/token" {
+		if grantType := r.FormValue("grant_type"); grantType != "" {
+			return grantType
+		}
+	}
+	return "implicit"
+}
+
+// claimsHookTransactionError is returned when the grant's transaction can't
+// be used anymore after the hook function failed, failing the grant even
+// when the hook fails open.
+type claimsHookTransactionError struct {
+	error
+}
+
+func (a *API) callClaimsHook(ctx context.Context, tx *storage.Connection, config *conf.ClaimsHookConfiguration, request *ClaimsHookRequest) (*ClaimsHookResponse, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ClaimsHookResponse{}
+	if config.Function != "" {
+		result, err := callClaimsHookFunction(ctx, tx, config, payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(result) > 0 {
+			if err := json.Unmarshal(result, response); err != nil {
+				return nil, errors.Wrap(err, "claims hook function returned malformed JSON")
+			}
+		}
+		return response, nil
+	}
+
+	secret := config.Secret
+	if secret == "" {
+		secret = a.config.JWT.Secret
+	}
+	sha, err := checksum(payload)
+	if err != nil {
+		return nil, err
+	}
+	w := Webhook{
+		WebhookConfig: &conf.WebhookConfig{
+			URL:        config.URL,
+			Retries:    1,
+			TimeoutSec: config.TimeoutSec,
+		},
+		jwtSecret: secret,
+		claims: webhookClaims{
+			StandardClaims: jwt.StandardClaims{
+				IssuedAt: time.Now().Unix(),
+				Subject:  uuid.Nil.String(),
+				Issuer:   gotrueIssuer,
+			},
+			SHA256: sha,
+		},
+		payload: payload,
+	}
+
+	body, err := w.trigger()
+	if body != nil {
+		defer utilities.SafeClose(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		if err := json.NewDecoder(body).Decode(response); err != nil {
+			return nil, errors.Wrap(err, "claims hook returned malformed JSON")
+		}
+	}
+	return response, nil
+}
+
+// callClaimsHookFunction calls the function in a savepoint of the grant's
+// transaction, so it sees the session being created, with a statement
+// timeout so it can't hold the grant for longer than the hook's timeout. A
+// failed call is rolled back and the grant goes on.
+func callClaimsHookFunction(ctx context.Context, tx *storage.Connection, config *conf.ClaimsHookConfiguration, payload []byte) ([]byte, error) {
+	var result []byte
+	err := tx.Transaction(func(tx *storage.Connection) error {
+		if _, err := tx.Store.ExecContext(ctx, "SAVEPOINT claims_hook"); err != nil {
+			return claimsHookTransactionError{errors.Wrap(err, "error creating claims hook savepoint")}
+		}
+
+		_, err := tx.Store.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", config.TimeoutSec*1000))
+		if err == nil {
+			err = tx.Store.GetContext(ctx, &result, "SELECT "+config.Function+"($1::jsonb)", string(payload))
+		}
+		if err != nil {
+			// rolling back also restores the statement timeout
+			if _, rerr := tx.Store.ExecContext(context.Background(), "ROLLBACK TO SAVEPOINT claims_hook"); rerr != nil {
+				return claimsHookTransactionError{errors.Wrap(rerr, "error rolling back claims hook savepoint")}
+			}
+			return errors.Wrap(err, "error calling claims hook function")
+		}
+
+		if _, err := tx.Store.ExecContext(ctx, "RELEASE SAVEPOINT claims_hook"); err != nil {
+			return claimsHookTransactionError{errors.Wrap(err, "error releasing claims hook savepoint")}
+		}
+		if _, err := tx.Store.ExecContext(ctx, "SET LOCAL statement_timeout TO DEFAULT"); err != nil {
+			return claimsHookTransactionError{errors.Wrap(err, "error restoring statement timeout")}
+		}
+		return nil
+	})
+	return result, err
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/require"
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/models"
+)
+
+func TestClaimsHook(t *testing.T) {
+	var request ClaimsHookRequest
+	status := http.StatusOK
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NotEmpty(t, r.Header.Get(headerHookSignature))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"claims": map[string]interface{}{
+				"tenant_id": "acme",
+				"sub":       "someone-else",
+			},
+			"role": "merchant",
+		}))
+	}))
+	defer svr.Close()
+
+	// Allowing connection to localhost for the tests only
+	localhost := removeLocalhostFromPrivateIPBlock()
+	defer unshiftPrivateIPBlock(localhost)
+
+	config := &conf.GlobalConfiguration{}
+	config.JWT.Secret = "secret"
+	config.JWT.Exp = 3600
+	config.ClaimsHook = conf.ClaimsHookConfiguration{
+		URL:        svr.URL,
+		TimeoutSec: 2,
+	}
+	a := &API{config: config}
+
+	user, err := models.NewUser("", "test@example.com", "password", "authenticated", nil)
+	require.NoError(t, err)
+	user.Role = "authenticated"
+
+	parse := func(token string) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(token, claims, a.jwtVerificationKey)
+		require.NoError(t, err)
+		return claims
+	}
+
+	refresh := httptest.NewRequest(http.MethodPost, "/token?grant_type=refresh_token", nil)
+	token, err := a.generateAccessToken(refresh, nil, user, nil, models.TokenRefresh)
+	require.NoError(t, err)
+	require.Equal(t, "refresh_token", request.GrantType)
+	require.Equal(t, user.ID, request.User.ID)
+	require.Nil(t, request.Session)
+
+	claims := parse(token)
+	require.Equal(t, "acme", claims["tenant_id"])
+	require.Equal(t, "merchant", claims["role"])
+	// claims set by GoTrue can't be overridden
+	require.Equal(t, user.ID.String(), claims["sub"])
+
+	// a failing hook fails open by default
+	status = http.StatusInternalServerError
+	token, err = a.generateAccessToken(passwordGrantRequest(), nil, user, nil, models.PasswordGrant)
+	require.NoError(t, err)
+	require.Equal(t, "password", request.GrantType)
+	claims = parse(token)
+	require.NotContains(t, claims, "tenant_id")
+	require.Equal(t, "authenticated", claims["role"])
+
+	// sessions issued outside of the token endpoint
+	_, err = a.generateAccessToken(httptest.NewRequest(http.MethodPost, "/verify", nil), nil, user, nil, models.OTP)
+	require.NoError(t, err)
+	require.Equal(t, "implicit", request.GrantType)
+	require.Equal(t, "otp", request.AuthenticationMethod)
+
+	config.ClaimsHook.FailClosed = true
+	_, err = a.generateAccessToken(passwordGrantRequest(), nil, user, nil, models.PasswordGrant)
+	require.Error(t, err)
+}
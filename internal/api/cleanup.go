@@ -2,7 +2,18 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/observability"
+	"github.com/supabase/gotrue/internal/storage"
+	"github.com/supabase/gotrue/internal/utilities"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var (
@@ -28,3 +39,105 @@ func WaitForCleanup(ctx context.Context) {
 		return
 	}
 }
+
+var (
+	cleanupRunsCounter    = observability.ObtainMetricCounter("gotrue_cleanup_runs", "Number of runs of the cleanup of expired rows")
+	cleanupDeletedCounter = observability.ObtainMetricCounter("gotrue_cleanup_deleted_rows", "Number of expired rows deleted by the cleanup")
+)
+
+// StartCleanup deletes expired auth artifacts every cleanup interval until
+// the context is done, when the cleanup is enabled.
+func StartCleanup(ctx context.Context, db *storage.Connection, config *conf.GlobalConfiguration) {
+	if !config.Cleanup.Enabled {
+		return
+	}
+
+	log := logrus.WithField("component", "cleanup")
+
+	cleanupWaitGroup.Add(1)
+	go func() {
+		defer cleanupWaitGroup.Done()
+
+		ticker := time.NewTicker(config.Cleanup.Interval)
+		defer ticker.Stop()
+
+		for {
+			deleted, err := RunCleanup(ctx, db, config)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.WithError(err).Error("cleanup failed")
+			} else if len(deleted) > 0 {
+				log.WithField("deleted", deleted).Info("deleted expired rows")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunCleanup deletes the expired rows of the tables with a retention, in
+// batches, and returns the number of rows deleted per table. It stops when
+// the context is done or when another replica is running the cleanup.
+func RunCleanup(ctx context.Context, db *storage.Connection, config *conf.GlobalConfiguration) (map[string]int, error) {
+	for table := range config.Cleanup.Retention {
+		if !utilities.StringContains(models.CleanupTables, table) {
+			return nil, fmt.Errorf("cleanup retention set for unknown table %q", table)
+		}
+	}
+
+	db = db.WithContext(ctx)
+	batchSize := config.Cleanup.BatchSize
+	timebox, inactivityTimeout := config.Sessions.LongestLimits()
+	deleted := make(map[string]int)
+
+	for _, table := range models.CleanupTables {
+		retention, ok := config.Cleanup.Retention[table]
+		if !ok {
+			continue
+		}
+
+		for batch := 0; batch < config.Cleanup.MaxBatches; batch++ {
+			if err := ctx.Err(); err != nil {
+				return deleted, err
+			}
+
+			locked, count := false, 0
+			err := db.Transaction(func(tx *storage.Connection) error {
+				var terr error
+				// every batch takes the lock, so another replica can't
+				// interleave its own batches
+				if locked, terr = models.TryCleanupLock(tx); terr != nil || !locked {
+					return terr
+				}
+				cutoff := time.Now().Add(-retention)
+				if table == (models.Session{}).TableName() {
+					count, terr = models.DeleteExpiredSessions(tx, cutoff, timebox, inactivityTimeout, batchSize)
+				} else {
+					count, terr = models.DeleteExpiredRows(tx, table, cutoff, batchSize)
+				}
+				return terr
+			})
+			if err != nil {
+				return deleted, errors.Wrapf(err, "error cleaning up %s", table)
+			}
+			if !locked {
+				cleanupRunsCounter.Add(ctx, 1, attribute.Bool("skipped", true))
+				return deleted, nil
+			}
+
+			if count > 0 {
+				deleted[table] += count
+				cleanupDeletedCounter.Add(ctx, int64(count), attribute.String("table", table))
+			}
+			if count < batchSize {
+				break
+			}
+		}
+	}
+
+	cleanupRunsCounter.Add(ctx, 1, attribute.Bool("skipped", false))
+	return deleted, nil
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/models"
+)
+
+type CleanupTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.GlobalConfiguration
+}
+
+func TestCleanup(t *testing.T) {
+	api, config, err := setupAPIForTest()
+	require.NoError(t, err)
+
+	ts := &CleanupTestSuite{
+		API:    api,
+		Config: config,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *CleanupTestSuite) SetupTest() {
+	models.TruncateAll(ts.API.db)
+}
+
+func (ts *CleanupTestSuite) backdate(table, column string, id interface{}, age time.Duration) {
+	require.NoError(ts.T(), ts.API.db.RawQuery("update "+table+" set "+column+" = ? where id = ?", time.Now().Add(-age), id).Exec())
+}
+
+func (ts *CleanupTestSuite) TestRunCleanup() {
+	u, err := models.NewUser("", "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	// a refreshed session, its first refresh token was revoked long ago but
+	// is kept with the session to detect its reuse
+	first, err := models.GrantAuthenticatedUser(ts.API.db, u, models.GrantParams{})
+	require.NoError(ts.T(), err)
+	second, err := models.GrantRefreshTokenSwap(&http.Request{}, ts.API.db, u, first)
+	require.NoError(ts.T(), err)
+	ts.backdate("refresh_tokens", "updated_at", first.ID, 48*time.Hour)
+
+	// a refresh token from before sessions, revoked long ago
+	legacy := &models.RefreshToken{UserID: u.ID, Token: "legacy-token", Revoked: true}
+	require.NoError(ts.T(), ts.API.db.Create(legacy))
+	ts.backdate("refresh_tokens", "updated_at", legacy.ID, 48*time.Hour)
+
+	// a session that expired long ago
+	notAfter := time.Now().Add(-48 * time.Hour)
+	expired, err := models.GrantAuthenticatedUser(ts.API.db, u, models.GrantParams{SessionNotAfter: &notAfter})
+	require.NoError(ts.T(), err)
+
+	// a factor that was never verified and one recently enrolled
+	stale, err := models.NewFactor(u, "stale", models.TOTP, models.FactorStateUnverified, "secret")
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(stale))
+	ts.backdate("mfa_factors", "updated_at", stale.ID, 48*time.Hour)
+	fresh, err := models.NewFactor(u, "fresh", models.TOTP, models.FactorStateUnverified, "secret")
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Create(fresh))
+
+	// webhook deliveries delivered and dead long ago, one still pending and
+	// one delivered recently
+	deliveries := map[models.WebhookDeliveryStatus]*models.WebhookDelivery{}
+	for _, status := range []models.WebhookDeliveryStatus{models.WebhookDeliveryDelivered, models.WebhookDeliveryDead, models.WebhookDeliveryPending} {
+		delivery, err := models.NewWebhookDelivery(SignupEvent, models.WebhookKindWebhook, "https://example.com/webhook", map[string]interface{}{"event": SignupEvent})
+		require.NoError(ts.T(), err)
+		delivery.Status = status
+		require.NoError(ts.T(), ts.API.db.Create(delivery))
+		ts.backdate("webhook_outbox", "updated_at", delivery.ID, 48*time.Hour)
+		deliveries[status] = delivery
+	}
+	recent, err := models.NewWebhookDelivery(SignupEvent, models.WebhookKindWebhook, "https://example.com/webhook", map[string]interface{}{"event": SignupEvent})
+	require.NoError(ts.T(), err)
+	recent.Status = models.WebhookDeliveryDelivered
+	require.NoError(ts.T(), ts.API.db.Create(recent))
+
+	cleanup := ts.Config.Cleanup
+	ts.Config.Cleanup = conf.CleanupConfiguration{
+		BatchSize:  1,
+		MaxBatches: 10,
+		Retention: map[string]time.Duration{
+			"mfa_factors":    24 * time.Hour,
+			"refresh_tokens": 24 * time.Hour,
+			"sessions":       24 * time.Hour,
+			"webhook_outbox": 24 * time.Hour,
+		},
+	}
+	defer func() {
+		ts.Config.Cleanup = cleanup
+	}()
+
+	deleted, err := RunCleanup(context.Background(), ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), map[string]int{
+		"mfa_factors":    1,
+		"refresh_tokens": 1,
+		"sessions":       1,
+		"webhook_outbox": 2,
+	}, deleted)
+
+	_, err = models.FindSessionByID(ts.API.db, *expired.SessionId)
+	require.True(ts.T(), models.IsNotFoundError(err))
+	_, err = models.FindSessionByID(ts.API.db, *second.SessionId)
+	require.NoError(ts.T(), err)
+	_, token, _, err := models.FindUserWithRefreshToken(ts.API.db, first.Token)
+	require.NoError(ts.T(), err)
+	require.True(ts.T(), token.Revoked)
+	_, _, _, err = models.FindUserWithRefreshToken(ts.API.db, legacy.Token)
+	require.True(ts.T(), models.IsNotFoundError(err))
+	_, err = models.FindFactorByFactorID(ts.API.db, stale.ID)
+	require.True(ts.T(), models.IsNotFoundError(err))
+	_, err = models.FindFactorByFactorID(ts.API.db, fresh.ID)
+	require.NoError(ts.T(), err)
+
+	var remaining []models.WebhookDelivery
+	require.NoError(ts.T(), ts.API.db.All(&remaining))
+	ids := []string{}
+	for _, delivery := range remaining {
+		ids = append(ids, delivery.ID.String())
+	}
+	require.ElementsMatch(ts.T(), []string{deliveries[models.WebhookDeliveryPending].ID.String(), recent.ID.String()}, ids)
+
+	// nothing is left to delete
+	deleted, err = RunCleanup(context.Background(), ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	require.Empty(ts.T(), deleted)
+}
+
+func (ts *CleanupTestSuite) TestRunCleanupUnknownTable() {
+	cleanup := ts.Config.Cleanup
+	ts.Config.Cleanup.Retention = map[string]time.Duration{"users": time.Hour}
+	defer func() {
+		ts.Config.Cleanup = cleanup
+	}()
+
+	_, err := RunCleanup(context.Background(), ts.API.db, ts.Config)
+	require.Error(ts.T(), err)
+}
@@ -30,6 +30,7 @@ const (
 	ssoProviderKey          = contextKey("sso_provider")
 	flowStateKey            = contextKey("flow_state_id")
 	platformKey             = contextKey("platform")
+	webhookEndpointKey      = contextKey("webhook_endpoint")
 )
 
 // withToken adds the JWT token to the context.
@@ -249,3 +250,15 @@ func getSSOProvider(ctx context.Context) *models.SSOProvider {
 	}
 	return obj.(*models.SSOProvider)
 }
+
+func withWebhookEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) context.Context {
+	return context.WithValue(ctx, webhookEndpointKey, endpoint)
+}
+
+func getWebhookEndpoint(ctx context.Context) *models.WebhookEndpoint {
+	obj := ctx.Value(webhookEndpointKey)
+	if obj == nil {
+		return nil
+	}
+	return obj.(*models.WebhookEndpoint)
+}
@@ -22,6 +22,9 @@ var (
 
 const InvalidChannelError = "Invalid channel, supported values are 'sms' or 'whatsapp'"
 
+// WeakPasswordErrorCode is the error_code of passwords rejected by the password policy
+const WeakPasswordErrorCode = "weak_password"
+
 var oauthErrorMap = map[int]string{
 	http.StatusBadRequest:          "invalid_request",
 	http.StatusUnauthorized:        "unauthorized_client",
@@ -65,8 +68,17 @@ func (e *OAuthError) Cause() error {
 	return e
 }
 
-func invalidPasswordLengthError(passwordMinLength int) *HTTPError {
-	return unprocessableEntityError(fmt.Sprintf("Password should be at least %d characters", passwordMinLength))
+// weakPasswordError reports every password policy violation, the message
+// describes the first one.
+func weakPasswordError(policy *conf.PasswordPolicyConfiguration, violations []utilities.PasswordViolation) *HTTPError {
+	reasons := make([]string, 0, len(violations))
+	for _, v := range violations {
+		reasons = append(reasons, string(v))
+	}
+	e := unprocessableEntityError(violations[0].Message(policy))
+	e.ErrorCode = WeakPasswordErrorCode
+	e.Reasons = reasons
+	return e
 }
 
 func invalidSignupError(config *conf.GlobalConfiguration) *HTTPError {
@@ -127,6 +139,9 @@ type HTTPError struct {
 	InternalError   error  `json:"-"`
 	InternalMessage string `json:"-"`
 	ErrorID         string `json:"error_id,omitempty"`
+	// ErrorCode and Reasons are machine readable details of the error
+	ErrorCode string   `json:"error_code,omitempty"`
+	Reasons   []string `json:"reasons,omitempty"`
 }
 
 func (e *HTTPError) Error() string {
@@ -164,6 +164,7 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 	var providerAccessToken string
 	var providerRefreshToken string
 	var grantParams models.GrantParams
+	grantParams.FillGrantParams(r)
 	var err error
 
 	if providerType == "twitter" {
@@ -218,10 +219,14 @@ func (a *API) internalExternalProviderCallback(w http.ResponseWriter, r *http.Re
 			flowState.UserID = &(user.ID)
 			terr = tx.Update(flowState)
 		} else {
-			token, terr = a.issueRefreshToken(ctx, tx, user, models.OAuth, grantParams)
+			token, terr = a.issueRefreshToken(r, tx, user, models.OAuth, grantParams)
 		}
 
 		if terr != nil {
+			// errors of the login policies are passed on to the client
+			if _, ok := terr.(*OAuthError); ok {
+				return terr
+			}
 			return oauthError("server_error", terr.Error())
 		}
 		return nil
@@ -301,7 +306,8 @@ func (a *API) createAccountFromExternalIdentity(tx *storage.Connection, r *http.
 			}
 		}
 
-		if _, terr = a.createNewIdentity(tx, user, providerType, identityData); terr != nil {
+		linked, terr := a.createNewIdentity(tx, user, providerType, identityData)
+		if terr != nil {
 			return nil, terr
 		}
 
@@ -309,6 +315,19 @@ func (a *API) createAccountFromExternalIdentity(tx *storage.Connection, r *http.
 			return nil, terr
 		}
 
+		if terr = models.NewAuditLogEntry(r, tx, user, models.IdentityLinkedAction, "", map[string]interface{}{
+			"provider":    providerType,
+			"identity_id": linked.ID,
+		}); terr != nil {
+			return nil, terr
+		}
+		if terr = triggerActionHooks(ctx, tx, models.IdentityLinkedAction, user, map[string]interface{}{
+			"provider":    providerType,
+			"identity_id": linked.ID,
+		}, config); terr != nil {
+			return nil, terr
+		}
+
 	case models.CreateAccount:
 		if config.DisableSignup {
 			return nil, forbiddenError("Signups not allowed for this instance")
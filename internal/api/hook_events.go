@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"embed"
+	"fmt"
+
+	"github.com/gofrs/uuid"
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// Events of the account lifecycle, each reports an audit action of the
+// hookEventCatalogue.
+const (
+	LogoutEvent                    = "logout"
+	UserDeletedEvent               = "user_deleted"
+	UserBannedEvent                = "user_banned"
+	PasswordChangedEvent           = "password_changed"
+	PasswordRecoveryRequestedEvent = "password_recovery_requested"
+	FactorEnrolledEvent            = "factor_enrolled"
+	FactorUnenrolledEvent          = "factor_unenrolled"
+	IdentityLinkedEvent            = "identity_linked"
+	PhoneChangedEvent              = "phone_changed"
+	SessionRevokedEvent            = "session_revoked"
+	TokenReuseDetectedEvent        = "token_reuse_detected"
+)
+
+// hookEventCatalogue maps the audit actions to the webhook events reporting
+// them. Handlers trigger the event of the action they record, so that the
+// audit log and the webhooks can't tell different stories.
+var hookEventCatalogue = map[models.AuditAction]HookEvent{
+	models.LogoutAction:                LogoutEvent,
+	models.UserDeletedAction:           UserDeletedEvent,
+	models.UserBannedAction:            UserBannedEvent,
+	models.UserUpdatePasswordAction:    PasswordChangedEvent,
+	models.UserRecoveryRequestedAction: PasswordRecoveryRequestedEvent,
+	models.EnrollFactorAction:          FactorEnrolledEvent,
+	models.UnenrollFactorAction:        FactorUnenrolledEvent,
+	models.DeleteFactorAction:          FactorUnenrolledEvent,
+	models.IdentityLinkedAction:        IdentityLinkedEvent,
+	models.PhoneChangedAction:          PhoneChangedEvent,
+	models.SessionRevokedAction:        SessionRevokedEvent,
+	models.OtherSessionsRevokedAction:  SessionRevokedEvent,
+	models.TokenReusedAction:           TokenReuseDetectedEvent,
+}
+
+// hookEventVersions are the versions of the payloads of the events, the
+// JSON schema of each version is in hookschemas. A breaking change of a
+// payload bumps its version and adds a schema.
+var hookEventVersions = map[HookEvent]int{
+	ValidateEvent:                  1,
+	SignupEvent:                    1,
+	EmailChangeEvent:               1,
+	LoginEvent:                     1,
+	LogoutEvent:                    1,
+	UserDeletedEvent:               1,
+	UserBannedEvent:                1,
+	PasswordChangedEvent:           1,
+	PasswordRecoveryRequestedEvent: 1,
+	FactorEnrolledEvent:            1,
+	FactorUnenrolledEvent:          1,
+	IdentityLinkedEvent:            1,
+	PhoneChangedEvent:              1,
+	SessionRevokedEvent:            1,
+	TokenReuseDetectedEvent:        1,
+}
+
+//go:embed hookschemas/*.json
+var hookSchemas embed.FS
+
+// hookSchemaPath is the path of the JSON schema of the version of the
+// event in hookSchemas.
+func hookSchemaPath(event HookEvent, version int) string {
+	return fmt.Sprintf("hookschemas/%s.v%d.json", event, version)
+}
+
+// hookPayload is the body of the requests to webhooks.
+type hookPayload struct {
+	Event      HookEvent              `json:"event"`
+	Version    int                    `json:"version"`
+	InstanceID uuid.UUID              `json:"instance_id,omitempty"`
+	User       *models.User           `json:"user"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+}
+
+func newHookPayload(event HookEvent, user *models.User, data map[string]interface{}) *hookPayload {
+	return &hookPayload{
+		Event:      event,
+		Version:    hookEventVersions[event],
+		InstanceID: uuid.Nil,
+		User:       user,
+		Data:       data,
+	}
+}
+
+// triggerActionHooks triggers the webhook event of the audit action, about
+// the user, see triggerEventHooks.
+func triggerActionHooks(ctx context.Context, conn *storage.Connection, action models.AuditAction, user *models.User, data map[string]interface{}, config *conf.GlobalConfiguration) error {
+	event, ok := hookEventCatalogue[action]
+	if !ok {
+		return internalServerError("No webhook event for the %s audit action", action)
+	}
+	return triggerHooks(ctx, conn, event, user, data, config)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/supabase/gotrue/internal/models"
+)
+
+// hookSchema is the subset of JSON schema used by the schemas of the
+// events.
+type hookSchema struct {
+	Type                 string                 `json:"type"`
+	Const                interface{}            `json:"const"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*hookSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *hookSchema            `json:"items"`
+}
+
+func loadHookSchema(t *testing.T, event HookEvent, version int) *hookSchema {
+	raw, err := hookSchemas.ReadFile(hookSchemaPath(event, version))
+	require.NoError(t, err, "missing schema of %s version %d", event, version)
+	schema := &hookSchema{}
+	require.NoError(t, json.Unmarshal(raw, schema))
+	return schema
+}
+
+// checkHookSchema checks the value against the schema, it only knows the
+// keywords of hookSchema.
+func checkHookSchema(t *testing.T, path string, schema *hookSchema, value interface{}) {
+	if schema.Const != nil {
+		assert.EqualValues(t, schema.Const, value, path)
+	}
+	if schema.Enum != nil {
+		assert.Contains(t, schema.Enum, value, path)
+	}
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		require.True(t, ok, "%s is not an object", path)
+		for _, key := range schema.Required {
+			assert.Contains(t, object, key, path)
+		}
+		for key, v := range object {
+			property, ok := schema.Properties[key]
+			if !ok {
+				assert.True(t, schema.AdditionalProperties == nil || *schema.AdditionalProperties, "%s.%s is not in the schema", path, key)
+				continue
+			}
+			checkHookSchema(t, path+"."+key, property, v)
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		require.True(t, ok, "%s is not an array", path)
+		for _, v := range array {
+			checkHookSchema(t, path+"[]", schema.Items, v)
+		}
+	case "string":
+		assert.IsType(t, "", value, path)
+	case "integer":
+		number, ok := value.(float64)
+		assert.True(t, ok && number == float64(int64(number)), "%s is not an integer", path)
+	case "boolean":
+		assert.IsType(t, true, value, path)
+	}
+}
+
+func TestHookEventCatalogue(t *testing.T) {
+	for action, event := range hookEventCatalogue {
+		_, ok := models.ActionLogTypeMap[action]
+		assert.True(t, ok, "%s isn't an audit action", action)
+		_, ok = hookEventVersions[event]
+		assert.True(t, ok, "%s has no version", event)
+	}
+
+	expected := map[string]bool{}
+	for event, version := range hookEventVersions {
+		schema := loadHookSchema(t, event, version)
+		assert.Equal(t, string(event), schema.Properties["event"].Const)
+		assert.EqualValues(t, version, schema.Properties["version"].Const)
+		expected[hookSchemaPath(event, version)] = true
+	}
+
+	// older versions of the schemas stay, as long as their event exists
+	paths, err := fs.Glob(hookSchemas, "hookschemas/*.json")
+	require.NoError(t, err)
+	for _, path := range paths {
+		if !expected[path] {
+			found := false
+			for event, version := range hookEventVersions {
+				for v := 1; v < version; v++ {
+					found = found || hookSchemaPath(event, v) == path
+				}
+			}
+			assert.True(t, found, "%s isn't the schema of an event", path)
+		}
+	}
+}
+
+func TestHookPayloadsMatchSchemas(t *testing.T) {
+	user, err := models.NewUser("", "test@example.com", "password", "authenticated", nil)
+	require.NoError(t, err)
+	sessionID := uuid.Must(uuid.NewV4())
+	factorID := uuid.Must(uuid.NewV4())
+	bannedUntil := time.Now().Add(time.Hour)
+
+	// the data the handlers send with the events
+	data := map[HookEvent]map[string]interface{}{
+		LogoutEvent:                    {"scope": LogoutGlobal, "session_id": sessionID},
+		UserDeletedEvent:               {"soft_delete": true},
+		UserBannedEvent:                {"banned_until": &bannedUntil},
+		PasswordChangedEvent:           {"actor": "admin"},
+		PasswordRecoveryRequestedEvent: nil,
+		FactorEnrolledEvent:            {"factor_id": factorID, "factor_type": models.TOTP},
+		FactorUnenrolledEvent:          {"factor_id": factorID, "factor_type": models.TOTP, "actor": "user"},
+		IdentityLinkedEvent:            {"provider": "github", "identity_id": "12345"},
+		PhoneChangedEvent:              {"previous_phone": ""},
+		SessionRevokedEvent:            {"session_ids": []uuid.UUID{sessionID}},
+		TokenReuseDetectedEvent: {
+			"token_id":       int64(42),
+			"session_id":     &sessionID,
+			"family_size":    3,
+			"family_revoked": true,
+			"ip_address":     "127.0.0.1",
+			"user_agent":     "curl/8.0",
+		},
+	}
+
+	for event, version := range hookEventVersions {
+		raw, err := json.Marshal(newHookPayload(event, user, data[event]))
+		require.NoError(t, err)
+		payload := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(raw, &payload))
+
+		checkHookSchema(t, string(event), loadHookSchema(t, event, version), payload)
+	}
+}
@@ -42,7 +42,9 @@ func TestSignupHookSendInstanceID(t *testing.T) {
 		data := map[string]interface{}{}
 		require.NoError(t, json.Unmarshal(raw, &data))
 
-		assert.Len(t, data, 3)
+		assert.Len(t, data, 4)
+		assert.Contains(t, data, "instance_id")
+		assert.EqualValues(t, 1, data["version"])
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer svr.Close()
@@ -53,8 +55,9 @@ func TestSignupHookSendInstanceID(t *testing.T) {
 
 	config := &conf.GlobalConfiguration{
 		Webhook: conf.WebhookConfig{
-			URL:    svr.URL,
-			Events: []string{SignupEvent},
+			URL:      svr.URL,
+			Events:   []string{SignupEvent},
+			Blocking: true,
 		},
 	}
 
@@ -83,7 +86,7 @@ func TestSignupHookFromClaims(t *testing.T) {
 		data := map[string]interface{}{}
 		require.NoError(t, json.Unmarshal(raw, &data))
 
-		assert.Len(t, data, 3)
+		assert.Len(t, data, 4)
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer svr.Close()
@@ -94,7 +97,8 @@ func TestSignupHookFromClaims(t *testing.T) {
 
 	config := &conf.GlobalConfiguration{
 		Webhook: conf.WebhookConfig{
-			Events: []string{"signup"},
+			Events:   []string{"signup"},
+			Blocking: true,
 		},
 	}
 
@@ -11,6 +11,8 @@ import (
 	"net/http"
 	"net/http/httptrace"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -18,6 +20,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 
+	"github.com/supabase/gotrue/client/webhooks"
 	"github.com/supabase/gotrue/internal/conf"
 	"github.com/supabase/gotrue/internal/models"
 	"github.com/supabase/gotrue/internal/storage"
@@ -47,8 +50,16 @@ type Webhook struct {
 	*conf.WebhookConfig
 
 	jwtSecret string
-	claims    jwt.Claims
-	payload   []byte
+	// previousJWTSecrets sign the request too, while receivers switch to
+	// a rotated secret.
+	previousJWTSecrets []string
+	// standardSecrets sign the request with the headers of the Standard
+	// Webhooks specification instead of a JWT, messageID identifies the
+	// delivery across attempts.
+	standardSecrets []*webhooks.Webhook
+	messageID       string
+	claims          jwt.Claims
+	payload         []byte
 }
 
 type WebhookResponse struct {
@@ -69,7 +80,7 @@ func (w *Webhook) trigger() (io.ReadCloser, error) {
 	hooklog := logrus.WithFields(logrus.Fields{
 		"component":   "webhook",
 		"url":         w.URL,
-		"signed":      w.jwtSecret != "",
+		"signed":      w.jwtSecret != "" || len(w.standardSecrets) > 0,
 		"instance_id": uuid.Nil.String(),
 	})
 	client := http.Client{
@@ -88,12 +99,16 @@ func (w *Webhook) trigger() (io.ReadCloser, error) {
 		req.Header.Set("Content-Type", "application/json")
 		watcher, req := watchForConnection(req)
 
-		if w.jwtSecret != "" {
-			header, jwtErr := w.generateSignature()
-			if jwtErr != nil {
-				return nil, jwtErr
+		if len(w.standardSecrets) > 0 {
+			w.setStandardSignatures(req, time.Now())
+		} else if w.jwtSecret != "" {
+			for _, secret := range append([]string{w.jwtSecret}, w.previousJWTSecrets...) {
+				header, jwtErr := w.generateSignature(secret)
+				if jwtErr != nil {
+					return nil, jwtErr
+				}
+				req.Header.Add(headerHookSignature, header)
 			}
-			req.Header.Set(headerHookSignature, header)
 		}
 
 		start := time.Now()
@@ -137,15 +152,45 @@ func (w *Webhook) trigger() (io.ReadCloser, error) {
 	return nil, unprocessableEntityError("Failed to handle signup webhook")
 }
 
-func (w *Webhook) generateSignature() (string, error) {
+func (w *Webhook) generateSignature(secret string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, w.claims)
-	tokenString, err := token.SignedString([]byte(w.jwtSecret))
+	tokenString, err := token.SignedString([]byte(secret))
 	if err != nil {
 		return "", internalServerError("Failed build signing string").WithInternalError(err)
 	}
 	return tokenString, nil
 }
 
+// setStandardSignatures sets the Standard Webhooks headers of the request,
+// with a signature per secret.
+func (w *Webhook) setStandardSignatures(req *http.Request, now time.Time) {
+	signatures := make([]string, 0, len(w.standardSecrets))
+	for _, secret := range w.standardSecrets {
+		signatures = append(signatures, secret.Sign(w.messageID, now, w.payload))
+	}
+	req.Header.Set(webhooks.HeaderID, w.messageID)
+	req.Header.Set(webhooks.HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(webhooks.HeaderSignature, strings.Join(signatures, " "))
+}
+
+// useStandardSignatures signs the requests with the Standard Webhooks
+// headers instead of a JWT. The current secret must be a Standard Webhooks
+// secret, previous secrets that aren't are left out.
+func (w *Webhook) useStandardSignatures(messageID string, secrets []string) error {
+	for i, secret := range secrets {
+		standardSecret, err := webhooks.NewWebhook(secret)
+		if err != nil {
+			if i == 0 {
+				return err
+			}
+			continue
+		}
+		w.standardSecrets = append(w.standardSecrets, standardSecret)
+	}
+	w.messageID = messageID
+	return nil
+}
+
 func closeBody(rsp *http.Response) {
 	if rsp != nil && rsp.Body != nil {
 		if err := rsp.Body.Close(); err != nil {
@@ -154,7 +199,21 @@ func closeBody(rsp *http.Response) {
 	}
 }
 
+// triggerEventHooks sends the event to the webhook, or to the function
+// hooks of the request. The event is written to the outbox with conn,
+// which should be the transaction of the change it reports, unless hooks
+// are blocking or the event is a validation, which is always delivered
+// during the request.
 func triggerEventHooks(ctx context.Context, conn *storage.Connection, event HookEvent, user *models.User, config *conf.GlobalConfiguration) error {
+	return triggerHooks(ctx, conn, event, user, nil, config)
+}
+
+// triggerHooks sends the event with its data, see triggerEventHooks.
+func triggerHooks(ctx context.Context, conn *storage.Connection, event HookEvent, user *models.User, data map[string]interface{}, config *conf.GlobalConfiguration) error {
+	if err := enqueueEndpointHooks(conn, event, user, data); err != nil {
+		return err
+	}
+
 	if config.Webhook.URL != "" {
 		hookURL, err := url.Parse(config.Webhook.URL)
 		if err != nil {
@@ -163,7 +222,7 @@ func triggerEventHooks(ctx context.Context, conn *storage.Connection, event Hook
 		if !config.Webhook.HasEvent(string(event)) {
 			return nil
 		}
-		return triggerHook(ctx, hookURL, config.Webhook.Secret, conn, event, user, config)
+		return triggerHook(ctx, hookURL, models.WebhookKindWebhook, config.Webhook.Secret, conn, event, user, data, config)
 	}
 
 	fun := getFunctionHooks(ctx)
@@ -176,7 +235,7 @@ func triggerEventHooks(ctx context.Context, conn *storage.Connection, event Hook
 		if err != nil {
 			return errors.Wrapf(err, "Failed to parse Event Function Hook URL")
 		}
-		err = triggerHook(ctx, hookURL, config.JWT.Secret, conn, event, user, config)
+		err = triggerHook(ctx, hookURL, models.WebhookKindFunctionHook, config.JWT.Secret, conn, event, user, data, config)
 		if err != nil {
 			return err
 		}
@@ -184,7 +243,7 @@ func triggerEventHooks(ctx context.Context, conn *storage.Connection, event Hook
 	return nil
 }
 
-func triggerHook(ctx context.Context, hookURL *url.URL, secret string, conn *storage.Connection, event HookEvent, user *models.User, config *conf.GlobalConfiguration) error {
+func triggerHook(ctx context.Context, hookURL *url.URL, kind, secret string, conn *storage.Connection, event HookEvent, user *models.User, data map[string]interface{}, config *conf.GlobalConfiguration) error {
 	if !hookURL.IsAbs() {
 		siteURL, err := url.Parse(config.SiteURL)
 		if err != nil {
@@ -195,43 +254,20 @@ func triggerHook(ctx context.Context, hookURL *url.URL, secret string, conn *sto
 		hookURL.User = siteURL.User
 	}
 
-	payload := struct {
-		Event      HookEvent    `json:"event"`
-		InstanceID uuid.UUID    `json:"instance_id,omitempty"`
-		User       *models.User `json:"user"`
-	}{
-		Event:      event,
-		InstanceID: uuid.Nil,
-		User:       user,
-	}
-	data, err := json.Marshal(&payload)
+	payload, err := json.Marshal(newHookPayload(event, user, data))
 	if err != nil {
 		return internalServerError("Failed to serialize the data for signup webhook").WithInternalError(err)
 	}
 
-	sha, err := checksum(data)
-	if err != nil {
-		return internalServerError("Failed to checksum the data for signup webhook").WithInternalError(err)
-	}
-
-	claims := webhookClaims{
-		StandardClaims: jwt.StandardClaims{
-			IssuedAt: time.Now().Unix(),
-			Subject:  uuid.Nil.String(),
-			Issuer:   gotrueIssuer,
-		},
-		SHA256: sha,
+	if !config.Webhook.Blocking && event != ValidateEvent {
+		return enqueueHook(conn, hookURL.String(), kind, nil, event, payload)
 	}
 
-	w := Webhook{
-		WebhookConfig: &config.Webhook,
-		jwtSecret:     secret,
-		claims:        claims,
-		payload:       data,
+	w, err := newWebhook(&config.Webhook, hookURL.String(), []string{secret}, payload)
+	if err != nil {
+		return err
 	}
 
-	w.URL = hookURL.String()
-
 	body, err := w.trigger()
 	if body != nil {
 		defer utilities.SafeClose(body)
@@ -261,6 +297,94 @@ func triggerHook(ctx context.Context, hookURL *url.URL, secret string, conn *sto
 	return err
 }
 
+// enqueueEndpointHooks writes the event to the outbox for the enabled
+// webhook endpoints receiving it. Validations need an answer during the
+// request, they are only sent to the webhook of the configuration.
+func enqueueEndpointHooks(conn *storage.Connection, event HookEvent, user *models.User, data map[string]interface{}) error {
+	if event == ValidateEvent {
+		return nil
+	}
+
+	endpoints, err := enabledWebhookEndpoints.get(conn)
+	if err != nil {
+		return internalServerError("Database error finding webhook endpoints").WithInternalError(err)
+	}
+
+	var payload []byte
+	for _, endpoint := range endpoints {
+		if !endpoint.HasEvent(string(event)) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(newHookPayload(event, user, data)); err != nil {
+				return internalServerError("Failed to serialize the data for webhook").WithInternalError(err)
+			}
+		}
+		endpointID := endpoint.ID
+		if err := enqueueHook(conn, endpoint.URL, models.WebhookKindEndpoint, &endpointID, event, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enqueueHook writes the event to the outbox, the dispatcher delivers it
+// once the transaction of conn commits.
+func enqueueHook(conn *storage.Connection, hookURL, kind string, endpointID *uuid.UUID, event HookEvent, data []byte) error {
+	payload := map[string]interface{}{}
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return internalServerError("Failed to serialize the data for webhook").WithInternalError(err)
+	}
+	delivery, err := models.NewWebhookDelivery(string(event), kind, hookURL, payload)
+	if err != nil {
+		return internalServerError("Failed to create webhook delivery").WithInternalError(err)
+	}
+	delivery.EndpointID = endpointID
+	if endpointID != nil {
+		err = delivery.CreateForEndpoint(conn)
+	} else {
+		err = conn.Create(delivery)
+	}
+	if err != nil {
+		return internalServerError("Database error saving webhook delivery").WithInternalError(err)
+	}
+	return nil
+}
+
+// newWebhook prepares the request of the payload to the URL, signed with
+// the secrets unless the first one is empty.
+func newWebhook(config *conf.WebhookConfig, hookURL string, secrets []string, data []byte) (*Webhook, error) {
+	sha, err := checksum(data)
+	if err != nil {
+		return nil, internalServerError("Failed to checksum the data for signup webhook").WithInternalError(err)
+	}
+
+	claims := webhookClaims{
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt: time.Now().Unix(),
+			Subject:  uuid.Nil.String(),
+			Issuer:   gotrueIssuer,
+		},
+		SHA256: sha,
+	}
+
+	// the request is made with a copy, trigger and the URL shouldn't change
+	// the configuration
+	webhookConfig := *config
+	webhookConfig.URL = hookURL
+
+	w := &Webhook{
+		WebhookConfig: &webhookConfig,
+		claims:        claims,
+		payload:       data,
+	}
+	if len(secrets) > 0 {
+		w.jwtSecret = secrets[0]
+		w.previousJWTSecrets = secrets[1:]
+	}
+	return w, nil
+}
+
 func watchForConnection(req *http.Request) (*connectionWatcher, *http.Request) {
 	w := new(connectionWatcher)
 	t := &httptrace.ClientTrace{
@@ -59,7 +59,7 @@ func (ts *InviteTestSuite) makeSuperAdmin(email string) string {
 	u.Role = "supabase_admin"
 
 	var token string
-	token, err = generateAccessToken(ts.API.db, u, nil, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret, false)
+	token, err = ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
 
 	require.NoError(ts.T(), err, "Error generating access token")
 
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/supabase/gotrue/internal/conf"
+)
+
+// signJWT signs the claims with the active key, or with the JWT secret when
+// no key is configured.
+func (a *API) signJWT(claims jwt.Claims) (string, error) {
+	config := a.config.JWT
+
+	key := config.ActiveKey()
+	if key == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(config.Secret))
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	if key.KeyID != "" {
+		token.Header["kid"] = key.KeyID
+	}
+	return token.SignedString(key.SigningKey)
+}
+
+// jwtVerificationKey returns the key verifying the token, any non retired key
+// can verify the tokens it signed so rotating keys doesn't invalidate them.
+func (a *API) jwtVerificationKey(token *jwt.Token) (interface{}, error) {
+	config := a.config.JWT
+
+	if len(config.Keys) == 0 {
+		if token.Method.Alg() != jwt.SigningMethodHS256.Name {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return []byte(config.Secret), nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key := config.VerificationKey(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	// the algorithm of the key is trusted, not the one of the token
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.VerifyingKey, nil
+}
+
+// JWKS publishes the public keys verifying access tokens.
+func (a *API) JWKS(w http.ResponseWriter, r *http.Request) error {
+	set := jwk.NewSet()
+	for _, key := range a.config.JWT.Keys {
+		if key.Status == conf.JWTKeyRetired || key.VerifyingKey == nil {
+			continue
+		}
+		if _, ok := key.VerifyingKey.([]byte); ok {
+			// symmetric keys are secret
+			continue
+		}
+
+		k, err := jwk.New(key.VerifyingKey)
+		if err != nil {
+			return internalServerError("Error publishing JWT key").WithInternalError(err)
+		}
+		for name, value := range map[string]interface{}{
+			jwk.KeyIDKey:     key.KeyID,
+			jwk.AlgorithmKey: key.Algorithm,
+			jwk.KeyUsageKey:  "sig",
+		} {
+			if err := k.Set(name, value); err != nil {
+				return internalServerError("Error publishing JWT key").WithInternalError(err)
+			}
+		}
+		set.Add(k)
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=600")
+	return sendJSON(w, http.StatusOK, set)
+}
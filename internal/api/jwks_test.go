@@ -0,0 +1,104 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/require"
+	"github.com/supabase/gotrue/internal/conf"
+)
+
+func rsaPrivateKeyPEM(t *testing.T) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+}
+
+func ed25519PrivateKeyPEM(t *testing.T) string {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	config := &conf.GlobalConfiguration{}
+	config.JWT.Secret = "secret"
+	a := &API{config: config}
+
+	parse := func(token string) error {
+		_, err := new(jwt.Parser).ParseWithClaims(token, &GoTrueClaims{}, a.jwtVerificationKey)
+		return err
+	}
+	rotate := func(keys conf.JWTKeys) {
+		config.JWT.Keys = keys
+		require.NoError(t, config.JWT.Validate())
+	}
+
+	// tokens are signed with the secret until keys are configured
+	legacyToken, err := a.signJWT(&GoTrueClaims{Role: "authenticated"})
+	require.NoError(t, err)
+	require.NoError(t, parse(legacyToken))
+
+	rsaKey, edKey := rsaPrivateKeyPEM(t), ed25519PrivateKeyPEM(t)
+
+	// add
+	rotate(conf.JWTKeys{
+		{Algorithm: "HS256", Status: conf.JWTKeyActive},
+		{KeyID: "rsa", Algorithm: "RS256", Key: rsaKey},
+	})
+	require.NoError(t, parse(legacyToken))
+
+	// promote
+	rotate(conf.JWTKeys{
+		{Algorithm: "HS256"},
+		{KeyID: "rsa", Algorithm: "RS256", Key: rsaKey, Status: conf.JWTKeyActive},
+	})
+	rsaToken, err := a.signJWT(&GoTrueClaims{Role: "authenticated"})
+	require.NoError(t, err)
+	require.NoError(t, parse(rsaToken))
+	require.NoError(t, parse(legacyToken))
+
+	// retire
+	rotate(conf.JWTKeys{
+		{Algorithm: "HS256", Status: conf.JWTKeyRetired},
+		{KeyID: "rsa", Algorithm: "RS256", Key: rsaKey},
+		{KeyID: "ed", Algorithm: "EdDSA", Key: edKey, Status: conf.JWTKeyActive},
+	})
+	edToken, err := a.signJWT(&GoTrueClaims{Role: "authenticated"})
+	require.NoError(t, err)
+	require.NoError(t, parse(edToken))
+	require.NoError(t, parse(rsaToken))
+	require.Error(t, parse(legacyToken))
+
+	// a token can't pick another algorithm for a known kid
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &GoTrueClaims{Role: "service_role"})
+	forged.Header["kid"] = "rsa"
+	forgedToken, err := forged.SignedString([]byte(rsaKey))
+	require.NoError(t, err)
+	require.Error(t, parse(forgedToken))
+
+	// only public parts of non retired asymmetric keys are published
+	w := httptest.NewRecorder()
+	require.NoError(t, a.JWKS(w, httptest.NewRequest(http.MethodGet, "http://localhost/.well-known/jwks.json", nil)))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var jwks struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&jwks))
+	require.Len(t, jwks.Keys, 2)
+	for _, key := range jwks.Keys {
+		require.NotContains(t, key, "d")
+		require.Equal(t, "sig", key["use"])
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/observability"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// recordFailedLogin counts a failed password login against the user, locking
+// the account after too many of them, and returns the error to respond with.
+func (a *API) recordFailedLogin(r *http.Request, db *storage.Connection, user *models.User, provider string) error {
+	config := a.config.Security.Lockout
+	if config.MaxAttempts <= 0 {
+		return oauthError("invalid_grant", InvalidLoginMessage)
+	}
+
+	locked := false
+	err := db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		if locked, terr = user.RecordFailedLogin(tx, config.MaxAttempts, config.Duration, config.MaxDuration); terr != nil {
+			return terr
+		}
+		if locked {
+			return models.NewAuditLogEntry(r, tx, user, models.AccountLockedAction, "", map[string]interface{}{
+				"provider":      provider,
+				"locked_until":  user.LockedUntil,
+				"lockout_count": user.LockoutCount,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return internalServerError("Database error recording failed login").WithInternalError(err)
+	}
+
+	if locked && config.NotifyUser && user.GetEmail() != "" {
+		// the lock is already in place, failing to notify the user
+		// doesn't change the response
+		if err := a.Mailer(r.Context()).AccountLockedMail(user, *user.LockedUntil); err != nil {
+			observability.GetLogEntry(r).WithError(err).Warn("unable to send account locked email")
+		}
+	}
+
+	return oauthError("invalid_grant", InvalidLoginMessage)
+}
@@ -7,30 +7,78 @@ import (
 	"github.com/supabase/gotrue/internal/storage"
 )
 
+// LogoutScope is the set of sessions revoked by a logout.
+type LogoutScope string
+
+const (
+	// LogoutLocal revokes the session of the access token.
+	LogoutLocal LogoutScope = "local"
+	// LogoutOthers revokes all the sessions except the session of the
+	// access token.
+	LogoutOthers LogoutScope = "others"
+	// LogoutGlobal revokes all the sessions of the user, it is the default.
+	LogoutGlobal LogoutScope = "global"
+)
+
 // Logout is the endpoint for logging out a user and thereby revoking any refresh tokens
 func (a *API) Logout(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 	db := a.db.WithContext(ctx)
 	config := a.config
 
-	a.clearCookieTokens(config, w)
+	scope := LogoutGlobal
+	if value := r.URL.Query().Get("scope"); value != "" {
+		switch LogoutScope(value) {
+		case LogoutLocal, LogoutOthers, LogoutGlobal:
+			scope = LogoutScope(value)
+		default:
+			return badRequestError("Unsupported logout scope %q", value)
+		}
+	}
 
 	s := getSession(ctx)
 	u := getUser(ctx)
 
+	if s == nil && scope == LogoutOthers {
+		return badRequestError("Signing out other devices requires an access token with a session")
+	}
+
 	err := db.Transaction(func(tx *storage.Connection) error {
-		if terr := models.NewAuditLogEntry(r, tx, u, models.LogoutAction, "", nil); terr != nil {
+		if terr := models.NewAuditLogEntry(r, tx, u, models.LogoutAction, "", map[string]interface{}{
+			"scope": scope,
+		}); terr != nil {
 			return terr
 		}
+		data := map[string]interface{}{"scope": scope}
 		if s != nil {
+			data["session_id"] = s.ID
+		}
+		if terr := triggerActionHooks(ctx, tx, models.LogoutAction, u, data, config); terr != nil {
+			return terr
+		}
+		if s == nil {
+			// access tokens without a session can't tell which refresh
+			// tokens belong to the device
+			return models.LogoutAllRefreshTokens(tx, u.ID)
+		}
+		switch scope {
+		case LogoutLocal:
+			return models.LogoutSession(tx, s.ID)
+		case LogoutOthers:
+			return models.LogoutAllExceptMe(tx, s.ID, u.ID)
+		default:
 			return models.Logout(tx, u.ID)
 		}
-		return models.LogoutAllRefreshTokens(tx, u.ID)
 	})
 	if err != nil {
 		return internalServerError("Error logging out user").WithInternalError(err)
 	}
 
+	// the session of the cookies outlives a logout of the other sessions
+	if scope != LogoutOthers {
+		a.clearCookieTokens(config, w)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
@@ -42,7 +41,7 @@ func (ts *LogoutTestSuite) SetupTest() {
 
 	// generate access token to use for logout
 	var t string
-	t, err = generateAccessToken(ts.API.db, u, nil, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret, false)
+	t, err = ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
 	require.NoError(ts.T(), err)
 	ts.token = t
 }
@@ -63,3 +62,76 @@ func (ts *LogoutTestSuite) TestLogoutSuccess() {
 		}
 	}
 }
+
+func (ts *LogoutTestSuite) TestLogoutScopes() {
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+
+	cases := []struct {
+		scope     string
+		code      int
+		remaining int
+		cleared   bool
+	}{
+		{"local", http.StatusNoContent, 1, true},
+		{"others", http.StatusNoContent, 1, false},
+		{"global", http.StatusNoContent, 0, true},
+		{"", http.StatusNoContent, 0, true},
+		{"everywhere", http.StatusBadRequest, 2, false},
+	}
+
+	for _, c := range cases {
+		ts.Run(c.scope, func() {
+			require.NoError(ts.T(), models.Logout(ts.API.db, u.ID))
+			current, err := models.GrantAuthenticatedUser(ts.API.db, u, models.GrantParams{})
+			require.NoError(ts.T(), err)
+			other, err := models.GrantAuthenticatedUser(ts.API.db, u, models.GrantParams{})
+			require.NoError(ts.T(), err)
+
+			token, err := ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, current.SessionId, models.PasswordGrant)
+			require.NoError(ts.T(), err)
+
+			req := httptest.NewRequest(http.MethodPost, "http://localhost/logout?scope="+c.scope, nil)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			w := httptest.NewRecorder()
+
+			ts.API.handler.ServeHTTP(w, req)
+			require.Equal(ts.T(), c.code, w.Code)
+
+			sessions, err := models.FindSessionsByUserID(ts.API.db, u.ID)
+			require.NoError(ts.T(), err)
+			require.Len(ts.T(), sessions, c.remaining)
+			if c.scope == "local" {
+				require.Equal(ts.T(), *other.SessionId, sessions[0].ID)
+			} else if c.scope == "others" {
+				require.Equal(ts.T(), *current.SessionId, sessions[0].ID)
+			}
+
+			require.Equal(ts.T(), c.cleared, len(w.Result().Cookies()) > 0)
+		})
+	}
+}
+
+func (ts *LogoutTestSuite) TestLogoutWebhookEvent() {
+	webhook := ts.Config.Webhook
+	ts.Config.Webhook.URL = "http://localhost/hook"
+	ts.Config.Webhook.Events = []string{LogoutEvent}
+	ts.Config.Webhook.Blocking = false
+	defer func() {
+		ts.Config.Webhook = webhook
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/logout?scope=global", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	w := httptest.NewRecorder()
+
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusNoContent, w.Code)
+
+	deliveries, err := models.FindWebhookDeliveries(ts.API.db, models.WebhookDeliveryPending, nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), deliveries, 1)
+	require.Equal(ts.T(), LogoutEvent, deliveries[0].Event)
+	require.EqualValues(ts.T(), 1, deliveries[0].Payload["version"])
+	require.Equal(ts.T(), map[string]interface{}{"scope": "global"}, deliveries[0].Payload["data"])
+}
@@ -9,9 +9,9 @@ import (
 	"net/http"
 	"strings"
 
-	"github.com/sethvargo/go-password/password"
 	"github.com/supabase/gotrue/internal/models"
 	"github.com/supabase/gotrue/internal/storage"
+	"github.com/supabase/gotrue/internal/utilities"
 )
 
 // MagicLinkParams holds the parameters for a magic link request
@@ -80,9 +80,9 @@ func (a *API) MagicLink(w http.ResponseWriter, r *http.Request) error {
 	if isNewUser {
 		// User either doesn't exist or hasn't completed the signup process.
 		// Sign them up with temporary password.
-		password, err := password.Generate(30, 10, 1, false, true)
+		password, err := utilities.GeneratePassword(&config.PasswordPolicy)
 		if err != nil {
-			internalServerError("error creating user").WithInternalError(err)
+			return internalServerError("error creating user").WithInternalError(err)
 		}
 		fmt.Println("password", password)
 
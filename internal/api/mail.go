@@ -11,13 +11,13 @@ import (
 	"github.com/badoux/checkmail"
 	"github.com/fatih/structs"
 	"github.com/pkg/errors"
-	"github.com/sethvargo/go-password/password"
 	"github.com/supabase/gotrue/internal/api/provider"
 	"github.com/supabase/gotrue/internal/conf"
 	"github.com/supabase/gotrue/internal/crypto"
 	"github.com/supabase/gotrue/internal/mailer"
 	"github.com/supabase/gotrue/internal/models"
 	"github.com/supabase/gotrue/internal/storage"
+	"github.com/supabase/gotrue/internal/utilities"
 )
 
 var (
@@ -71,7 +71,7 @@ func (a *API) GenerateLink(w http.ResponseWriter, r *http.Request) error {
 		if models.IsNotFoundError(err) {
 			if params.Type == magicLinkVerification {
 				params.Type = signupVerification
-				params.Password, err = password.Generate(30, 10, 1, false, true)
+				params.Password, err = utilities.GeneratePassword(&config.PasswordPolicy)
 				if err != nil {
 					return internalServerError("error creating user").WithInternalError(err)
 				}
@@ -104,6 +104,12 @@ func (a *API) GenerateLink(w http.ResponseWriter, r *http.Request) error {
 			if terr = models.NewAuditLogEntry(r, tx, user, models.UserRecoveryRequestedAction, "", nil); terr != nil {
 				return terr
 			}
+			// magic links share the audit action, but aren't a recovery
+			if params.Type == recoveryVerification {
+				if terr = triggerActionHooks(ctx, tx, models.UserRecoveryRequestedAction, user, nil, config); terr != nil {
+					return terr
+				}
+			}
 			user.RecoveryToken = hashedToken
 			user.RecoverySentAt = &now
 			terr = errors.Wrap(tx.UpdateOnly(user, "recovery_token", "recovery_sent_at"), "Database error updating user for recovery")
@@ -154,8 +160,11 @@ func (a *API) GenerateLink(w http.ResponseWriter, r *http.Request) error {
 				if params.Password == "" {
 					return unprocessableEntityError("Signup requires a valid password")
 				}
-				if len(params.Password) < config.PasswordMinLength {
-					return invalidPasswordLengthError(config.PasswordMinLength)
+				if violations := utilities.ValidatePassword(&config.PasswordPolicy, params.Password, params.Email); len(violations) > 0 {
+					return weakPasswordError(&config.PasswordPolicy, violations)
+				}
+				if err := a.checkBreachedPassword(ctx, params.Password); err != nil {
+					return err
 				}
 				signupParams := &SignupParams{
 					Email:    params.Email,
@@ -10,6 +10,7 @@ import (
 	"github.com/aaronarduino/goqrsvg"
 	svg "github.com/ajstarks/svgo"
 	"github.com/boombuler/barcode/qr"
+	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/gofrs/uuid"
 	"github.com/pquerna/otp/totp"
 	"github.com/supabase/gotrue/internal/metering"
@@ -33,19 +34,21 @@ type TOTPObject struct {
 }
 
 type EnrollFactorResponse struct {
-	ID   uuid.UUID  `json:"id"`
-	Type string     `json:"type"`
-	TOTP TOTPObject `json:"totp,omitempty"`
+	ID   uuid.UUID   `json:"id"`
+	Type string      `json:"type"`
+	TOTP *TOTPObject `json:"totp,omitempty"`
 }
 
 type VerifyFactorParams struct {
-	ChallengeID uuid.UUID `json:"challenge_id"`
-	Code        string    `json:"code"`
+	ChallengeID uuid.UUID             `json:"challenge_id"`
+	Code        string                `json:"code"`
+	WebAuthn    *WebAuthnVerifyParams `json:"webauthn,omitempty"`
 }
 
 type ChallengeFactorResponse struct {
-	ID        uuid.UUID `json:"id"`
-	ExpiresAt int64     `json:"expires_at"`
+	ID        uuid.UUID          `json:"id"`
+	ExpiresAt int64              `json:"expires_at"`
+	WebAuthn  *WebAuthnChallenge `json:"webauthn,omitempty"`
 }
 
 type UnenrollFactorResponse struct {
@@ -77,8 +80,8 @@ func (a *API) EnrollFactor(w http.ResponseWriter, r *http.Request) error {
 		return unprocessableEntityError("MFA enrollment only supported for non-SSO users at this time")
 	}
 
-	if params.FactorType != models.TOTP {
-		return badRequestError("factor_type needs to be totp")
+	if params.FactorType != models.TOTP && params.FactorType != models.WebAuthn {
+		return badRequestError("factor_type needs to be totp or webauthn")
 	}
 
 	if params.Issuer == "" {
@@ -112,6 +115,22 @@ func (a *API) EnrollFactor(w http.ResponseWriter, r *http.Request) error {
 		return forbiddenError("Maximum number of enrolled factors reached, unenroll to continue")
 	}
 
+	if params.FactorType == models.WebAuthn {
+		// the credential is registered by the first challenge of the
+		// factor, once verified
+		factor, err := models.NewFactor(user, params.FriendlyName, params.FactorType, models.FactorStateUnverified, "")
+		if err != nil {
+			return internalServerError("database error creating factor").WithInternalError(err)
+		}
+		if err := a.createFactor(r, user, factor); err != nil {
+			return err
+		}
+		return sendJSON(w, http.StatusOK, &EnrollFactorResponse{
+			ID:   factor.ID,
+			Type: models.WebAuthn,
+		})
+	}
+
 	key, err := totp.Generate(totp.GenerateOpts{
 		Issuer:      issuer,
 		AccountName: user.GetEmail(),
@@ -133,25 +152,14 @@ func (a *API) EnrollFactor(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return internalServerError("database error creating factor").WithInternalError(err)
 	}
-	err = a.db.Transaction(func(tx *storage.Connection) error {
-		if terr := tx.Create(factor); terr != nil {
-			return terr
-		}
-		if terr := models.NewAuditLogEntry(r, tx, user, models.EnrollFactorAction, r.RemoteAddr, map[string]interface{}{
-			"factor_id": factor.ID,
-		}); terr != nil {
-			return terr
-		}
-		return nil
-	})
-	if err != nil {
+	if err := a.createFactor(r, user, factor); err != nil {
 		return err
 	}
 
 	return sendJSON(w, http.StatusOK, &EnrollFactorResponse{
 		ID:   factor.ID,
 		Type: models.TOTP,
-		TOTP: TOTPObject{
+		TOTP: &TOTPObject{
 			// See: https://css-tricks.com/probably-dont-base64-svg/
 			QRCode: buf.String(),
 			Secret: factor.Secret,
@@ -160,6 +168,24 @@ func (a *API) EnrollFactor(w http.ResponseWriter, r *http.Request) error {
 	})
 }
 
+// createFactor saves the enrolled factor, with its audit entry and event.
+func (a *API) createFactor(r *http.Request, user *models.User, factor *models.Factor) error {
+	return a.db.Transaction(func(tx *storage.Connection) error {
+		if terr := tx.Create(factor); terr != nil {
+			return terr
+		}
+		if terr := models.NewAuditLogEntry(r, tx, user, models.EnrollFactorAction, r.RemoteAddr, map[string]interface{}{
+			"factor_id": factor.ID,
+		}); terr != nil {
+			return terr
+		}
+		return triggerActionHooks(r.Context(), tx, models.EnrollFactorAction, user, map[string]interface{}{
+			"factor_id":   factor.ID,
+			"factor_type": factor.FactorType,
+		}, a.config)
+	})
+}
+
 func (a *API) ChallengeFactor(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
 	config := a.config
@@ -172,6 +198,20 @@ func (a *API) ChallengeFactor(w http.ResponseWriter, r *http.Request) error {
 		return internalServerError("Database error creating challenge").WithInternalError(err)
 	}
 
+	var webAuthnChallenge *WebAuthnChallenge
+	if factor.FactorType == models.WebAuthn {
+		factors, err := models.FindFactorsByUser(a.db, user)
+		if err != nil {
+			return internalServerError("Database error finding factors").WithInternalError(err)
+		}
+		var sessionData *webauthn.SessionData
+		webAuthnChallenge, sessionData, err = a.beginWebAuthnCeremony(user, factor, factors)
+		if err != nil {
+			return err
+		}
+		challenge.WebAuthnSessionData = &models.WebAuthnSessionData{SessionData: sessionData}
+	}
+
 	err = a.db.Transaction(func(tx *storage.Connection) error {
 		if terr := tx.Create(challenge); terr != nil {
 			return terr
@@ -191,6 +231,7 @@ func (a *API) ChallengeFactor(w http.ResponseWriter, r *http.Request) error {
 	return sendJSON(w, http.StatusOK, &ChallengeFactorResponse{
 		ID:        challenge.ID,
 		ExpiresAt: challenge.GetExpiryTime(config.MFA.ChallengeExpiryDuration).Unix(),
+		WebAuthn:  webAuthnChallenge,
 	})
 }
 
@@ -243,7 +284,21 @@ func (a *API) VerifyFactor(w http.ResponseWriter, r *http.Request) error {
 		return badRequestError("%v has expired, verify against another challenge or create a new challenge.", challenge.ID)
 	}
 
-	if valid := totp.Validate(params.Code, factor.Secret); !valid {
+	authenticationMethod := models.TOTPSignIn
+	var webAuthnCredential *models.WebAuthnCredential
+	if factor.FactorType == models.WebAuthn {
+		if challenge.FactorID != factor.ID {
+			return badRequestError("Challenge does not belong to the factor")
+		}
+		factors, err := models.FindFactorsByUser(a.db, user)
+		if err != nil {
+			return internalServerError("Database error finding factors").WithInternalError(err)
+		}
+		if webAuthnCredential, err = a.finishWebAuthnCeremony(user, factor, factors, challenge.WebAuthnSessionData, params.WebAuthn); err != nil {
+			return err
+		}
+		authenticationMethod = models.WebAuthnSignIn
+	} else if valid := totp.Validate(params.Code, factor.Secret); !valid {
 		return badRequestError("Invalid TOTP code entered")
 	}
 
@@ -259,6 +314,11 @@ func (a *API) VerifyFactor(w http.ResponseWriter, r *http.Request) error {
 		if terr = challenge.Verify(tx); terr != nil {
 			return terr
 		}
+		if webAuthnCredential != nil {
+			if terr = factor.UpdateWebAuthnCredential(tx, webAuthnCredential); terr != nil {
+				return terr
+			}
+		}
 		if !factor.IsVerified() {
 			if terr = factor.UpdateStatus(tx, models.FactorStateVerified); terr != nil {
 				return terr
@@ -268,7 +328,7 @@ func (a *API) VerifyFactor(w http.ResponseWriter, r *http.Request) error {
 		if terr != nil {
 			return terr
 		}
-		token, terr = a.updateMFASessionAndClaims(r, tx, user, models.TOTPSignIn, models.GrantParams{
+		token, terr = a.updateMFASessionAndClaims(r, tx, user, authenticationMethod, models.GrantParams{
 			FactorID: &factor.ID,
 		})
 		if terr != nil {
@@ -320,6 +380,13 @@ func (a *API) UnenrollFactor(w http.ResponseWriter, r *http.Request) error {
 		}); terr != nil {
 			return terr
 		}
+		if terr = triggerActionHooks(ctx, tx, models.UnenrollFactorAction, user, map[string]interface{}{
+			"factor_id":   factor.ID,
+			"factor_type": factor.FactorType,
+			"actor":       "user",
+		}, a.config); terr != nil {
+			return terr
+		}
 		if terr = factor.DowngradeSessionsToAAL1(tx); terr != nil {
 			return terr
 		}
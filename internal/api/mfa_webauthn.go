@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/supabase/gotrue/internal/models"
+)
+
+const (
+	// WebAuthnCreate is the ceremony registering the credential of an
+	// unverified factor, with navigator.credentials.create.
+	WebAuthnCreate = "create"
+	// WebAuthnRequest is the ceremony asserting the credential of a
+	// verified factor, with navigator.credentials.get.
+	WebAuthnRequest = "request"
+)
+
+// WebAuthnChallenge holds the options of the ceremony of a challenge of a
+// webauthn factor, to pass to the browser as they are.
+type WebAuthnChallenge struct {
+	Type              string      `json:"type"`
+	CredentialOptions interface{} `json:"credential_options"`
+}
+
+type WebAuthnVerifyParams struct {
+	// CredentialResponse is the PublicKeyCredential returned by the
+	// browser, serialized to JSON with its buffers in base64url.
+	CredentialResponse json.RawMessage `json:"credential_response"`
+}
+
+// webAuthnUser presents the user and the credentials of its factors to
+// the webauthn ceremonies.
+type webAuthnUser struct {
+	*models.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return u.ID.Bytes()
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	if email := u.GetEmail(); email != "" {
+		return email
+	}
+	if phone := u.GetPhone(); phone != "" {
+		return phone
+	}
+	return u.ID.String()
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.WebAuthnName()
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// webAuthn returns the relying party of the webauthn ceremonies.
+func (a *API) webAuthn() (*webauthn.WebAuthn, error) {
+	config := a.config.MFA.WebAuthn
+
+	rpID, rpOrigin, rpDisplayName := config.RPID, config.RPOrigin, config.RPDisplayName
+	if rpID == "" || rpOrigin == "" {
+		siteURL, err := url.ParseRequestURI(a.config.SiteURL)
+		if err != nil {
+			return nil, internalServerError("site url is improperly formatted")
+		}
+		if rpID == "" {
+			rpID = siteURL.Hostname()
+		}
+		if rpOrigin == "" {
+			rpOrigin = protocol.FullyQualifiedOrigin(siteURL)
+		}
+	}
+	if rpDisplayName == "" {
+		rpDisplayName = rpID
+	}
+
+	relyingParty, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPOrigin:      rpOrigin,
+		RPDisplayName: rpDisplayName,
+	})
+	if err != nil {
+		return nil, internalServerError("WebAuthn is improperly configured").WithInternalError(err)
+	}
+	return relyingParty, nil
+}
+
+// beginWebAuthnCeremony starts the registration of the credential of an
+// unverified factor, or the assertion of the credential of a verified one.
+// The credentials of the other factors of the user can't be registered
+// again.
+func (a *API) beginWebAuthnCeremony(user *models.User, factor *models.Factor, factors []*models.Factor) (*WebAuthnChallenge, *webauthn.SessionData, error) {
+	relyingParty, err := a.webAuthn()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if factor.IsVerified() {
+		if factor.WebAuthnCredential == nil {
+			return nil, nil, internalServerError("WebAuthn factor has no credential")
+		}
+		options, sessionData, err := relyingParty.BeginLogin(&webAuthnUser{
+			User:        user,
+			credentials: []webauthn.Credential{factor.WebAuthnCredential.Credential()},
+		})
+		if err != nil {
+			return nil, nil, internalServerError("Error starting WebAuthn assertion").WithInternalError(err)
+		}
+		return &WebAuthnChallenge{Type: WebAuthnRequest, CredentialOptions: options}, sessionData, nil
+	}
+
+	var exclusions []protocol.CredentialDescriptor
+	for _, other := range factors {
+		if other.ID != factor.ID && other.WebAuthnCredential != nil {
+			exclusions = append(exclusions, other.WebAuthnCredential.Credential().Descriptor())
+		}
+	}
+	options, sessionData, err := relyingParty.BeginRegistration(&webAuthnUser{User: user}, webauthn.WithExclusions(exclusions))
+	if err != nil {
+		return nil, nil, internalServerError("Error starting WebAuthn registration").WithInternalError(err)
+	}
+	return &WebAuthnChallenge{Type: WebAuthnCreate, CredentialOptions: options}, sessionData, nil
+}
+
+// finishWebAuthnCeremony checks the response of the authenticator to the
+// ceremony of the challenge, and returns the registered credential or the
+// asserted one with its new sign count. A credential of the other factors
+// of the user can't be registered again.
+func (a *API) finishWebAuthnCeremony(user *models.User, factor *models.Factor, factors []*models.Factor, sessionData *models.WebAuthnSessionData, params *WebAuthnVerifyParams) (*models.WebAuthnCredential, error) {
+	if params == nil || len(params.CredentialResponse) == 0 {
+		return nil, badRequestError("webauthn.credential_response is required for WebAuthn factors")
+	}
+	if sessionData == nil || sessionData.SessionData == nil {
+		return nil, badRequestError("Challenge is not a WebAuthn challenge")
+	}
+
+	relyingParty, err := a.webAuthn()
+	if err != nil {
+		return nil, err
+	}
+
+	if factor.IsVerified() {
+		if factor.WebAuthnCredential == nil {
+			return nil, internalServerError("WebAuthn factor has no credential")
+		}
+		parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(params.CredentialResponse))
+		if err != nil {
+			return nil, badRequestError("Invalid WebAuthn assertion").WithInternalError(err)
+		}
+		credential, err := relyingParty.ValidateLogin(&webAuthnUser{
+			User:        user,
+			credentials: []webauthn.Credential{factor.WebAuthnCredential.Credential()},
+		}, *sessionData.SessionData, parsed)
+		if err != nil {
+			return nil, badRequestError("Invalid WebAuthn assertion").WithInternalError(err)
+		}
+		if credential.Authenticator.CloneWarning {
+			return nil, badRequestError("WebAuthn sign count did not increase, the authenticator may be cloned")
+		}
+		return models.NewWebAuthnCredential(credential), nil
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(params.CredentialResponse))
+	if err != nil {
+		return nil, badRequestError("Invalid WebAuthn registration").WithInternalError(err)
+	}
+	credential, err := relyingParty.CreateCredential(&webAuthnUser{User: user}, *sessionData.SessionData, parsed)
+	if err != nil {
+		return nil, badRequestError("Invalid WebAuthn registration").WithInternalError(err)
+	}
+	for _, other := range factors {
+		if other.ID != factor.ID && other.WebAuthnCredential != nil && bytes.Equal(other.WebAuthnCredential.ID, credential.ID) {
+			return nil, badRequestError("WebAuthn credential is already registered")
+		}
+	}
+	return models.NewWebAuthnCredential(credential), nil
+}
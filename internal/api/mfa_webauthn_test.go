@@ -0,0 +1,287 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/models"
+)
+
+// softAuthenticator is a software authenticator with a single P-256
+// credential, answering the ceremonies like a browser would.
+type softAuthenticator struct {
+	origin       string
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T, origin string) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	credentialID := make([]byte, 16)
+	_, err = rand.Read(credentialID)
+	require.NoError(t, err)
+	return &softAuthenticator{
+		origin:       origin,
+		key:          key,
+		credentialID: credentialID,
+	}
+}
+
+const (
+	authenticatorUserPresent  = 0x01
+	authenticatorUserVerified = 0x04
+	authenticatorAttestedData = 0x40
+)
+
+func (s *softAuthenticator) clientData(ceremony protocol.CeremonyType, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":      ceremony,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    s.origin,
+	})
+	return data
+}
+
+func (s *softAuthenticator) authenticatorData(rpID string, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, flags)
+	return binary.BigEndian.AppendUint32(data, s.signCount)
+}
+
+// create registers the credential, with the none attestation.
+func (s *softAuthenticator) create(t *testing.T, options *protocol.CredentialCreation) json.RawMessage {
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: s.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: s.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	require.NoError(t, err)
+
+	authData := s.authenticatorData(options.Response.RelyingParty.ID, authenticatorUserPresent|authenticatorUserVerified|authenticatorAttestedData)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(s.credentialID)))
+	authData = append(authData, s.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	require.NoError(t, err)
+
+	return s.credential(t, map[string]interface{}{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(s.clientData(protocol.CreateCeremony, options.Response.Challenge)),
+		"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+	})
+}
+
+// get asserts the credential, incrementing the sign count.
+func (s *softAuthenticator) get(t *testing.T, options *protocol.CredentialAssertion) json.RawMessage {
+	s.signCount++
+	authData := s.authenticatorData(options.Response.RelyingPartyID, authenticatorUserPresent|authenticatorUserVerified)
+	clientData := s.clientData(protocol.AssertCeremony, options.Response.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+	require.NoError(t, err)
+
+	return s.credential(t, map[string]interface{}{
+		"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+		"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+		"signature":         base64.RawURLEncoding.EncodeToString(signature),
+	})
+}
+
+func (s *softAuthenticator) credential(t *testing.T, response map[string]interface{}) json.RawMessage {
+	id := base64.RawURLEncoding.EncodeToString(s.credentialID)
+	data, err := json.Marshal(map[string]interface{}{
+		"id":       id,
+		"rawId":    id,
+		"type":     "public-key",
+		"response": response,
+	})
+	require.NoError(t, err)
+	return data
+}
+
+// storeSessionData passes the session data through its column.
+func storeSessionData(t *testing.T, sessionData *webauthn.SessionData) *models.WebAuthnSessionData {
+	value, err := models.WebAuthnSessionData{SessionData: sessionData}.Value()
+	require.NoError(t, err)
+	stored := &models.WebAuthnSessionData{}
+	require.NoError(t, stored.Scan(value))
+	return stored
+}
+
+func TestWebAuthnCeremonies(t *testing.T) {
+	a := &API{config: &conf.GlobalConfiguration{SiteURL: "https://example.com:8443/app"}}
+	user, err := models.NewUser("", "test@example.com", "password", "authenticated", nil)
+	require.NoError(t, err)
+	factor, err := models.NewFactor(user, "key", models.WebAuthn, models.FactorStateUnverified, "")
+	require.NoError(t, err)
+	authenticator := newSoftAuthenticator(t, "https://example.com:8443")
+
+	// registration
+	challenge, sessionData, err := a.beginWebAuthnCeremony(user, factor, nil)
+	require.NoError(t, err)
+	require.Equal(t, WebAuthnCreate, challenge.Type)
+	creation := challenge.CredentialOptions.(*protocol.CredentialCreation)
+	assert.Equal(t, "example.com", creation.Response.RelyingParty.ID)
+
+	response := authenticator.create(t, creation)
+	credential, err := a.finishWebAuthnCeremony(user, factor, nil, storeSessionData(t, sessionData), &WebAuthnVerifyParams{CredentialResponse: response})
+	require.NoError(t, err)
+	assert.Equal(t, authenticator.credentialID, credential.ID)
+	assert.Equal(t, uint32(0), credential.SignCount)
+
+	// the credential can't be registered by another factor
+	other, err := models.NewFactor(user, "other", models.WebAuthn, models.FactorStateUnverified, "")
+	require.NoError(t, err)
+	factor.WebAuthnCredential = credential
+	challenge, sessionData, err = a.beginWebAuthnCeremony(user, other, []*models.Factor{factor, other})
+	require.NoError(t, err)
+	creation = challenge.CredentialOptions.(*protocol.CredentialCreation)
+	require.Len(t, creation.Response.CredentialExcludeList, 1)
+	_, err = a.finishWebAuthnCeremony(user, other, []*models.Factor{factor, other}, storeSessionData(t, sessionData), &WebAuthnVerifyParams{
+		CredentialResponse: authenticator.create(t, creation),
+	})
+	require.Error(t, err)
+
+	// assertion
+	factor.Status = models.FactorStateVerified.String()
+	challenge, sessionData, err = a.beginWebAuthnCeremony(user, factor, nil)
+	require.NoError(t, err)
+	require.Equal(t, WebAuthnRequest, challenge.Type)
+	assertion := challenge.CredentialOptions.(*protocol.CredentialAssertion)
+	stored := storeSessionData(t, sessionData)
+
+	response = authenticator.get(t, assertion)
+	credential, err = a.finishWebAuthnCeremony(user, factor, nil, stored, &WebAuthnVerifyParams{CredentialResponse: response})
+	require.NoError(t, err)
+	assert.Equal(t, uint32(1), credential.SignCount)
+	factor.WebAuthnCredential = credential
+
+	// a replayed assertion doesn't increase the sign count
+	_, err = a.finishWebAuthnCeremony(user, factor, nil, stored, &WebAuthnVerifyParams{CredentialResponse: response})
+	require.Error(t, err)
+
+	// an assertion for another origin is rejected
+	phishing := *authenticator
+	phishing.origin = "https://example.org"
+	_, err = a.finishWebAuthnCeremony(user, factor, nil, stored, &WebAuthnVerifyParams{CredentialResponse: phishing.get(t, assertion)})
+	require.Error(t, err)
+
+	_, err = a.finishWebAuthnCeremony(user, factor, nil, stored, nil)
+	require.Error(t, err)
+}
+
+func (ts *MFATestSuite) TestWebAuthnEnrollChallengeAndVerify() {
+	signUpResp := signUp(ts, "webauthn@example.com", "password")
+	token := signUpResp.Token
+	authenticator := newSoftAuthenticator(ts.T(), "https://example.netlify.com")
+
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, &buffer)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		req.Header.Set("Content-Type", "application/json")
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+	challenge := func(factorID string) (string, json.RawMessage, string) {
+		w := post(fmt.Sprintf("/factors/%s/challenge", factorID), map[string]interface{}{})
+		require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+		var resp struct {
+			ID       string `json:"id"`
+			WebAuthn struct {
+				Type              string          `json:"type"`
+				CredentialOptions json.RawMessage `json:"credential_options"`
+			} `json:"webauthn"`
+		}
+		require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&resp))
+		return resp.ID, resp.WebAuthn.CredentialOptions, resp.WebAuthn.Type
+	}
+	verify := func(factorID, challengeID string, response json.RawMessage) *AccessTokenResponse {
+		w := post(fmt.Sprintf("/factors/%s/verify", factorID), map[string]interface{}{
+			"challenge_id": challengeID,
+			"webauthn":     map[string]interface{}{"credential_response": response},
+		})
+		require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+		data := &AccessTokenResponse{}
+		require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(data))
+		return data
+	}
+	requireWebAuthnAAL2 := func(accessToken string) {
+		claims := &GoTrueClaims{}
+		_, err := jwt.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
+			return []byte(ts.Config.JWT.Secret), nil
+		})
+		require.NoError(ts.T(), err)
+		require.Equal(ts.T(), models.AAL2.String(), claims.AuthenticatorAssuranceLevel)
+		methods := []string{}
+		for _, entry := range claims.AuthenticationMethodReference {
+			methods = append(methods, entry.Method)
+		}
+		require.Contains(ts.T(), methods, "webauthn")
+	}
+
+	w := post("/factors", map[string]interface{}{"friendly_name": "security key", "factor_type": models.WebAuthn})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	enrollResp := EnrollFactorResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&enrollResp))
+	require.Equal(ts.T(), models.WebAuthn, enrollResp.Type)
+	require.Nil(ts.T(), enrollResp.TOTP)
+	factorID := enrollResp.ID.String()
+
+	// registration
+	challengeID, options, ceremony := challenge(factorID)
+	require.Equal(ts.T(), WebAuthnCreate, ceremony)
+	creation := &protocol.CredentialCreation{}
+	require.NoError(ts.T(), json.Unmarshal(options, creation))
+	verifyResp := verify(factorID, challengeID, authenticator.create(ts.T(), creation))
+	requireWebAuthnAAL2(verifyResp.Token)
+	token = verifyResp.Token
+
+	factor, err := models.FindFactorByFactorID(ts.API.db, enrollResp.ID)
+	require.NoError(ts.T(), err)
+	require.True(ts.T(), factor.IsVerified())
+	require.NotNil(ts.T(), factor.WebAuthnCredential)
+	require.Equal(ts.T(), authenticator.credentialID, factor.WebAuthnCredential.ID)
+
+	// assertion
+	challengeID, options, ceremony = challenge(factorID)
+	require.Equal(ts.T(), WebAuthnRequest, ceremony)
+	assertion := &protocol.CredentialAssertion{}
+	require.NoError(ts.T(), json.Unmarshal(options, assertion))
+	verifyResp = verify(factorID, challengeID, authenticator.get(ts.T(), assertion))
+	requireWebAuthnAAL2(verifyResp.Token)
+
+	factor, err = models.FindFactorByFactorID(ts.API.db, enrollResp.ID)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), uint32(1), factor.WebAuthnCredential.SignCount)
+}
@@ -7,7 +7,6 @@ import (
 	"io"
 	"net/http"
 
-	"github.com/sethvargo/go-password/password"
 	"github.com/supabase/gotrue/internal/api/sms_provider"
 	"github.com/supabase/gotrue/internal/models"
 	"github.com/supabase/gotrue/internal/storage"
@@ -159,9 +158,9 @@ func (a *API) SmsOtp(w http.ResponseWriter, r *http.Request) error {
 	if isNewUser {
 		// User either doesn't exist or hasn't completed the signup process.
 		// Sign them up with temporary password.
-		password, err := password.Generate(30, 10, 1, false, true)
+		password, err := utilities.GeneratePassword(&config.PasswordPolicy)
 		if err != nil {
-			internalServerError("error creating user").WithInternalError(err)
+			return internalServerError("error creating user").WithInternalError(err)
 		}
 
 		fmt.Println("password", password)
@@ -128,7 +128,7 @@ func (ts *PhoneTestSuite) TestMissingSmsProviderConfig() {
 	require.NoError(ts.T(), ts.API.db.Update(u), "Error updating new test user")
 
 	var token string
-	token, err = generateAccessToken(ts.API.db, u, nil, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret, false)
+	token, err = ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
 	require.NoError(ts.T(), err)
 
 	cases := []struct {
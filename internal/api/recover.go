@@ -66,6 +66,9 @@ func (a *API) Recover(w http.ResponseWriter, r *http.Request) error {
 		if terr := models.NewAuditLogEntry(r, tx, user, models.UserRecoveryRequestedAction, "", nil); terr != nil {
 			return terr
 		}
+		if terr := triggerActionHooks(ctx, tx, models.UserRecoveryRequestedAction, user, nil, config); terr != nil {
+			return terr
+		}
 		mailer := a.Mailer(ctx)
 		referrer := a.getReferrer(r)
 		if isPKCEFlow(flowType) {
@@ -250,6 +250,7 @@ func (a *API) SAMLACS(w http.ResponseWriter, r *http.Request) error {
 	notAfter := assertion.NotAfter()
 
 	var grantParams models.GrantParams
+	grantParams.FillGrantParams(r)
 
 	if !notAfter.IsZero() {
 		grantParams.SessionNotAfter = &notAfter
@@ -271,9 +272,12 @@ func (a *API) SAMLACS(w http.ResponseWriter, r *http.Request) error {
 			return terr
 		}
 
-		token, terr = a.issueRefreshToken(ctx, tx, user, models.SSOSAML, grantParams)
+		token, terr = a.issueRefreshToken(r, tx, user, models.SSOSAML, grantParams)
 
 		if terr != nil {
+			if _, ok := terr.(*OAuthError); ok {
+				return terr
+			}
 			return internalServerError("Unable to issue refresh token from SAML Assertion").WithInternalError(terr)
 		}
 
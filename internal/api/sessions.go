@@ -0,0 +1,188 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/observability"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// SessionResponse is a session of the user as listed in GET /user/sessions.
+type SessionResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	DeviceLabel string     `json:"device_label,omitempty"`
+	UserAgent   string     `json:"user_agent,omitempty"`
+	IP          string     `json:"ip,omitempty"`
+	AAL         string     `json:"aal,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RefreshedAt *time.Time `json:"refreshed_at,omitempty"`
+	NotAfter    *time.Time `json:"not_after,omitempty"`
+	// Current is set on the session of the access token making the request.
+	Current bool `json:"current"`
+}
+
+// UserSessionsResponse lists the sessions of a user.
+type UserSessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+// UserListSessions lists the sessions of the user, most recently used first.
+func (a *API) UserListSessions(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+	user := getUser(ctx)
+	current := getSession(ctx)
+
+	sessions, err := models.FindSessionsByUserID(db, user.ID)
+	if err != nil {
+		return internalServerError("Database error finding sessions").WithInternalError(err)
+	}
+
+	response := UserSessionsResponse{Sessions: make([]SessionResponse, 0, len(sessions))}
+	for _, session := range sessions {
+		response.Sessions = append(response.Sessions, SessionResponse{
+			ID:          session.ID,
+			DeviceLabel: string(session.DeviceLabel),
+			UserAgent:   string(session.UserAgent),
+			IP:          string(session.IP),
+			AAL:         session.GetAAL(),
+			CreatedAt:   session.CreatedAt,
+			RefreshedAt: session.RefreshedAt,
+			NotAfter:    session.NotAfter,
+			Current:     current != nil && current.ID == session.ID,
+		})
+	}
+
+	return sendJSON(w, http.StatusOK, response)
+}
+
+// UserRevokeSession signs the user out of one of their sessions.
+func (a *API) UserRevokeSession(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+	user := getUser(ctx)
+
+	sessionID, err := uuid.FromString(chi.URLParam(r, "session_id"))
+	if err != nil {
+		return badRequestError("session_id must be an UUID")
+	}
+
+	observability.LogEntrySetField(r, "session_id", sessionID)
+
+	session, err := models.FindSessionByID(db, sessionID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return notFoundError("Session not found")
+		}
+		return internalServerError("Database error finding session").WithInternalError(err)
+	}
+	// sessions of other users are reported as missing
+	if session.UserID != user.ID {
+		return notFoundError("Session not found")
+	}
+
+	err = db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, user, models.SessionRevokedAction, "", map[string]interface{}{
+			"session_id": session.ID,
+		}); terr != nil {
+			return terr
+		}
+		if terr := triggerActionHooks(ctx, tx, models.SessionRevokedAction, user, map[string]interface{}{
+			"session_ids": []uuid.UUID{session.ID},
+		}, a.config); terr != nil {
+			return terr
+		}
+		return models.LogoutSession(tx, session.ID)
+	})
+	if err != nil {
+		return internalServerError("Error revoking session").WithInternalError(err)
+	}
+
+	if current := getSession(ctx); current != nil && current.ID == session.ID {
+		a.clearCookieTokens(a.config, w)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// UserRevokeOtherSessions signs the user out of all their sessions except
+// the one making the request.
+func (a *API) UserRevokeOtherSessions(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+	user := getUser(ctx)
+
+	session := getSession(ctx)
+	if session == nil {
+		return badRequestError("Signing out other devices requires an access token with a session")
+	}
+
+	err := db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, user, models.OtherSessionsRevokedAction, "", map[string]interface{}{
+			"session_id": session.ID,
+		}); terr != nil {
+			return terr
+		}
+		sessions, terr := models.FindSessionsByUserID(tx, user.ID)
+		if terr != nil {
+			return terr
+		}
+		revoked := make([]uuid.UUID, 0, len(sessions))
+		for _, s := range sessions {
+			if s.ID != session.ID {
+				revoked = append(revoked, s.ID)
+			}
+		}
+		if terr := triggerActionHooks(ctx, tx, models.OtherSessionsRevokedAction, user, map[string]interface{}{
+			"session_ids": revoked,
+		}, a.config); terr != nil {
+			return terr
+		}
+		return models.LogoutAllExceptMe(tx, session.ID, user.ID)
+	})
+	if err != nil {
+		return internalServerError("Error revoking sessions").WithInternalError(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// sessionRole returns the role of the access tokens refreshing the sessions
+// of the user, which selects the session limits.
+func (a *API) sessionRole(user *models.User) string {
+	if staffType := string(user.StaffType); staffType != "" && a.config.Staff.IsStaffType(staffType) {
+		return a.config.Staff.Roles[staffType]
+	}
+	return user.Role
+}
+
+// isSessionExpired checks the session against the limits of the role of the
+// user.
+func (a *API) isSessionExpired(user *models.User, session *models.Session, now time.Time) bool {
+	timebox, inactivityTimeout := a.config.Sessions.Limits(a.sessionRole(user))
+	return session.IsExpired(now, timebox, inactivityTimeout)
+}
+
+// deleteExpiredSessions garbage-collects the expired sessions of the user,
+// their refresh tokens are deleted with them.
+func (a *API) deleteExpiredSessions(tx *storage.Connection, user *models.User) error {
+	sessions, err := models.FindSessionsByUserID(tx, user.ID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, session := range sessions {
+		if a.isSessionExpired(user, session, now) {
+			if err := models.LogoutSession(tx, session.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
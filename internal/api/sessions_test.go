@@ -0,0 +1,145 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/models"
+)
+
+type SessionsTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.GlobalConfiguration
+
+	user    *models.User
+	current *models.RefreshToken
+	other   *models.RefreshToken
+	strange *models.RefreshToken
+	token   string
+}
+
+func TestSessions(t *testing.T) {
+	api, config, err := setupAPIForTest()
+	require.NoError(t, err)
+
+	ts := &SessionsTestSuite{
+		API:    api,
+		Config: config,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *SessionsTestSuite) SetupTest() {
+	models.TruncateAll(ts.API.db)
+
+	u, err := models.NewUser("", "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error creating test user model")
+	require.NoError(ts.T(), ts.API.db.Create(u), "Error saving new test user")
+	ts.user = u
+
+	ts.current, err = models.GrantAuthenticatedUser(ts.API.db, u, models.GrantParams{
+		UserAgent:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Safari/537.36",
+		IP:          "127.0.0.1",
+		DeviceLabel: "Chrome on Windows",
+	})
+	require.NoError(ts.T(), err)
+	ts.other, err = models.GrantAuthenticatedUser(ts.API.db, u, models.GrantParams{
+		UserAgent:   "okhttp/4.9.2",
+		IP:          "127.0.0.2",
+		DeviceLabel: "Android app",
+	})
+	require.NoError(ts.T(), err)
+
+	stranger, err := models.NewUser("", "stranger@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error creating test user model")
+	require.NoError(ts.T(), ts.API.db.Create(stranger), "Error saving new test user")
+	ts.strange, err = models.GrantAuthenticatedUser(ts.API.db, stranger, models.GrantParams{})
+	require.NoError(ts.T(), err)
+
+	ts.token, err = ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, ts.current.SessionId, models.PasswordGrant)
+	require.NoError(ts.T(), err)
+}
+
+func (ts *SessionsTestSuite) request(method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "http://localhost"+path, nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.token))
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *SessionsTestSuite) TestListSessions() {
+	w := ts.request(http.MethodGet, "/user/sessions")
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	data := UserSessionsResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	require.Len(ts.T(), data.Sessions, 2)
+
+	labels := map[string]bool{}
+	for _, session := range data.Sessions {
+		labels[session.DeviceLabel] = session.Current
+		if session.Current {
+			require.Equal(ts.T(), *ts.current.SessionId, session.ID)
+			require.Equal(ts.T(), "127.0.0.1", session.IP)
+		}
+	}
+	require.Equal(ts.T(), map[string]bool{"Chrome on Windows": true, "Android app": false}, labels)
+}
+
+func (ts *SessionsTestSuite) TestRevokeSession() {
+	w := ts.request(http.MethodDelete, "/user/sessions/"+ts.other.SessionId.String())
+	require.Equal(ts.T(), http.StatusNoContent, w.Code)
+
+	_, err := models.FindSessionByID(ts.API.db, *ts.other.SessionId)
+	require.True(ts.T(), models.IsNotFoundError(err))
+	_, err = models.FindSessionByID(ts.API.db, *ts.current.SessionId)
+	require.NoError(ts.T(), err)
+
+	// sessions of other users can't be revoked
+	w = ts.request(http.MethodDelete, "/user/sessions/"+ts.strange.SessionId.String())
+	require.Equal(ts.T(), http.StatusNotFound, w.Code)
+	_, err = models.FindSessionByID(ts.API.db, *ts.strange.SessionId)
+	require.NoError(ts.T(), err)
+
+	w = ts.request(http.MethodDelete, "/user/sessions/not-a-uuid")
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *SessionsTestSuite) TestRevokeOtherSessions() {
+	w := ts.request(http.MethodDelete, "/user/sessions")
+	require.Equal(ts.T(), http.StatusNoContent, w.Code)
+
+	sessions, err := models.FindSessionsByUserID(ts.API.db, ts.user.ID)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), sessions, 1)
+	require.Equal(ts.T(), *ts.current.SessionId, sessions[0].ID)
+
+	_, err = models.FindSessionByID(ts.API.db, *ts.strange.SessionId)
+	require.NoError(ts.T(), err)
+}
+
+func (ts *SessionsTestSuite) TestRefreshRecordsDevice() {
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", nil)
+	req.Header.Set("User-Agent", "okhttp/4.10.0")
+	req.Header.Set("X-Forwarded-For", "127.0.0.3")
+
+	_, err := models.GrantRefreshTokenSwap(req, ts.API.db, ts.user, ts.other)
+	require.NoError(ts.T(), err)
+
+	session, err := models.FindSessionByID(ts.API.db, *ts.other.SessionId)
+	require.NoError(ts.T(), err)
+	require.NotNil(ts.T(), session.RefreshedAt)
+	require.Equal(ts.T(), "okhttp/4.10.0", string(session.UserAgent))
+	require.Equal(ts.T(), "127.0.0.3", string(session.IP))
+	require.Equal(ts.T(), "Android app", string(session.DeviceLabel))
+}
@@ -1,6 +1,11 @@
 package api
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/supabase/gotrue/internal/models"
+)
 
 type ProviderSettings struct {
 	Apple     bool `json:"apple"`
@@ -33,11 +38,20 @@ type Settings struct {
 	SmsProvider       string           `json:"sms_provider"`
 	MFAEnabled        bool             `json:"mfa_enabled"`
 	SAMLEnabled       bool             `json:"saml_enabled"`
+
+	// PasswordRotationRequired is only reported to requests with the
+	// access token of a user whose password has expired.
+	PasswordRotationRequired bool `json:"password_rotation_required,omitempty"`
 }
 
 func (a *API) Settings(w http.ResponseWriter, r *http.Request) error {
 	config := a.config
 
+	passwordRotationRequired, err := a.isPasswordRotationRequired(r)
+	if err != nil {
+		return err
+	}
+
 	return sendJSON(w, http.StatusOK, &Settings{
 		ExternalProviders: ProviderSettings{
 			Apple:     config.External.Apple.Enabled,
@@ -68,5 +82,40 @@ func (a *API) Settings(w http.ResponseWriter, r *http.Request) error {
 		SmsProvider:       config.Sms.Provider,
 		MFAEnabled:        config.MFA.Enabled,
 		SAMLEnabled:       config.SAML.Enabled,
+
+		PasswordRotationRequired: passwordRotationRequired,
 	})
 }
+
+// isPasswordRotationRequired checks the password of the user of the optional
+// access token, either it was already expired when they signed in or it
+// expired since.
+func (a *API) isPasswordRotationRequired(r *http.Request) (bool, error) {
+	bearer, err := a.extractBearerToken(r)
+	if err != nil {
+		return false, nil
+	}
+	ctx, err := a.parseJWTClaims(bearer, r)
+	if err != nil {
+		return false, nil
+	}
+
+	claims := getClaims(ctx)
+	if claims.PasswordExpired {
+		return true, nil
+	}
+
+	userID, err := uuid.FromString(claims.Subject)
+	if err != nil {
+		return false, nil
+	}
+	user, err := models.FindUserByID(a.db.WithContext(ctx), userID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return false, nil
+		}
+		return false, internalServerError("Database error finding user").WithInternalError(err)
+	}
+
+	return user.IsPasswordExpired(a.config.Security.PasswordExpiry.MaxAgeFor(user.Role, user.AppMetaData)), nil
+}
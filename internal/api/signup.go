@@ -12,6 +12,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/supabase/gotrue/internal/api/provider"
 	"github.com/supabase/gotrue/internal/api/sms_provider"
+	"github.com/supabase/gotrue/internal/conf"
 	"github.com/supabase/gotrue/internal/metering"
 	"github.com/supabase/gotrue/internal/models"
 	"github.com/supabase/gotrue/internal/storage"
@@ -31,15 +32,12 @@ type SignupParams struct {
 	CodeChallenge       string                 `json:"code_challenge"`
 }
 
-func (p *SignupParams) Validate(passwordMinLength int, smsProvider string) error {
+func (p *SignupParams) Validate(passwordPolicy *conf.PasswordPolicyConfiguration, smsProvider string) error {
 	if p.Password == "" {
 		return unprocessableEntityError("Signup requires a valid password")
 	}
-	if len(p.Password) < passwordMinLength {
-		return invalidPasswordLengthError(passwordMinLength)
-	}
-	if err := utilities.ValidatePassword(p.Password); err != "" {
-		return unprocessableEntityError(err)
+	if violations := utilities.ValidatePassword(passwordPolicy, p.Password, p.Email); len(violations) > 0 {
+		return weakPasswordError(passwordPolicy, violations)
 	}
 	if p.Email != "" && p.Phone != "" {
 		return unprocessableEntityError("Only an email address or phone number should be provided on signup.")
@@ -96,7 +94,10 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 		return badRequestError("Could not read Signup params: %v", err)
 	}
 	params.ConfigureDefaults()
-	if err := params.Validate(config.PasswordMinLength, config.Sms.Provider); err != nil {
+	if err := params.Validate(&config.PasswordPolicy, config.Sms.Provider); err != nil {
+		return err
+	}
+	if err := a.checkBreachedPassword(ctx, params.Password); err != nil {
 		return err
 	}
 
@@ -115,6 +116,7 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 
 	var user *models.User
 	var grantParams models.GrantParams
+	grantParams.FillGrantParams(r)
 	params.Aud = a.requestAud(ctx, r)
 
 	switch params.Provider {
@@ -276,7 +278,7 @@ func (a *API) Signup(w http.ResponseWriter, r *http.Request) error {
 			if terr = triggerEventHooks(ctx, tx, LoginEvent, user, config); terr != nil {
 				return terr
 			}
-			token, terr = a.issueRefreshToken(ctx, tx, user, models.PasswordGrant, grantParams)
+			token, terr = a.issueRefreshToken(r, tx, user, models.PasswordGrant, grantParams)
 
 			if terr != nil {
 				return terr
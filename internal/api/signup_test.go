@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -17,6 +19,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/crypto"
 	"github.com/supabase/gotrue/internal/models"
 )
 
@@ -257,3 +260,32 @@ func (ts *SignupTestSuite) TestVerifySignup() {
 	require.NotEmpty(ts.T(), v.Get("expires_in"))
 	require.NotEmpty(ts.T(), v.Get("refresh_token"))
 }
+
+func (ts *SignupTestSuite) TestSignupBreachedPassword() {
+	// SHA-1 of "P@ssw0rd"
+	corpus := filepath.Join(ts.T().TempDir(), "pwned-passwords.txt")
+	require.NoError(ts.T(), os.WriteFile(corpus, []byte("21BD12DC183F740EE76F27B78EB39C8AD972A757:3\n"), 0600))
+
+	ts.API.breachedPasswords = crypto.NewBreachedPasswordCorpus(corpus, 0)
+	defer func() {
+		ts.API.breachedPasswords = nil
+	}()
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    "test@example.com",
+		"password": "P@ssw0rd",
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/signup", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	data := &HTTPError{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(data))
+	require.Equal(ts.T(), WeakPasswordErrorCode, data.ErrorCode)
+	require.Equal(ts.T(), []string{"password_breached"}, data.Reasons)
+}
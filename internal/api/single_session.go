@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gofrs/uuid"
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// SingleSessionErrorCode is the OAuth error of logins rejected because the
+// user is already signed in on another device.
+const SingleSessionErrorCode = "single_session"
+
+const SingleSessionMessage = "Already signed in on another device, sign out there first"
+
+// enforceSingleSession applies the single session policy before a new
+// session is created for the user, and returns the devices of the sessions
+// it revoked. Recovering the account always revokes the other sessions, so
+// users who lost the device of their session can get back in.
+func (a *API) enforceSingleSession(r *http.Request, tx *storage.Connection, user *models.User, recovery bool) ([]string, error) {
+	config := a.config.Security.SingleSession
+	backoffice := isBackofficeUser(a.config, user)
+	if !config.Applies(user.Role, backoffice) && !config.Applies(a.sessionRole(user), backoffice) {
+		return nil, nil
+	}
+
+	sessions, err := models.FindSessionsByUserID(tx, user.ID)
+	if err != nil {
+		return nil, internalServerError("Database error finding sessions").WithInternalError(err)
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+
+	sessionIDs := make([]uuid.UUID, 0, len(sessions))
+	devices := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		sessionIDs = append(sessionIDs, session.ID)
+		device := string(session.DeviceLabel)
+		if device == "" {
+			device = string(session.UserAgent)
+		}
+		if device != "" {
+			devices = append(devices, device)
+		}
+	}
+	policy := config.Policy
+	if recovery {
+		policy = conf.SingleSessionRevoke
+	}
+	traits := map[string]interface{}{
+		"policy":      policy,
+		"session_ids": sessionIDs,
+	}
+
+	if policy == conf.SingleSessionReject {
+		// the login's transaction is rolled back, so the audit entry is
+		// recorded outside of it
+		if err := models.NewAuditLogEntry(r, a.db, user, models.SingleSessionEnforcedAction, "", traits); err != nil {
+			return nil, internalServerError("Database error recording rejected login").WithInternalError(err)
+		}
+		return nil, oauthError(SingleSessionErrorCode, SingleSessionMessage)
+	}
+
+	if err := models.NewAuditLogEntry(r, tx, user, models.SingleSessionEnforcedAction, "", traits); err != nil {
+		return nil, err
+	}
+	if err := models.Logout(tx, user.ID); err != nil {
+		return nil, internalServerError("Database error revoking sessions").WithInternalError(err)
+	}
+	return devices, nil
+}
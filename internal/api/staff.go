@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// validateStaffType rejects staff types missing from the configuration, an
+// empty staff type revokes the current one.
+func (a *API) validateStaffType(staffType *string) error {
+	if staffType == nil || *staffType == "" {
+		return nil
+	}
+	if !a.config.Staff.IsStaffType(*staffType) {
+		return unprocessableEntityError("Unknown staff type %q", *staffType)
+	}
+	return nil
+}
+
+// setStaffType grants or revokes the staff type of the user on behalf of the
+// admin, recording the change in the audit log.
+func (a *API) setStaffType(r *http.Request, tx *storage.Connection, adminUser, user *models.User, staffType string) error {
+	previous := string(user.StaffType)
+	if previous == staffType {
+		return nil
+	}
+
+	if err := user.SetStaffType(tx, staffType); err != nil {
+		return err
+	}
+
+	action := models.StaffGrantedAction
+	if staffType == "" {
+		action = models.StaffRevokedAction
+	}
+	return models.NewAuditLogEntry(r, tx, adminUser, action, "", map[string]interface{}{
+		"user_id":             user.ID,
+		"user_email":          user.Email,
+		"staff_type":          staffType,
+		"previous_staff_type": previous,
+	})
+}
@@ -20,7 +20,6 @@ import (
 	"github.com/supabase/gotrue/internal/models"
 	"github.com/supabase/gotrue/internal/observability"
 	"github.com/supabase/gotrue/internal/storage"
-	"github.com/supabase/gotrue/internal/utilities"
 )
 
 // GoTrueClaims is a struct thats used for JWT claims
@@ -34,6 +33,8 @@ type GoTrueClaims struct {
 	AuthenticatorAssuranceLevel   string                 `json:"aal,omitempty"`
 	AuthenticationMethodReference []models.AMREntry      `json:"amr,omitempty"`
 	SessionId                     string                 `json:"session_id,omitempty"`
+	PasswordExpired               bool                   `json:"password_expired,omitempty"`
+	IsBackoffice                  bool                   `json:"is_backoffice"`
 }
 
 // AccessTokenResponse represents an OAuth2 success response
@@ -46,6 +47,8 @@ type AccessTokenResponse struct {
 	ProviderAccessToken  string       `json:"provider_token,omitempty"`
 	ProviderRefreshToken string       `json:"provider_refresh_token,omitempty"`
 	IsBackoffice         bool         `json:"is_backoffice"`
+	PasswordBreached     bool         `json:"password_breached,omitempty"`
+	PasswordExpired      bool         `json:"password_expired,omitempty"`
 }
 
 // AsRedirectURL encodes the AccessTokenResponse as a redirect URL that
@@ -210,14 +213,9 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 		return unprocessableEntityError("Only an email address or phone number should be provided on login.")
 	}
 
-	if len(params.Password) > 30 {
-		return unprocessableEntityError("Maximum Password length cannot moret than 30 characters")
-	}
-
 	var user *models.User
-	var legacyCredential *models.LegacyCredential
-	var errLegacy error
 	var grantParams models.GrantParams
+	grantParams.FillGrantParams(r)
 	var provider string
 	if params.Email != "" {
 		provider = "email"
@@ -225,7 +223,6 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 			return badRequestError("Email logins are disabled")
 		}
 		user, err = models.FindUserByEmailAndAudience(db, params.Email, aud)
-		legacyCredential, errLegacy = models.FindUserByEmailFromLegacy(db, params.Email)
 	} else if params.Phone != "" {
 		provider = "phone"
 		if !config.External.Phone.Enabled {
@@ -244,13 +241,39 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 		return internalServerError("Database error querying schema").WithInternalError(err)
 	}
 
-	if user.IsBanned() || (!user.Authenticate(params.Password)) {
-		if errLegacy != nil && models.IsNotFoundError(errLegacy) {
-			return oauthError("invalid_grant", InvalidLoginMessage)
+	// locked accounts don't get their password checked at all, so the lock
+	// can't be used to guess it. They get the same error as unknown users so
+	// the lock doesn't tell which accounts exist, the user is told by email.
+	if user.IsLocked() {
+		return oauthError("invalid_grant", InvalidLoginMessage)
+	}
+
+	if user.IsBanned() {
+		return oauthError("invalid_grant", InvalidLoginMessage)
+	}
+
+	// authenticatedWithLegacy is set when the password only matched the
+	// legacy credential, in which case it gets migrated into the user below.
+	// Legacy credentials are only checked for users whose password was never
+	// set in GoTrue, setting it retires them.
+	authenticatedWithLegacy := false
+	var legacyCredential *models.LegacyCredential
+	if !user.Authenticate(params.Password) {
+		if user.EncryptedPassword != "" {
+			return a.recordFailedLogin(r, db, user, provider)
+		}
+		if params.Email != "" {
+			legacyCredential, err = models.FindUserByEmailFromLegacy(db, params.Email)
+		} else {
+			legacyCredential, err = models.FindUserByPhoneFromLegacy(db, params.Phone)
+		}
+		if err != nil && !models.IsNotFoundError(err) {
+			return internalServerError("Database error querying schema").WithInternalError(err)
 		}
 		if !legacyCredential.Authenticate(params.Password) {
-			return oauthError("invalid_grant", InvalidLoginMessage)
+			return a.recordFailedLogin(r, db, user, provider)
 		}
+		authenticatedWithLegacy = true
 	}
 
 	if params.Email != "" && !user.IsConfirmed() {
@@ -259,22 +282,62 @@ func (a *API) ResourceOwnerPasswordGrant(ctx context.Context, w http.ResponseWri
 		return oauthError("invalid_grant", "Phone not confirmed")
 	}
 
+	// expired passwords can only be used to change the password, migrated
+	// legacy credentials were just set so they can't be expired
+	if !authenticatedWithLegacy {
+		grantParams.PasswordExpired = user.IsPasswordExpired(config.Security.PasswordExpiry.MaxAgeFor(user.Role, user.AppMetaData))
+	}
+
+	// breached passwords are only flagged on login, so the application can
+	// ask for a new password, failing to check them doesn't block the login
+	passwordBreached := false
+	if config.Security.BreachedPasswords.FlagOnLogin {
+		if passwordBreached, err = a.isBreachedPassword(ctx, params.Password); err != nil {
+			observability.GetLogEntry(r).WithError(err).Warn("unable to check for breached password")
+		}
+	}
+
 	var token *AccessTokenResponse
 	err = db.Transaction(func(tx *storage.Connection) error {
 		var terr error
+		if user.FailedLoginAttempts > 0 || user.LockoutCount > 0 {
+			if terr = user.Unlock(tx); terr != nil {
+				return terr
+			}
+		}
+		if authenticatedWithLegacy {
+			if terr = legacyCredential.MigrateTo(tx, user, params.Password); terr != nil {
+				return internalServerError("Error migrating legacy credential").WithInternalError(terr)
+			}
+			if terr = models.NewAuditLogEntry(r, tx, user, models.LegacyCredentialMigratedAction, "", map[string]interface{}{
+				"provider":             provider,
+				"legacy_credential_id": legacyCredential.ID,
+			}); terr != nil {
+				return terr
+			}
+		}
 		if terr = models.NewAuditLogEntry(r, tx, user, models.LoginAction, "", map[string]interface{}{
 			"provider": provider,
 		}); terr != nil {
 			return terr
 		}
+		if passwordBreached {
+			if terr = models.NewAuditLogEntry(r, tx, user, models.BreachedPasswordLoginAction, "", map[string]interface{}{
+				"provider": provider,
+			}); terr != nil {
+				return terr
+			}
+		}
 		if terr = triggerEventHooks(ctx, tx, LoginEvent, user, config); terr != nil {
 			return terr
 		}
-		token, terr = a.issueRefreshToken(ctx, tx, user, models.PasswordGrant, grantParams)
+		token, terr = a.issueRefreshToken(r, tx, user, models.PasswordGrant, grantParams)
 
 		if terr != nil {
 			return terr
 		}
+		token.PasswordBreached = passwordBreached
+		token.PasswordExpired = grantParams.PasswordExpired
 
 		if terr = a.setCookieTokens(config, token, false, w); terr != nil {
 			return internalServerError("Failed to set JWT cookie. %s", terr)
@@ -320,16 +383,14 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 		return oauthError("invalid_grant", "Invalid Refresh Token: User Banned")
 	}
 
-	if session != nil {
-		var notAfter time.Time
-
-		if session.NotAfter != nil {
-			notAfter = *session.NotAfter
-		}
-
-		if !notAfter.IsZero() && time.Now().UTC().After(notAfter) {
-			return oauthError("invalid_grant", "Invalid Refresh Token: Session Expired")
+	if session != nil && a.isSessionExpired(user, session, time.Now()) {
+		a.clearCookieTokens(config, w)
+		// the session can't be refreshed anymore, its refresh tokens are
+		// deleted with it
+		if err := models.LogoutSession(db, session.ID); err != nil {
+			return internalServerError("Error deleting expired session").WithInternalError(err)
 		}
+		return oauthError("session_expired", "Invalid Refresh Token: Session Expired")
 	}
 
 	if token.Revoked {
@@ -342,18 +403,8 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 		if time.Now().After(reuseUntil) {
 			// not OK to reuse this token
 
-			if config.Security.RefreshTokenRotationEnabled {
-				// Revoke all tokens in token family
-				err = db.Transaction(func(tx *storage.Connection) error {
-					var terr error
-					if terr = models.RevokeTokenFamily(tx, token); terr != nil {
-						return terr
-					}
-					return nil
-				})
-				if err != nil {
-					return internalServerError(err.Error())
-				}
+			if err := a.reportTokenReuse(r, db, user, token); err != nil {
+				return internalServerError(err.Error())
 			}
 
 			return oauthError("invalid_grant", "Invalid Refresh Token: Already Used").WithInternalMessage("Possible abuse attempt: %v", token.ID)
@@ -377,7 +428,7 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 			return terr
 		}
 
-		tokenString, terr = generateAccessToken(tx, user, newToken.SessionId, time.Second*time.Duration(config.JWT.Exp), config.JWT.Secret, true)
+		tokenString, terr = a.generateAccessToken(r, tx, user, newToken.SessionId, models.TokenRefresh)
 
 		if terr != nil {
 			return internalServerError("error generating jwt token").WithInternalError(terr)
@@ -389,6 +440,7 @@ func (a *API) RefreshTokenGrant(ctx context.Context, w http.ResponseWriter, r *h
 			ExpiresIn:    config.JWT.Exp,
 			RefreshToken: newToken.Token,
 			User:         user,
+			IsBackoffice: isBackofficeUser(config, user),
 		}
 		if terr = a.setCookieTokens(config, newTokenResponse, false, w); terr != nil {
 			return internalServerError("Failed to set JWT cookie. %s", terr)
@@ -488,6 +540,7 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 
 	var user *models.User
 	var grantParams models.GrantParams
+	grantParams.FillGrantParams(r)
 	var token *AccessTokenResponse
 	err = db.Transaction(func(tx *storage.Connection) error {
 		var terr error
@@ -575,9 +628,12 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 				return terr
 			}
 		}
-		token, terr = a.issueRefreshToken(ctx, tx, user, models.OAuth, grantParams)
+		token, terr = a.issueRefreshToken(r, tx, user, models.OAuth, grantParams)
 
 		if terr != nil {
+			if _, ok := terr.(*OAuthError); ok {
+				return terr
+			}
 			return oauthError("server_error", terr.Error())
 		}
 		return nil
@@ -598,6 +654,7 @@ func (a *API) IdTokenGrant(ctx context.Context, w http.ResponseWriter, r *http.R
 func (a *API) PKCE(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	db := a.db.WithContext(ctx)
 	var grantParams models.GrantParams
+	grantParams.FillGrantParams(r)
 
 	params := &PKCEGrantParams{}
 	body, err := getBodyBytes(r)
@@ -639,8 +696,12 @@ func (a *API) PKCE(ctx context.Context, w http.ResponseWriter, r *http.Request)
 		if err != nil {
 			return err
 		}
-		token, terr = a.issueRefreshToken(ctx, tx, user, authMethod, grantParams)
+		grantParams.Recovery = authMethod == models.Recovery
+		token, terr = a.issueRefreshToken(r, tx, user, authMethod, grantParams)
 		if terr != nil {
+			if _, ok := terr.(*OAuthError); ok {
+				return terr
+			}
 			return oauthError("server_error", terr.Error())
 		}
 		token.ProviderAccessToken = flowState.ProviderAccessToken
@@ -662,15 +723,22 @@ func (a *API) PKCE(ctx context.Context, w http.ResponseWriter, r *http.Request)
 
 }
 
-func generateAccessToken(tx *storage.Connection, user *models.User, sessionId *uuid.UUID, expiresIn time.Duration, secret string, isRefreshToken bool) (string, error) {
+func (a *API) generateAccessToken(r *http.Request, tx *storage.Connection, user *models.User, sessionId *uuid.UUID, authenticationMethod models.AuthenticationMethod) (string, error) {
+	config := a.config
+	expiresIn := time.Second * time.Duration(config.JWT.Exp)
+
 	aal, amr := models.AAL1.String(), []models.AMREntry{}
 	sid := ""
+	passwordExpired := false
+	var session *models.Session
 	if sessionId != nil {
 		sid = sessionId.String()
-		session, terr := models.FindSessionByID(tx, *sessionId)
+		var terr error
+		session, terr = models.FindSessionByID(tx, *sessionId)
 		if terr != nil {
 			return "", terr
 		}
+		passwordExpired = session.PasswordExpired
 		aal, amr, terr = session.CalculateAALAndAMR(tx)
 		if terr != nil {
 			return "", terr
@@ -683,12 +751,24 @@ func generateAccessToken(tx *storage.Connection, user *models.User, sessionId *u
 		iat  int64
 	)
 
-	if isRefreshToken && user.UserMetaData["type"] != nil && utilities.StringContains([]string{"BOS", "AMBO"}, user.UserMetaData["type"].(string)) {
-		role = "service_role"
-		iss = "admin-token"
+	// staff types are granted by admins, refreshing their sessions elevates
+	// the access token to the configured role
+	if staffType := string(user.StaffType); authenticationMethod == models.TokenRefresh && staffType != "" && config.Staff.IsStaffType(staffType) {
+		role = config.Staff.Roles[staffType]
+		iss = config.Staff.Issuers[staffType]
 		iat = time.Now().Unix()
 	}
 
+	// sessions with an expired password get short lived tokens with a role
+	// other services don't know, so they are only accepted by GoTrue
+	if passwordExpired {
+		role = passwordExpiredRole
+		iss, iat = "", 0
+		if expiresIn > passwordExpiredTokenExp {
+			expiresIn = passwordExpiredTokenExp
+		}
+	}
+
 	claims := &GoTrueClaims{
 		StandardClaims: jwt.StandardClaims{
 			Subject:   user.ID.String(),
@@ -705,13 +785,21 @@ func generateAccessToken(tx *storage.Connection, user *models.User, sessionId *u
 		SessionId:                     sid,
 		AuthenticatorAssuranceLevel:   aal,
 		AuthenticationMethodReference: amr,
+		PasswordExpired:               passwordExpired,
+		IsBackoffice:                  isBackofficeUser(config, user),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	customClaims, err := a.runClaimsHook(r, tx, user, session, claims, authenticationMethod)
+	if err != nil {
+		return "", err
+	}
+	if customClaims != nil {
+		return a.signJWT(customClaims)
+	}
+	return a.signJWT(claims)
 }
 
-func (a *API) issueRefreshToken(ctx context.Context, conn *storage.Connection, user *models.User, authenticationMethod models.AuthenticationMethod, grantParams models.GrantParams) (*AccessTokenResponse, error) {
+func (a *API) issueRefreshToken(r *http.Request, conn *storage.Connection, user *models.User, authenticationMethod models.AuthenticationMethod, grantParams models.GrantParams) (*AccessTokenResponse, error) {
 	config := a.config
 
 	now := time.Now()
@@ -719,10 +807,19 @@ func (a *API) issueRefreshToken(ctx context.Context, conn *storage.Connection, u
 
 	var tokenString string
 	var refreshToken *models.RefreshToken
+	var revokedDevices []string
 
 	err := conn.Transaction(func(tx *storage.Connection) error {
 		var terr error
 
+		if terr = a.deleteExpiredSessions(tx, user); terr != nil {
+			return internalServerError("Database error deleting expired sessions").WithInternalError(terr)
+		}
+
+		if revokedDevices, terr = a.enforceSingleSession(r, tx, user, grantParams.Recovery); terr != nil {
+			return terr
+		}
+
 		refreshToken, terr = models.GrantAuthenticatedUser(tx, user, grantParams)
 		if terr != nil {
 			return internalServerError("Database error granting user").WithInternalError(terr)
@@ -737,7 +834,7 @@ func (a *API) issueRefreshToken(ctx context.Context, conn *storage.Connection, u
 			return terr
 		}
 
-		tokenString, terr = generateAccessToken(tx, user, refreshToken.SessionId, time.Second*time.Duration(config.JWT.Exp), config.JWT.Secret, false)
+		tokenString, terr = a.generateAccessToken(r, tx, user, refreshToken.SessionId, authenticationMethod)
 		if terr != nil {
 			return internalServerError("error generating jwt token").WithInternalError(terr)
 		}
@@ -747,9 +844,12 @@ func (a *API) issueRefreshToken(ctx context.Context, conn *storage.Connection, u
 		return nil, err
 	}
 
-	isBackoffice := true
-	if user.UserMetaData["type"] != nil {
-		isBackoffice = true
+	if len(revokedDevices) > 0 && config.Security.SingleSession.NotifyUser && user.GetEmail() != "" {
+		// the other sessions are already revoked, failing to notify the
+		// user doesn't fail the login
+		if err := a.Mailer(r.Context()).SessionsRevokedMail(user, revokedDevices); err != nil {
+			observability.GetLogEntry(r).WithError(err).Warn("unable to send sessions revoked email")
+		}
 	}
 
 	return &AccessTokenResponse{
@@ -758,7 +858,7 @@ func (a *API) issueRefreshToken(ctx context.Context, conn *storage.Connection, u
 		ExpiresIn:    config.JWT.Exp,
 		RefreshToken: refreshToken.Token,
 		User:         user,
-		IsBackoffice: isBackoffice,
+		IsBackoffice: isBackofficeUser(config, user),
 	}, nil
 }
 
@@ -806,7 +906,7 @@ func (a *API) updateMFASessionAndClaims(r *http.Request, tx *storage.Connection,
 			return err
 		}
 
-		tokenString, terr = generateAccessToken(tx, user, &sessionId, time.Second*time.Duration(config.JWT.Exp), config.JWT.Secret, false)
+		tokenString, terr = a.generateAccessToken(r, tx, user, &sessionId, authenticationMethod)
 
 		if terr != nil {
 			return internalServerError("error generating jwt token").WithInternalError(terr)
@@ -822,6 +922,7 @@ func (a *API) updateMFASessionAndClaims(r *http.Request, tx *storage.Connection,
 		ExpiresIn:    config.JWT.Exp,
 		RefreshToken: refreshToken.Token,
 		User:         user,
+		IsBackoffice: isBackofficeUser(config, user),
 	}, nil
 }
 
@@ -877,3 +978,13 @@ func (a *API) clearCookieToken(config *conf.GlobalConfiguration, name string, w
 		Domain:   config.Cookie.Domain,
 	})
 }
+
+// isBackofficeUser classifies the user as backoffice staff, email domains
+// are only trusted once the email is confirmed.
+func isBackofficeUser(config *conf.GlobalConfiguration, user *models.User) bool {
+	email := ""
+	if user.IsConfirmed() {
+		email = user.GetEmail()
+	}
+	return config.Backoffice.IsBackoffice(user.Role, user.AppMetaData, email)
+}
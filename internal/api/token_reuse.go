@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/observability"
+	"github.com/supabase/gotrue/internal/storage"
+	"github.com/supabase/gotrue/internal/utilities"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var refreshTokenReusedCounter = observability.ObtainMetricCounter("gotrue_refresh_token_reused", "Number of revoked refresh tokens reused outside of the reuse interval")
+
+// reportTokenReuse records a revoked refresh token reused outside of the
+// reuse interval, probably because it was stolen, and revokes its family
+// when refresh token rotation is enabled.
+func (a *API) reportTokenReuse(r *http.Request, db *storage.Connection, user *models.User, token *models.RefreshToken) error {
+	config := a.config
+	ipAddress := utilities.GetIPAddress(r)
+	userAgent := r.UserAgent()
+	familyRevoked := config.Security.RefreshTokenRotationEnabled
+	familySize := 0
+	notifyUser := false
+
+	err := db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		familySize, terr = models.CountTokenFamily(tx, token)
+		if terr != nil {
+			return terr
+		}
+		if terr := models.NewAuditLogEntry(r, tx, user, models.TokenReusedAction, ipAddress, map[string]interface{}{
+			"token_id":       token.ID,
+			"session_id":     token.SessionId,
+			"user_agent":     userAgent,
+			"family_size":    familySize,
+			"family_revoked": familyRevoked,
+		}); terr != nil {
+			return terr
+		}
+		// the user is told once per token family, so replaying a stolen
+		// token doesn't flood their inbox. Families without a session are
+		// only reported through the audit log, metric and webhook.
+		if config.Security.RefreshTokenReuseNotifyUser && user.GetEmail() != "" && token.SessionId != nil {
+			if notifyUser, terr = models.MarkRefreshTokenReuseNotified(tx, *token.SessionId); terr != nil {
+				return terr
+			}
+		}
+		if familyRevoked {
+			// Revoke all tokens in token family
+			return models.RevokeTokenFamily(tx, token)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	refreshTokenReusedCounter.Add(r.Context(), 1, attribute.Bool("family_revoked", familyRevoked))
+
+	// the token is rejected either way, failing to alert doesn't change
+	// the response
+	log := observability.GetLogEntry(r)
+	data := map[string]interface{}{
+		"token_id":       token.ID,
+		"family_size":    familySize,
+		"family_revoked": familyRevoked,
+		"ip_address":     ipAddress,
+		"user_agent":     userAgent,
+	}
+	if token.SessionId != nil {
+		data["session_id"] = token.SessionId
+	}
+	if err := triggerActionHooks(r.Context(), db, models.TokenReusedAction, user, data, config); err != nil {
+		log.WithError(err).Warn("token reused webhook failed")
+	}
+	if notifyUser {
+		if err := a.Mailer(r.Context()).TokenReusedMail(user, ipAddress, userAgent); err != nil {
+			log.WithError(err).Warn("unable to send token reused email")
+		}
+	}
+
+	return nil
+}
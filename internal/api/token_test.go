@@ -4,20 +4,27 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/crypto"
 	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/storage"
+	"golang.org/x/crypto/argon2"
 )
 
 type TokenTestSuite struct {
@@ -403,3 +410,687 @@ func (ts *TokenTestSuite) TestMagicLinkPKCESignIn() {
 	require.NotEmpty(ts.T(), verifyResp.Token)
 
 }
+
+// createLegacyCredential gives the test user the legacy password instead of
+// their own, like users imported from a legacy app.
+func (ts *TokenTestSuite) createLegacyCredential(password string) *models.LegacyCredential {
+	ts.User.EncryptedPassword = ""
+	require.NoError(ts.T(), ts.API.db.UpdateOnly(ts.User, "encrypted_password"))
+
+	// legacy hashes are "<argon2id hex>:<salt>:<extra>", keyed on the first 16 bytes of the salt
+	salt := "0123456789abcdef"
+	hash := hex.EncodeToString(argon2.IDKey([]byte(password), []byte(salt), 2, 64*1024, 1, 32))
+	legacy := &models.LegacyCredential{
+		ID:                uuid.Must(uuid.NewV4()),
+		Email:             storage.NullString(ts.User.GetEmail()),
+		EncryptedPassword: hash + ":" + salt + ":1",
+	}
+	require.NoError(ts.T(), ts.API.db.Create(legacy))
+	return legacy
+}
+
+func (ts *TokenTestSuite) passwordLogin(email, password string) *httptest.ResponseRecorder {
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    email,
+		"password": password,
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *TokenTestSuite) TestTokenPasswordGrantMigratesLegacyCredential() {
+	ts.createLegacyCredential("legacypassword")
+
+	w := ts.passwordLogin(ts.User.GetEmail(), "legacypassword")
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	// the password is now stored on the user and the legacy credential is retired
+	u, err := models.FindUserByID(ts.API.db, ts.User.ID)
+	require.NoError(ts.T(), err)
+	require.True(ts.T(), u.Authenticate("legacypassword"))
+
+	_, err = models.FindUserByEmailFromLegacy(ts.API.db, ts.User.GetEmail())
+	require.True(ts.T(), models.IsNotFoundError(err))
+
+	logs, err := models.FindAuditLogEntries(ts.API.db, []string{"action"}, string(models.LegacyCredentialMigratedAction), nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), logs, 1)
+}
+
+func (ts *TokenTestSuite) TestTokenPasswordGrantIgnoresRetiredLegacyCredential() {
+	legacy := ts.createLegacyCredential("legacypassword")
+
+	// banned users don't sign in with their legacy password
+	bannedUntil := time.Now().Add(time.Hour)
+	ts.User.BannedUntil = &bannedUntil
+	require.NoError(ts.T(), ts.API.db.UpdateOnly(ts.User, "banned_until"))
+	w := ts.passwordLogin(ts.User.GetEmail(), "legacypassword")
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+	ts.User.BannedUntil = nil
+	require.NoError(ts.T(), ts.API.db.UpdateOnly(ts.User, "banned_until"))
+
+	// setting a password, e.g. on recovery, retires the legacy one
+	require.NoError(ts.T(), ts.User.UpdatePassword(ts.API.db, "newpassword"))
+	retired := &models.LegacyCredential{}
+	require.NoError(ts.T(), ts.API.db.Find(retired, legacy.ID))
+	require.True(ts.T(), retired.IsMigrated())
+
+	w = ts.passwordLogin(ts.User.GetEmail(), "legacypassword")
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+	w = ts.passwordLogin(ts.User.GetEmail(), "newpassword")
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	u, err := models.FindUserByID(ts.API.db, ts.User.ID)
+	require.NoError(ts.T(), err)
+	require.True(ts.T(), u.Authenticate("newpassword"))
+
+	// legacy credentials aren't checked once the user has a password,
+	// even if they weren't retired
+	legacy = ts.createLegacyCredential("otherlegacypassword")
+	require.NoError(ts.T(), u.UpdatePassword(ts.API.db, "newpassword"))
+	require.NoError(ts.T(), ts.API.db.UpdateOnly(legacy, "migrated_at"))
+	w = ts.passwordLogin(ts.User.GetEmail(), "otherlegacypassword")
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *TokenTestSuite) TestTokenPasswordGrantWithLegacyPhone() {
+	ts.Config.External.Phone.Enabled = true
+
+	u, err := models.NewUser("6281234567890", "", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	now := time.Now()
+	u.PhoneConfirmedAt = &now
+	u.EncryptedPassword = ""
+	require.NoError(ts.T(), ts.API.db.Create(u))
+
+	// legacy apps stored phones with a leading "+" and spaces
+	legacy := &models.LegacyCredential{
+		ID:                uuid.Must(uuid.NewV4()),
+		Phone:             "+62 81234567890",
+		EncryptedPassword: "sha1$seasalt$cff36ea83f5706ce9aa7454e63e431fc726b2dc8",
+	}
+	require.NoError(ts.T(), ts.API.db.Create(legacy))
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"phone":    "+62 81234 567890",
+		"password": "lètmein",
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	_, err = models.FindUserByPhoneFromLegacy(ts.API.db, "6281234567890")
+	require.True(ts.T(), models.IsNotFoundError(err))
+}
+
+func (ts *TokenTestSuite) TestTokenPasswordGrantFlagsBreachedPassword() {
+	// SHA-1 of "password"
+	corpus := filepath.Join(ts.T().TempDir(), "pwned-passwords.txt")
+	require.NoError(ts.T(), os.WriteFile(corpus, []byte("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\n"), 0600))
+
+	ts.API.breachedPasswords = crypto.NewBreachedPasswordCorpus(corpus, 0)
+	ts.Config.Security.BreachedPasswords.FlagOnLogin = true
+	defer func() {
+		ts.API.breachedPasswords = nil
+		ts.Config.Security.BreachedPasswords.FlagOnLogin = false
+	}()
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    "test@example.com",
+		"password": "password",
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	token := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+	require.True(ts.T(), token.PasswordBreached)
+
+	logs, err := models.FindAuditLogEntries(ts.API.db, []string{"action"}, string(models.BreachedPasswordLoginAction), nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), logs, 1)
+}
+
+func (ts *TokenTestSuite) TestTokenPasswordGrantExpiredPassword() {
+	ts.Config.Security.PasswordExpiry = conf.PasswordExpiryConfiguration{
+		AppMetadataKey: "backoffice",
+		MaxAge:         24 * time.Hour,
+	}
+	defer func() {
+		ts.Config.Security.PasswordExpiry = conf.PasswordExpiryConfiguration{}
+	}()
+
+	changedAt := time.Now().Add(-48 * time.Hour)
+	ts.User.PasswordChangedAt = &changedAt
+	ts.User.AppMetaData = map[string]interface{}{"backoffice": true}
+	require.NoError(ts.T(), ts.API.db.Update(ts.User))
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    "test@example.com",
+		"password": "password",
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	token := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+	require.True(ts.T(), token.PasswordExpired)
+
+	// the restricted token is short lived, has a role other services
+	// don't know and can only read the user and change the password
+	claims := &GoTrueClaims{}
+	_, err := jwt.ParseWithClaims(token.Token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), passwordExpiredRole, claims.Role)
+	require.LessOrEqual(ts.T(), claims.ExpiresAt, time.Now().Add(passwordExpiredTokenExp).Unix())
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/user", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.Token))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/user/sessions", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.Token))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusForbidden, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/settings", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.Token))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	settings := &Settings{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(settings))
+	require.True(ts.T(), settings.PasswordRotationRequired)
+
+	// the expired password can't be kept
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"password": "password",
+	}))
+	req = httptest.NewRequest(http.MethodPut, "http://localhost/user", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.Token))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusUnprocessableEntity, w.Code)
+
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"password": "New-Password1",
+	}))
+	req = httptest.NewRequest(http.MethodPut, "http://localhost/user", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.Token))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	// refreshing the session lifts the restriction
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"refresh_token": token.RefreshToken,
+	}))
+	req = httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	refreshed := &AccessTokenResponse{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(refreshed))
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/user", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", refreshed.Token))
+	w = httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+}
+
+func (ts *TokenTestSuite) TestTokenPasswordGrantBackoffice() {
+	ts.Config.Backoffice = conf.BackofficeConfiguration{
+		AppMetadata: map[string]string{"staff": "true"},
+	}
+	defer func() {
+		ts.Config.Backoffice = conf.BackofficeConfiguration{}
+	}()
+
+	for _, c := range []struct {
+		desc         string
+		appMetaData  map[string]interface{}
+		isBackoffice bool
+	}{
+		{"Shopper", map[string]interface{}{}, false},
+		{"Staff", map[string]interface{}{"staff": true}, true},
+	} {
+		ts.Run(c.desc, func() {
+			ts.User.AppMetaData = c.appMetaData
+			require.NoError(ts.T(), ts.API.db.Update(ts.User))
+
+			var buffer bytes.Buffer
+			require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+				"email":    "test@example.com",
+				"password": "password",
+			}))
+
+			req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			ts.API.handler.ServeHTTP(w, req)
+			require.Equal(ts.T(), http.StatusOK, w.Code)
+
+			token := &AccessTokenResponse{}
+			require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+			require.Equal(ts.T(), c.isBackoffice, token.IsBackoffice)
+
+			claims := &GoTrueClaims{}
+			_, err := jwt.ParseWithClaims(token.Token, claims, func(token *jwt.Token) (interface{}, error) {
+				return []byte(ts.Config.JWT.Secret), nil
+			})
+			require.NoError(ts.T(), err)
+			require.Equal(ts.T(), c.isBackoffice, claims.IsBackoffice)
+		})
+	}
+}
+
+func (ts *TokenTestSuite) TestTokenPasswordGrantLockout() {
+	ts.Config.Security.Lockout = conf.LockoutConfiguration{
+		MaxAttempts: 3,
+		Duration:    time.Minute,
+		MaxDuration: time.Hour,
+	}
+	defer func() {
+		ts.Config.Security.Lockout = conf.LockoutConfiguration{}
+	}()
+
+	login := func(password string) *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"email":    "test@example.com",
+			"password": password,
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		require.Equal(ts.T(), http.StatusBadRequest, login("wrong-password").Code)
+	}
+
+	user, err := models.FindUserByID(ts.API.db, ts.User.ID)
+	require.NoError(ts.T(), err)
+	require.True(ts.T(), user.IsLocked())
+	require.Equal(ts.T(), 1, user.LockoutCount)
+
+	// the right password is rejected while the account is locked, like
+	// logins of unknown users so the lock doesn't reveal the account
+	w := login("password")
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+	require.Contains(ts.T(), w.Body.String(), InvalidLoginMessage)
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"email":    "unknown@example.com",
+		"password": "password",
+	}))
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	unknown := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(unknown, req)
+	require.Equal(ts.T(), unknown.Code, w.Code)
+	require.Equal(ts.T(), unknown.Body.String(), w.Body.String())
+
+	// the next lockout lasts twice as long
+	user.LockedUntil = nil
+	require.NoError(ts.T(), ts.API.db.UpdateOnly(user, "locked_until"))
+	for i := 0; i < 3; i++ {
+		require.Equal(ts.T(), http.StatusBadRequest, login("wrong-password").Code)
+	}
+	user, err = models.FindUserByID(ts.API.db, ts.User.ID)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), 2, user.LockoutCount)
+	require.WithinDuration(ts.T(), time.Now().Add(2*time.Minute), *user.LockedUntil, 10*time.Second)
+
+	// a successful login clears the failed attempts
+	user.LockedUntil = nil
+	require.NoError(ts.T(), ts.API.db.UpdateOnly(user, "locked_until"))
+	require.Equal(ts.T(), http.StatusOK, login("password").Code)
+	user, err = models.FindUserByID(ts.API.db, ts.User.ID)
+	require.NoError(ts.T(), err)
+	require.Zero(ts.T(), user.LockoutCount)
+	require.Zero(ts.T(), user.FailedLoginAttempts)
+}
+
+func (ts *TokenTestSuite) TestTokenRefreshTokenGrantStaffType() {
+	staff := ts.Config.Staff
+	ts.Config.Staff = conf.StaffConfiguration{
+		Roles:   map[string]string{"BOS": "service_role"},
+		Issuers: map[string]string{"BOS": "admin-token"},
+	}
+	defer func() {
+		ts.Config.Staff = staff
+	}()
+
+	for _, c := range []struct {
+		desc         string
+		staffType    string
+		userMetaData map[string]interface{}
+		role         string
+		issuer       string
+	}{
+		{"Staff type is elevated", "BOS", map[string]interface{}{}, "service_role", "admin-token"},
+		{"User metadata type is not elevated", "", map[string]interface{}{"type": "BOS"}, "authenticated", ""},
+	} {
+		ts.Run(c.desc, func() {
+			ts.User.StaffType = storage.NullString(c.staffType)
+			ts.User.UserMetaData = c.userMetaData
+			ts.User.Role = "authenticated"
+			require.NoError(ts.T(), ts.API.db.Update(ts.User))
+
+			refreshToken, err := models.GrantAuthenticatedUser(ts.API.db, ts.User, models.GrantParams{})
+			require.NoError(ts.T(), err)
+
+			var buffer bytes.Buffer
+			require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+				"refresh_token": refreshToken.Token,
+			}))
+			req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", &buffer)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			ts.API.handler.ServeHTTP(w, req)
+			require.Equal(ts.T(), http.StatusOK, w.Code)
+
+			token := &AccessTokenResponse{}
+			require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+
+			claims := &GoTrueClaims{}
+			_, err = jwt.ParseWithClaims(token.Token, claims, func(token *jwt.Token) (interface{}, error) {
+				return []byte(ts.Config.JWT.Secret), nil
+			})
+			require.NoError(ts.T(), err)
+			require.Equal(ts.T(), c.role, claims.Role)
+			require.Equal(ts.T(), c.issuer, claims.Issuer)
+		})
+	}
+}
+
+func (ts *TokenTestSuite) TestTokenRefreshWithSessionLimits() {
+	sessions := ts.Config.Sessions
+	ts.Config.Sessions = conf.SessionsConfiguration{
+		Timebox:           24 * time.Hour,
+		InactivityTimeout: time.Hour,
+		RoleTimebox:       map[string]time.Duration{"service_role": 8 * time.Hour},
+	}
+	defer func() {
+		ts.Config.Sessions = sessions
+	}()
+
+	for _, c := range []struct {
+		desc      string
+		role      string
+		createdAt time.Duration
+		refreshed time.Duration
+		code      int
+	}{
+		{"Active session", "authenticated", 2 * time.Hour, 10 * time.Minute, http.StatusOK},
+		{"Inactive session", "authenticated", 2 * time.Hour, 90 * time.Minute, http.StatusBadRequest},
+		{"Session past the timebox", "authenticated", 25 * time.Hour, 10 * time.Minute, http.StatusBadRequest},
+		{"Session past the role timebox", "service_role", 9 * time.Hour, 10 * time.Minute, http.StatusBadRequest},
+	} {
+		ts.Run(c.desc, func() {
+			ts.User.Role = c.role
+			require.NoError(ts.T(), ts.API.db.UpdateOnly(ts.User, "role"))
+
+			refreshToken, err := models.GrantAuthenticatedUser(ts.API.db, ts.User, models.GrantParams{})
+			require.NoError(ts.T(), err)
+			now := time.Now()
+			require.NoError(ts.T(), ts.API.db.RawQuery(
+				"update sessions set created_at = ?, refreshed_at = ? where id = ?",
+				now.Add(-c.createdAt), now.Add(-c.refreshed), refreshToken.SessionId,
+			).Exec())
+
+			var buffer bytes.Buffer
+			require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+				"refresh_token": refreshToken.Token,
+			}))
+			req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", &buffer)
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			ts.API.handler.ServeHTTP(w, req)
+			require.Equal(ts.T(), c.code, w.Code)
+
+			if c.code != http.StatusOK {
+				data := &OAuthError{}
+				require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(data))
+				require.Equal(ts.T(), "session_expired", data.Err)
+
+				// expired sessions are garbage-collected
+				_, err := models.FindSessionByID(ts.API.db, *refreshToken.SessionId)
+				require.True(ts.T(), models.IsNotFoundError(err))
+			}
+		})
+	}
+}
+
+func (ts *TokenTestSuite) TestTokenPasswordGrantSingleSession() {
+	ts.Config.Backoffice = conf.BackofficeConfiguration{
+		AppMetadata: map[string]string{"staff": "true"},
+	}
+	defer func() {
+		ts.Config.Backoffice = conf.BackofficeConfiguration{}
+		ts.Config.Security.SingleSession = conf.SingleSessionConfiguration{Policy: conf.SingleSessionRevoke}
+	}()
+
+	ts.User.AppMetaData = map[string]interface{}{"staff": true}
+	require.NoError(ts.T(), ts.API.db.Update(ts.User))
+
+	login := func() *httptest.ResponseRecorder {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"email":    "test@example.com",
+			"password": "password",
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, c := range []struct {
+		desc     string
+		policy   string
+		code     int
+		sessions int
+	}{
+		{"Other sessions are revoked", conf.SingleSessionRevoke, http.StatusOK, 1},
+		{"Login is rejected", conf.SingleSessionReject, http.StatusBadRequest, 2},
+	} {
+		ts.Run(c.desc, func() {
+			require.NoError(ts.T(), models.Logout(ts.API.db, ts.User.ID))
+			ts.Config.Security.SingleSession = conf.SingleSessionConfiguration{}
+			for i := 0; i < 2; i++ {
+				require.Equal(ts.T(), http.StatusOK, login().Code)
+			}
+
+			ts.Config.Security.SingleSession = conf.SingleSessionConfiguration{
+				Backoffice: true,
+				Policy:     c.policy,
+			}
+			w := login()
+			require.Equal(ts.T(), c.code, w.Code)
+			if c.code != http.StatusOK {
+				data := &OAuthError{}
+				require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(data))
+				require.Equal(ts.T(), SingleSessionErrorCode, data.Err)
+			}
+
+			sessions, err := models.FindSessionsByUserID(ts.API.db, ts.User.ID)
+			require.NoError(ts.T(), err)
+			require.Len(ts.T(), sessions, c.sessions)
+
+			logs, err := models.FindAuditLogEntries(ts.API.db, []string{"action"}, string(models.SingleSessionEnforcedAction), nil)
+			require.NoError(ts.T(), err)
+			require.NotEmpty(ts.T(), logs)
+		})
+	}
+}
+
+func (ts *TokenTestSuite) TestTokenRefreshTokenReuseReported() {
+	ts.Config.Security.RefreshTokenRotationEnabled = true
+	ts.Config.Security.RefreshTokenReuseInterval = 0
+
+	first, err := models.GrantAuthenticatedUser(ts.API.db, ts.User, models.GrantParams{})
+	require.NoError(ts.T(), err)
+	second, err := models.GrantRefreshTokenSwap(&http.Request{}, ts.API.db, ts.User, first)
+	require.NoError(ts.T(), err)
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"refresh_token": first.Token,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "stolen-client/1.0")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	logs, err := models.FindAuditLogEntries(ts.API.db, []string{"action"}, string(models.TokenReusedAction), nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), logs, 1)
+	require.Equal(ts.T(), "203.0.113.7", logs[0].IPAddress)
+
+	traits, ok := logs[0].Payload["traits"].(map[string]interface{})
+	require.True(ts.T(), ok)
+	require.Equal(ts.T(), "stolen-client/1.0", traits["user_agent"])
+	require.Equal(ts.T(), float64(2), traits["family_size"])
+	require.Equal(ts.T(), true, traits["family_revoked"])
+
+	// the whole family is revoked, including the second token
+	_, err = models.GetValidChildToken(ts.API.db, first)
+	require.True(ts.T(), models.IsNotFoundError(err))
+	require.Equal(ts.T(), first.Token, string(second.Parent))
+}
+
+func (ts *TokenTestSuite) TestTokenRefreshTokenReuseNotifiesOnce() {
+	ts.Config.Security.RefreshTokenRotationEnabled = true
+	ts.Config.Security.RefreshTokenReuseInterval = 0
+	ts.Config.Security.RefreshTokenReuseNotifyUser = true
+	defer func() {
+		ts.Config.Security.RefreshTokenReuseNotifyUser = false
+	}()
+
+	first, err := models.GrantAuthenticatedUser(ts.API.db, ts.User, models.GrantParams{})
+	require.NoError(ts.T(), err)
+	_, err = models.GrantRefreshTokenSwap(&http.Request{}, ts.API.db, ts.User, first)
+	require.NoError(ts.T(), err)
+
+	for i := 0; i < 3; i++ {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"refresh_token": first.Token,
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=refresh_token", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+	}
+
+	// every replay is audited, the user was told on the first one
+	logs, err := models.FindAuditLogEntries(ts.API.db, []string{"action"}, string(models.TokenReusedAction), nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), logs, 3)
+	notified, err := models.MarkRefreshTokenReuseNotified(ts.API.db, *first.SessionId)
+	require.NoError(ts.T(), err)
+	require.False(ts.T(), notified)
+}
+
+func (ts *TokenTestSuite) TestTokenPasswordGrantClaimsHookFunction() {
+	// the function runs in the grant's transaction, so it sees the session
+	// being created, and it sleeps when asked to
+	require.NoError(ts.T(), ts.API.db.RawQuery(fmt.Sprintf(`create or replace function public.test_claims_hook(request jsonb) returns jsonb language plpgsql as $$
+	begin
+		if request->'user'->'user_metadata'->>'slow' = 'true' then
+			perform pg_sleep(2);
+		end if;
+		return jsonb_build_object('claims', jsonb_build_object(
+			'session_visible', exists(select 1 from %s.sessions where id = (request->'session'->>'id')::uuid),
+			'grant_type', request->>'grant_type'
+		));
+	end;
+	$$`, ts.Config.DB.Namespace)).Exec())
+	defer func() {
+		require.NoError(ts.T(), ts.API.db.RawQuery("drop function public.test_claims_hook(jsonb)").Exec())
+	}()
+
+	ts.Config.ClaimsHook = conf.ClaimsHookConfiguration{
+		Function:   "public.test_claims_hook",
+		TimeoutSec: 1,
+	}
+	defer func() {
+		ts.Config.ClaimsHook = conf.ClaimsHookConfiguration{}
+	}()
+
+	login := func() jwt.MapClaims {
+		var buffer bytes.Buffer
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+			"email":    "test@example.com",
+			"password": "password",
+		}))
+		req := httptest.NewRequest(http.MethodPost, "http://localhost/token?grant_type=password", &buffer)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.API.handler.ServeHTTP(w, req)
+		require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+		token := &AccessTokenResponse{}
+		require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(token))
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(token.Token, claims, func(token *jwt.Token) (interface{}, error) {
+			return []byte(ts.Config.JWT.Secret), nil
+		})
+		require.NoError(ts.T(), err)
+		return claims
+	}
+
+	claims := login()
+	require.Equal(ts.T(), true, claims["session_visible"])
+	require.Equal(ts.T(), "password", claims["grant_type"])
+
+	// a function running past the timeout is rolled back and the grant goes
+	// on without custom claims
+	require.NoError(ts.T(), ts.User.UpdateUserMetaData(ts.API.db, map[string]interface{}{"slow": "true"}))
+	claims = login()
+	require.NotContains(ts.T(), claims, "session_visible")
+}
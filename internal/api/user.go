@@ -67,6 +67,18 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 	log := observability.GetLogEntry(r)
 	log.Debugf("Checking params for token %v", params)
 
+	if claims := getClaims(ctx); claims != nil && claims.PasswordExpired {
+		if params.Password == nil || params.Email != "" || params.Phone != "" || params.Data != nil || params.AppData != nil {
+			return forbiddenError("Password has expired, only the password can be changed")
+		}
+	}
+
+	if params.AppData != nil {
+		if err := a.checkUserAppMetaData(params.AppData); err != nil {
+			return err
+		}
+	}
+
 	if params.Email != "" && params.Email != user.GetEmail() {
 		params.Email, err = validateEmail(params.Email)
 		if err != nil {
@@ -108,16 +120,26 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 	err = db.Transaction(func(tx *storage.Connection) error {
 		var terr error
 		if params.Password != nil {
-			if len(*params.Password) < config.PasswordMinLength {
-				return invalidPasswordLengthError(config.PasswordMinLength)
+			if violations := utilities.ValidatePassword(&config.PasswordPolicy, *params.Password, user.GetEmail()); len(violations) > 0 {
+				return weakPasswordError(&config.PasswordPolicy, violations)
 			}
-
-			if err := utilities.ValidatePassword(*params.Password); err != "" {
-				return unprocessableEntityError(err)
+			if err := a.checkBreachedPassword(ctx, *params.Password); err != nil {
+				return err
+			}
+			if terr = a.checkRecentPassword(tx, user, *params.Password); terr != nil {
+				return terr
+			}
+			// an expired password can't be changed to itself, whatever the
+			// size of the password history
+			if claims := getClaims(ctx); claims != nil && claims.PasswordExpired && user.Authenticate(*params.Password) {
+				return weakPasswordError(&config.PasswordPolicy, []utilities.PasswordViolation{utilities.PasswordReused})
 			}
 
 			isPasswordUpdated := false
 			if !config.Security.UpdatePasswordRequireReauthentication {
+				if terr = models.RememberPassword(tx, user, config.PasswordPolicy.HistorySize); terr != nil {
+					return internalServerError("Error during password storage").WithInternalError(terr)
+				}
 				if terr = user.UpdatePassword(tx, *params.Password); terr != nil {
 					return internalServerError("Error during password storage").WithInternalError(terr)
 				}
@@ -128,6 +150,9 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 				if terr = a.verifyReauthentication(params.Nonce, tx, config, user); terr != nil {
 					return terr
 				}
+				if terr = models.RememberPassword(tx, user, config.PasswordPolicy.HistorySize); terr != nil {
+					return internalServerError("Error during password storage").WithInternalError(terr)
+				}
 				if terr = user.UpdatePassword(tx, *params.Password); terr != nil {
 					return internalServerError("Error during password storage").WithInternalError(terr)
 				}
@@ -138,10 +163,20 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 				if terr := models.NewAuditLogEntry(r, tx, user, models.UserUpdatePasswordAction, "", nil); terr != nil {
 					return terr
 				}
+				if terr := triggerActionHooks(ctx, tx, models.UserUpdatePasswordAction, user, map[string]interface{}{
+					"actor": "user",
+				}, config); terr != nil {
+					return terr
+				}
 				if session != nil {
 					if terr = models.LogoutAllExceptMe(tx, session.ID, user.ID); terr != nil {
 						return terr
 					}
+					if session.PasswordExpired {
+						if terr = session.ClearPasswordExpired(tx); terr != nil {
+							return terr
+						}
+					}
 				} else {
 					// logout all sessions if session id is missing
 					if terr = models.Logout(tx, user.ID); terr != nil {
@@ -158,11 +193,7 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 		}
 
 		if params.AppData != nil {
-			if !a.isAdmin(ctx, user, config.JWT.Aud) {
-				return unauthorizedError("Updating app_metadata requires admin privileges")
-			}
-
-			if terr = user.UpdateAppMetaData(tx, params.AppData); terr != nil {
+			if terr = a.updateAppMetaData(r, tx, user, user, params.AppData); terr != nil {
 				return internalServerError("Error updating user").WithInternalError(terr)
 			}
 		}
@@ -240,3 +271,17 @@ func (a *API) UserUpdate(w http.ResponseWriter, r *http.Request) error {
 
 	return sendJSON(w, http.StatusOK, user)
 }
+
+// checkRecentPassword rejects passwords the user had recently, according to
+// the password history size of the password policy.
+func (a *API) checkRecentPassword(tx *storage.Connection, user *models.User, password string) error {
+	policy := &a.config.PasswordPolicy
+	recent, err := models.IsRecentPassword(tx, user, password, policy.HistorySize)
+	if err != nil {
+		return internalServerError("Error checking password history").WithInternalError(err)
+	}
+	if recent {
+		return weakPasswordError(policy, []utilities.PasswordViolation{utilities.PasswordReused})
+	}
+	return nil
+}
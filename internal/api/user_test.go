@@ -48,7 +48,7 @@ func (ts *UserTestSuite) TestUserGet() {
 	u, err := models.FindUserByEmailAndAudience(ts.API.db, "test@example.com", ts.Config.JWT.Aud)
 	require.NoError(ts.T(), err, "Error finding user")
 	var token string
-	token, err = generateAccessToken(ts.API.db, u, nil, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret, false)
+	token, err = ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
 
 	require.NoError(ts.T(), err, "Error generating access token")
 
@@ -114,7 +114,7 @@ func (ts *UserTestSuite) TestUserUpdateEmail() {
 			require.NoError(ts.T(), ts.API.db.Create(u), "Error saving test user")
 
 			var token string
-			token, err = generateAccessToken(ts.API.db, u, nil, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret, false)
+			token, err = ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
 
 			require.NoError(ts.T(), err, "Error generating access token")
 
@@ -178,7 +178,7 @@ func (ts *UserTestSuite) TestUserUpdatePhoneAutoconfirmEnabled() {
 	for _, c := range cases {
 		ts.Run(c.desc, func() {
 			var token string
-			token, err = generateAccessToken(ts.API.db, u, nil, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret, false)
+			token, err = ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
 			require.NoError(ts.T(), err, "Error generating access token")
 
 			var buffer bytes.Buffer
@@ -253,7 +253,7 @@ func (ts *UserTestSuite) TestUserUpdatePassword() {
 			req.Header.Set("Content-Type", "application/json")
 
 			var token string
-			token, err = generateAccessToken(ts.API.db, u, nil, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret, false)
+			token, err = ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
 			require.NoError(ts.T(), err)
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
@@ -283,7 +283,7 @@ func (ts *UserTestSuite) TestUserUpdatePasswordReauthentication() {
 	require.NoError(ts.T(), ts.API.db.Update(u), "Error updating new test user")
 
 	var token string
-	token, err = generateAccessToken(ts.API.db, u, nil, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret, false)
+	token, err = ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
 	require.NoError(ts.T(), err)
 
 	// request for reauthentication nonce
@@ -404,3 +404,130 @@ func (ts *UserTestSuite) TestUserUpdatePasswordLogoutOtherSessions() {
 	ts.API.handler.ServeHTTP(w, req)
 	require.NotEqual(ts.T(), http.StatusOK, w.Code)
 }
+
+func (ts *UserTestSuite) TestUserUpdatePasswordHistory() {
+	ts.Config.Security.UpdatePasswordRequireReauthentication = false
+	ts.Config.PasswordPolicy.HistorySize = 2
+	defer func() {
+		ts.Config.PasswordPolicy.HistorySize = 0
+	}()
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+
+	token, err := ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
+	require.NoError(ts.T(), err)
+
+	var cases = []struct {
+		desc        string
+		newPassword string
+		code        int
+	}{
+		{
+			desc:        "New password",
+			newPassword: "First-Pass1",
+			code:        http.StatusOK,
+		},
+		{
+			desc:        "Current password",
+			newPassword: "First-Pass1",
+			code:        http.StatusUnprocessableEntity,
+		},
+		{
+			desc:        "Another new password",
+			newPassword: "Second-Pass2",
+			code:        http.StatusOK,
+		},
+		{
+			desc:        "Previous password",
+			newPassword: "First-Pass1",
+			code:        http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, c := range cases {
+		ts.Run(c.desc, func() {
+			var buffer bytes.Buffer
+			require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]string{"password": c.newPassword}))
+
+			req := httptest.NewRequest(http.MethodPut, "http://localhost/user", &buffer)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			w := httptest.NewRecorder()
+			ts.API.handler.ServeHTTP(w, req)
+			require.Equal(ts.T(), c.code, w.Code)
+
+			if c.code == http.StatusUnprocessableEntity {
+				data := &HTTPError{}
+				require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(data))
+				require.Equal(ts.T(), []string{"password_reused"}, data.Reasons)
+			}
+		})
+	}
+}
+
+func (ts *UserTestSuite) TestUserUpdateAppMetaData() {
+	ts.Config.Security.UserAppMetadataKeys = []string{"locale"}
+	defer func() {
+		ts.Config.Security.UserAppMetadataKeys = nil
+	}()
+
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+
+	token, err := ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
+	require.NoError(ts.T(), err)
+
+	var cases = []struct {
+		desc     string
+		appData  map[string]interface{}
+		code     int
+		rejected []string
+	}{
+		{
+			desc:    "Allowed key",
+			appData: map[string]interface{}{"locale": "id"},
+			code:    http.StatusOK,
+		},
+		{
+			desc:     "Restricted keys",
+			appData:  map[string]interface{}{"locale": "en", "role": "admin", "staff": true},
+			code:     http.StatusForbidden,
+			rejected: []string{"role", "staff"},
+		},
+	}
+
+	for _, c := range cases {
+		ts.Run(c.desc, func() {
+			var buffer bytes.Buffer
+			require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{"app_metadata": c.appData}))
+
+			req := httptest.NewRequest(http.MethodPut, "http://localhost/user", &buffer)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+			w := httptest.NewRecorder()
+			ts.API.handler.ServeHTTP(w, req)
+			require.Equal(ts.T(), c.code, w.Code)
+
+			if c.code == http.StatusForbidden {
+				data := &HTTPError{}
+				require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(data))
+				require.Equal(ts.T(), AppMetadataRestrictedErrorCode, data.ErrorCode)
+				require.Equal(ts.T(), c.rejected, data.Reasons)
+			}
+		})
+	}
+
+	u, err = models.FindUserByID(ts.API.db, u.ID)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), "id", u.AppMetaData["locale"])
+	require.NotContains(ts.T(), u.AppMetaData, "role")
+
+	logs, err := models.FindAuditLogEntries(ts.API.db, []string{"action"}, string(models.AppMetadataUpdatedAction), nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), logs, 1)
+	traits := logs[0].Payload["traits"].(map[string]interface{})
+	require.Equal(ts.T(), map[string]interface{}{"locale": "id"}, traits["after"])
+}
@@ -12,10 +12,10 @@ import (
 	"strings"
 	"time"
 
-	"github.com/sethvargo/go-password/password"
 	"github.com/supabase/gotrue/internal/models"
 	"github.com/supabase/gotrue/internal/observability"
 	"github.com/supabase/gotrue/internal/storage"
+	"github.com/supabase/gotrue/internal/utilities"
 )
 
 var (
@@ -91,6 +91,7 @@ func (a *API) verifyGet(w http.ResponseWriter, r *http.Request) error {
 		token       *AccessTokenResponse
 		authCode    string
 	)
+	grantParams.FillGrantParams(r)
 	var flowType models.FlowType
 	var authenticationMethod models.AuthenticationMethod
 	if strings.HasPrefix(params.Token, PKCEPrefix) {
@@ -136,7 +137,8 @@ func (a *API) verifyGet(w http.ResponseWriter, r *http.Request) error {
 			return terr
 		}
 		if isImplicitFlow(flowType) {
-			token, terr = a.issueRefreshToken(ctx, tx, user, models.OTP, grantParams)
+			grantParams.Recovery = params.Type == recoveryVerification
+			token, terr = a.issueRefreshToken(r, tx, user, models.OTP, grantParams)
 
 			if terr != nil {
 				return terr
@@ -202,6 +204,7 @@ func (a *API) verifyPost(w http.ResponseWriter, r *http.Request) error {
 		grantParams models.GrantParams
 		token       *AccessTokenResponse
 	)
+	grantParams.FillGrantParams(r)
 
 	err = db.Transaction(func(tx *storage.Connection) error {
 		var terr error
@@ -239,7 +242,7 @@ func (a *API) verifyPost(w http.ResponseWriter, r *http.Request) error {
 			return uerr
 		}
 
-		token, terr = a.issueRefreshToken(ctx, tx, user, models.OTP, grantParams)
+		token, terr = a.issueRefreshToken(r, tx, user, models.OTP, grantParams)
 		if terr != nil {
 			return terr
 		}
@@ -264,7 +267,7 @@ func (a *API) signupVerify(r *http.Request, ctx context.Context, conn *storage.C
 			if user.InvitedAt != nil {
 				// sign them up with temporary password, and require application
 				// to present the user with a password set form
-				password, err := password.Generate(30, 10, 1, false, true)
+				password, err := utilities.GeneratePassword(&config.PasswordPolicy)
 				if err != nil {
 					internalServerError("error creating user").WithInternalError(err)
 				}
@@ -352,9 +355,20 @@ func (a *API) smsVerify(r *http.Request, ctx context.Context, conn *storage.Conn
 				return internalServerError("Error confirming user").WithInternalError(terr)
 			}
 		} else if otpType == phoneChangeVerification {
+			previousPhone := user.GetPhone()
 			if terr = user.ConfirmPhoneChange(tx); terr != nil {
 				return internalServerError("Error confirming user").WithInternalError(terr)
 			}
+			if terr = models.NewAuditLogEntry(r, tx, user, models.PhoneChangedAction, "", map[string]interface{}{
+				"previous_phone": previousPhone,
+			}); terr != nil {
+				return terr
+			}
+			if terr = triggerActionHooks(ctx, tx, models.PhoneChangedAction, user, map[string]interface{}{
+				"previous_phone": previousPhone,
+			}, config); terr != nil {
+				return terr
+			}
 		}
 		return nil
 	})
@@ -178,7 +178,7 @@ func (ts *VerifyTestSuite) TestVerifySecureEmailChange() {
 
 		// Generate access token for request
 		var token string
-		token, err = generateAccessToken(ts.API.db, u, nil, time.Second*time.Duration(ts.Config.JWT.Exp), ts.Config.JWT.Secret, false)
+		token, err = ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
 		require.NoError(ts.T(), err)
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
@@ -869,3 +869,75 @@ func (ts *VerifyTestSuite) TestVerifyValidOtp() {
 		})
 	}
 }
+
+func (ts *VerifyTestSuite) TestVerifyRecoveryWithSingleSessionReject() {
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	u.Role = "support"
+	u.RecoveryToken = "recovery_token"
+	t := time.Now()
+	u.RecoverySentAt = &t
+	u.EmailConfirmedAt = &t
+	require.NoError(ts.T(), ts.API.db.Update(u))
+
+	// the only session is on a lost device
+	_, err = models.GrantAuthenticatedUser(ts.API.db, u, models.GrantParams{})
+	require.NoError(ts.T(), err)
+
+	ts.Config.Security.SingleSession = conf.SingleSessionConfiguration{
+		Roles:  []string{"support"},
+		Policy: conf.SingleSessionReject,
+	}
+	defer func() {
+		ts.Config.Security.SingleSession = conf.SingleSessionConfiguration{}
+	}()
+
+	// recovering the account signs the lost device out instead of being
+	// rejected
+	reqURL := fmt.Sprintf("http://localhost/verify?type=%s&token=%s", recoveryVerification, u.RecoveryToken)
+	req := httptest.NewRequest(http.MethodGet, reqURL, nil)
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusSeeOther, w.Code)
+
+	rurl, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(ts.T(), err)
+	f, err := url.ParseQuery(rurl.Fragment)
+	require.NoError(ts.T(), err)
+	require.NotEmpty(ts.T(), f.Get("access_token"))
+
+	sessions, err := models.FindSessionsByUserID(ts.API.db, u.ID)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), sessions, 1)
+}
+
+func (ts *VerifyTestSuite) TestVerifyPhoneChangeAuditEntries() {
+	u, err := models.FindUserByEmailAndAudience(ts.API.db, "test@example.com", ts.Config.JWT.Aud)
+	require.NoError(ts.T(), err)
+	u.Phone = "12345678"
+	u.PhoneChange = "1234567890"
+	u.PhoneChangeToken = fmt.Sprintf("%x", sha256.Sum224([]byte(u.PhoneChange+"123456")))
+	t := time.Now()
+	u.PhoneChangeSentAt = &t
+	require.NoError(ts.T(), ts.API.db.Update(u))
+
+	var buffer bytes.Buffer
+	require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(map[string]interface{}{
+		"type":  phoneChangeVerification,
+		"token": "123456",
+		"phone": u.PhoneChange,
+	}))
+	req := httptest.NewRequest(http.MethodPost, "http://localhost/verify", &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	// the phone change is still recorded as a sign up, like before the
+	// phone_changed event
+	for _, action := range []models.AuditAction{models.UserSignedUpAction, models.PhoneChangedAction} {
+		entries, err := models.FindAuditLogEntries(ts.API.db, []string{"action"}, string(action), nil)
+		require.NoError(ts.T(), err)
+		assert.Len(ts.T(), entries, 1, action)
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/observability"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// adminWebhookDeliveriesList lists the deliveries of the webhook outbox,
+// filtered by the status query parameter.
+func (a *API) adminWebhookDeliveriesList(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+
+	pageParams, err := paginate(r)
+	if err != nil {
+		return badRequestError("Bad Pagination Parameters: %v", err)
+	}
+
+	status := models.WebhookDeliveryStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryDead:
+	default:
+		return badRequestError("Unsupported webhook delivery status %q", status)
+	}
+
+	deliveries, err := models.FindWebhookDeliveries(db, status, pageParams)
+	if err != nil {
+		return internalServerError("Database error finding webhook deliveries").WithInternalError(err)
+	}
+
+	addPaginationHeaders(w, r, pageParams)
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"deliveries": deliveries,
+	})
+}
+
+// adminWebhookDeliveryReplay attempts again a dead delivery, with a fresh
+// set of attempts.
+func (a *API) adminWebhookDeliveryReplay(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+	adminUser := getAdminUser(ctx)
+
+	deliveryID, err := uuid.FromString(chi.URLParam(r, "delivery_id"))
+	if err != nil {
+		return notFoundError("Webhook delivery not found")
+	}
+
+	observability.LogEntrySetField(r, "delivery_id", deliveryID)
+
+	var delivery *models.WebhookDelivery
+	err = db.Transaction(func(tx *storage.Connection) error {
+		var terr error
+		delivery, terr = models.FindWebhookDeliveryByID(tx, deliveryID)
+		if terr != nil {
+			if models.IsNotFoundError(terr) {
+				return notFoundError("Webhook delivery not found")
+			}
+			return internalServerError("Database error finding webhook delivery").WithInternalError(terr)
+		}
+		// pending deliveries may be in flight, only the dead ones are
+		// attempted again
+		if delivery.Status != models.WebhookDeliveryDead {
+			return badRequestError("Only dead webhook deliveries can be replayed")
+		}
+
+		if terr := models.NewAuditLogEntry(r, tx, adminUser, models.WebhookDeliveryReplayedAction, "", map[string]interface{}{
+			"delivery_id": delivery.ID,
+			"event":       delivery.Event,
+			"url":         delivery.URL,
+			"attempts":    delivery.Attempts,
+		}); terr != nil {
+			return terr
+		}
+		if terr := delivery.Replay(tx); terr != nil {
+			return internalServerError("Database error replaying webhook delivery").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(w, http.StatusOK, delivery)
+}
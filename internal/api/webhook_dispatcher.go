@@ -0,0 +1,228 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/observability"
+	"github.com/supabase/gotrue/internal/storage"
+	"github.com/supabase/gotrue/internal/utilities"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// errWebhookEndpointDisabled is returned for a delivery claimed before its
+// endpoint was disabled, it isn't counted as an attempt.
+var errWebhookEndpointDisabled = errors.New("webhook endpoint is disabled")
+
+var webhookDeliveriesCounter = observability.ObtainMetricCounter("gotrue_webhook_deliveries", "Number of attempted deliveries of the webhook outbox")
+
+// StartWebhookDispatcher delivers the events of the webhook outbox every
+// poll interval until the context is done. The outbox isn't polled while
+// neither the webhook nor an endpoint is configured.
+func StartWebhookDispatcher(ctx context.Context, db *storage.Connection, config *conf.GlobalConfiguration) {
+	log := logrus.WithField("component", "webhook_dispatcher")
+
+	cleanupWaitGroup.Add(1)
+	go func() {
+		defer cleanupWaitGroup.Done()
+
+		ticker := time.NewTicker(config.Webhook.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			configured, err := webhooksConfigured(db.WithContext(ctx), config)
+			if err == nil && configured {
+				_, err = RunWebhookDispatch(ctx, db, config)
+			}
+			if err != nil && !errors.Is(err, context.Canceled) {
+				log.WithError(err).Error("webhook dispatch failed")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// webhooksConfigured reports whether events can be written to the outbox,
+// to the webhook of the configuration or to an enabled endpoint.
+func webhooksConfigured(db *storage.Connection, config *conf.GlobalConfiguration) (bool, error) {
+	if config.Webhook.URL != "" {
+		return true, nil
+	}
+	endpoints, err := enabledWebhookEndpoints.get(db)
+	if err != nil {
+		return false, err
+	}
+	return len(endpoints) > 0, nil
+}
+
+// RunWebhookDispatch delivers the due events of the outbox, in batches,
+// until none is left, and returns the number of attempted deliveries.
+// Failed deliveries are attempted again after an exponential backoff, and
+// moved to the dead state after the last attempt.
+func RunWebhookDispatch(ctx context.Context, db *storage.Connection, config *conf.GlobalConfiguration) (int, error) {
+	db = db.WithContext(ctx)
+	webhookConfig := config.Webhook
+
+	// the lease covers the deliveries of a whole batch to a single
+	// endpoint, queued behind the concurrency limit
+	timeout := defaultTimeout
+	if webhookConfig.TimeoutSec > 0 {
+		timeout = time.Duration(webhookConfig.TimeoutSec) * time.Second
+	}
+	// endpoints of the admin API can wait longer than the configuration
+	if endpointTimeout := maxWebhookEndpointTimeoutSec * time.Second; timeout < endpointTimeout {
+		timeout = endpointTimeout
+	}
+	lease := timeout * time.Duration(webhookConfig.BatchSize/webhookConfig.Concurrency+1)
+
+	attempted := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return attempted, err
+		}
+
+		var deliveries []*models.WebhookDelivery
+		err := db.Transaction(func(tx *storage.Connection) error {
+			var terr error
+			deliveries, terr = models.ClaimWebhookDeliveries(tx, time.Now(), lease, webhookConfig.BatchSize)
+			return terr
+		})
+		if err != nil {
+			return attempted, err
+		}
+
+		var wg sync.WaitGroup
+		endpoints := make(map[string]chan struct{})
+		for _, delivery := range deliveries {
+			// each endpoint gets its own slots, a slow endpoint can't hold
+			// back the deliveries to the others
+			slots, ok := endpoints[delivery.URL]
+			if !ok {
+				slots = make(chan struct{}, webhookConfig.Concurrency)
+				endpoints[delivery.URL] = slots
+			}
+
+			wg.Add(1)
+			go func(delivery *models.WebhookDelivery) {
+				defer wg.Done()
+				slots <- struct{}{}
+				defer func() { <-slots }()
+				deliverWebhook(ctx, db, config, delivery)
+			}(delivery)
+		}
+		wg.Wait()
+
+		attempted += len(deliveries)
+		if len(deliveries) < webhookConfig.BatchSize {
+			return attempted, nil
+		}
+	}
+}
+
+// deliverWebhook makes a single attempt of the delivery and records its
+// outcome.
+func deliverWebhook(ctx context.Context, db *storage.Connection, config *conf.GlobalConfiguration, delivery *models.WebhookDelivery) {
+	log := logrus.WithFields(logrus.Fields{
+		"component":   "webhook_dispatcher",
+		"delivery_id": delivery.ID,
+		"event":       delivery.Event,
+		"url":         delivery.URL,
+	})
+
+	webhookConfig, secrets, signingMode, err := webhookDeliveryTarget(db, config, delivery)
+	if errors.Is(err, errWebhookEndpointDisabled) {
+		// left pending, the dispatchers skip it until the endpoint is
+		// enabled again
+		log.Info("webhook endpoint is disabled, delivery postponed")
+		return
+	}
+	if err == nil {
+		err = postWebhookDelivery(webhookConfig, delivery, secrets, signingMode)
+	}
+	outcome := "delivered"
+	if err == nil {
+		err = delivery.MarkDelivered(db)
+	} else {
+		log.WithError(err).WithField("attempt", delivery.Attempts+1).Info("webhook delivery failed")
+		var nextAttemptAt *time.Time
+		if delivery.Attempts+1 < config.Webhook.MaxAttempts {
+			next := time.Now().Add(config.Webhook.NextAttempt(delivery.Attempts + 1))
+			nextAttemptAt = &next
+			outcome = "failed"
+		} else {
+			outcome = "dead"
+		}
+		err = delivery.MarkFailed(db, err.Error(), nextAttemptAt)
+	}
+	if err != nil {
+		log.WithError(err).Error("unable to record webhook delivery")
+		return
+	}
+
+	webhookDeliveriesCounter.Add(ctx, 1, attribute.String("outcome", outcome))
+}
+
+// webhookDeliveryTarget returns the settings, the signing secrets and the
+// signing mode of the receiver of the delivery.
+func webhookDeliveryTarget(db *storage.Connection, config *conf.GlobalConfiguration, delivery *models.WebhookDelivery) (*conf.WebhookConfig, []string, models.WebhookSigningMode, error) {
+	webhookConfig := config.Webhook
+	switch delivery.Kind {
+	case models.WebhookKindFunctionHook:
+		return &webhookConfig, []string{config.JWT.Secret}, models.WebhookSigningJWT, nil
+	case models.WebhookKindEndpoint:
+		if delivery.EndpointID == nil {
+			return nil, nil, "", errors.New("webhook delivery has no endpoint")
+		}
+		endpoint, err := models.FindWebhookEndpointByID(db, *delivery.EndpointID)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if !endpoint.Enabled {
+			return nil, nil, "", errWebhookEndpointDisabled
+		}
+		if endpoint.TimeoutSec > 0 {
+			webhookConfig.TimeoutSec = endpoint.TimeoutSec
+		}
+		return &webhookConfig, endpoint.Secrets(time.Now()), endpoint.SigningMode, nil
+	default:
+		return &webhookConfig, []string{config.Webhook.Secret}, models.WebhookSigningJWT, nil
+	}
+}
+
+// postWebhookDelivery sends the payload of the delivery once, the outbox
+// retries instead of the webhook.
+func postWebhookDelivery(config *conf.WebhookConfig, delivery *models.WebhookDelivery, secrets []string, signingMode models.WebhookSigningMode) error {
+	data, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		return err
+	}
+	w, err := newWebhook(config, delivery.URL, secrets, data)
+	if err != nil {
+		return err
+	}
+	if signingMode == models.WebhookSigningStandard {
+		// the delivery keeps its ID across attempts, so that receivers can
+		// tell the retries apart from new events
+		if err := w.useStandardSignatures(delivery.ID.String(), secrets); err != nil {
+			return err
+		}
+	}
+	w.Retries = 1
+
+	body, err := w.trigger()
+	if body != nil {
+		utilities.SafeClose(body)
+	}
+	return err
+}
@@ -0,0 +1,260 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+type WebhookOutboxTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.GlobalConfiguration
+}
+
+func TestWebhookOutbox(t *testing.T) {
+	api, config, err := setupAPIForTest()
+	require.NoError(t, err)
+
+	ts := &WebhookOutboxTestSuite{
+		API:    api,
+		Config: config,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *WebhookOutboxTestSuite) SetupTest() {
+	models.TruncateAll(ts.API.db)
+	enabledWebhookEndpoints.invalidate()
+}
+
+// enqueue triggers the signup event of a new user, in a transaction
+// committed unless rollback is set.
+func (ts *WebhookOutboxTestSuite) enqueue(rollback bool) {
+	u, err := models.NewUser("", "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+
+	errRollback := errors.New("rollback")
+	err = ts.API.db.Transaction(func(tx *storage.Connection) error {
+		if terr := tx.Create(u); terr != nil {
+			return terr
+		}
+		if terr := triggerEventHooks(context.Background(), tx, SignupEvent, u, ts.Config); terr != nil {
+			return terr
+		}
+		if rollback {
+			return errRollback
+		}
+		return nil
+	})
+	if rollback {
+		require.ErrorIs(ts.T(), err, errRollback)
+	} else {
+		require.NoError(ts.T(), err)
+	}
+}
+
+func (ts *WebhookOutboxTestSuite) deliveries(status models.WebhookDeliveryStatus) []*models.WebhookDelivery {
+	deliveries, err := models.FindWebhookDeliveries(ts.API.db, status, nil)
+	require.NoError(ts.T(), err)
+	return deliveries
+}
+
+func (ts *WebhookOutboxTestSuite) withWebhook(hookURL string) func() {
+	webhook := ts.Config.Webhook
+	ts.Config.Webhook.URL = hookURL
+	ts.Config.Webhook.Events = []string{SignupEvent}
+	ts.Config.Webhook.Blocking = false
+	ts.Config.Webhook.Backoff = time.Millisecond
+	ts.Config.Webhook.MaxBackoff = time.Millisecond
+	ts.Config.Webhook.MaxAttempts = 2
+	return func() {
+		ts.Config.Webhook = webhook
+	}
+}
+
+func (ts *WebhookOutboxTestSuite) TestEventsWrittenWithTransaction() {
+	defer ts.withWebhook("http://localhost/hook")()
+
+	ts.enqueue(true)
+	require.Empty(ts.T(), ts.deliveries(""))
+
+	ts.enqueue(false)
+	deliveries := ts.deliveries(models.WebhookDeliveryPending)
+	require.Len(ts.T(), deliveries, 1)
+	assert.Equal(ts.T(), SignupEvent, deliveries[0].Event)
+	assert.Equal(ts.T(), models.WebhookKindWebhook, deliveries[0].Kind)
+	assert.Equal(ts.T(), SignupEvent, deliveries[0].Payload["event"])
+}
+
+func (ts *WebhookOutboxTestSuite) TestDispatchDelivers() {
+	var mu sync.Mutex
+	var events []string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := map[string]interface{}{}
+		require.NoError(ts.T(), json.NewDecoder(r.Body).Decode(&data))
+		mu.Lock()
+		events = append(events, data["event"].(string))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+
+	// Allowing connection to localhost for the tests only
+	localhost := removeLocalhostFromPrivateIPBlock()
+	defer unshiftPrivateIPBlock(localhost)
+
+	defer ts.withWebhook(svr.URL)()
+	ts.enqueue(false)
+
+	attempted, err := RunWebhookDispatch(context.Background(), ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), 1, attempted)
+	assert.Equal(ts.T(), []string{SignupEvent}, events)
+
+	deliveries := ts.deliveries(models.WebhookDeliveryDelivered)
+	require.Len(ts.T(), deliveries, 1)
+	assert.Equal(ts.T(), 1, deliveries[0].Attempts)
+	assert.NotNil(ts.T(), deliveries[0].DeliveredAt)
+
+	// delivered events aren't sent again
+	attempted, err = RunWebhookDispatch(context.Background(), ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), 0, attempted)
+}
+
+func (ts *WebhookOutboxTestSuite) TestDeadLetterAndReplay() {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer svr.Close()
+
+	// Allowing connection to localhost for the tests only
+	localhost := removeLocalhostFromPrivateIPBlock()
+	defer unshiftPrivateIPBlock(localhost)
+
+	defer ts.withWebhook(svr.URL)()
+	ts.enqueue(false)
+
+	_, err := RunWebhookDispatch(context.Background(), ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	deliveries := ts.deliveries(models.WebhookDeliveryPending)
+	require.Len(ts.T(), deliveries, 1)
+	assert.Equal(ts.T(), 1, deliveries[0].Attempts)
+	assert.NotEmpty(ts.T(), deliveries[0].LastError)
+
+	token := ts.makeSuperAdmin()
+
+	// a pending delivery can't be replayed
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/webhooks/deliveries/%s/replay", deliveries[0].ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	// the second attempt is the last one
+	time.Sleep(10 * time.Millisecond)
+	_, err = RunWebhookDispatch(context.Background(), ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), ts.deliveries(models.WebhookDeliveryDead), 1)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/admin/webhooks/deliveries?status=dead", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	var list struct {
+		Deliveries []*models.WebhookDelivery `json:"deliveries"`
+	}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&list))
+	require.Len(ts.T(), list.Deliveries, 1)
+	dead := list.Deliveries[0]
+	assert.Equal(ts.T(), 2, dead.Attempts)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, fmt.Sprintf("/admin/webhooks/deliveries/%s/replay", dead.ID), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	replayed, err := models.FindWebhookDeliveryByID(ts.API.db, dead.ID)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), models.WebhookDeliveryPending, replayed.Status)
+	assert.Equal(ts.T(), 0, replayed.Attempts)
+
+	entries, err := models.FindAuditLogEntries(ts.API.db, []string{"action"}, string(models.WebhookDeliveryReplayedAction), nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), entries, 1)
+}
+
+func (ts *WebhookOutboxTestSuite) TestWebhooksConfigured() {
+	configured, err := webhooksConfigured(ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	assert.False(ts.T(), configured)
+
+	endpoint, err := models.NewWebhookEndpoint("http://localhost/endpoint", "secret", []string{SignupEvent}, 0)
+	require.NoError(ts.T(), err)
+	endpoint.Enabled = false
+	require.NoError(ts.T(), ts.API.db.Create(endpoint))
+	enabledWebhookEndpoints.invalidate()
+	configured, err = webhooksConfigured(ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	assert.False(ts.T(), configured)
+
+	endpoint.Enabled = true
+	require.NoError(ts.T(), ts.API.db.UpdateOnly(endpoint, "enabled"))
+	enabledWebhookEndpoints.invalidate()
+	configured, err = webhooksConfigured(ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), configured)
+
+	require.NoError(ts.T(), ts.API.db.Destroy(endpoint))
+	enabledWebhookEndpoints.invalidate()
+	defer ts.withWebhook("http://localhost/hook")()
+	configured, err = webhooksConfigured(ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	assert.True(ts.T(), configured)
+}
+
+func (ts *WebhookOutboxTestSuite) TestListUnknownStatus() {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin/webhooks/deliveries?status=lost", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.makeSuperAdmin()))
+	ts.API.handler.ServeHTTP(w, req)
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *WebhookOutboxTestSuite) makeSuperAdmin() string {
+	u, err := models.NewUser("", "admin@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+
+	u.Role = "supabase_admin"
+
+	token, err := ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
+	require.NoError(ts.T(), err, "Error generating access token")
+
+	p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+	_, err = p.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		return []byte(ts.Config.JWT.Secret), nil
+	})
+	require.NoError(ts.T(), err, "Error parsing token")
+
+	return token
+}
@@ -0,0 +1,424 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/gofrs/uuid"
+	"github.com/supabase/gotrue/client/webhooks"
+	"github.com/supabase/gotrue/internal/crypto"
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/observability"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// maxWebhookEndpointTimeoutSec bounds the timeout of the endpoints, the
+// leases of the dispatcher are computed from it.
+const maxWebhookEndpointTimeoutSec = 30
+
+// minWebhookSecretLength is the shortest secret accepted from the caller,
+// generated secrets are longer.
+const minWebhookSecretLength = 16
+
+// webhookEndpointsCacheTTL bounds how long the enabled endpoints are
+// reused without being read again. Admin writes reset the cache of their
+// own replica, the other replicas see them once it expires.
+const webhookEndpointsCacheTTL = 10 * time.Second
+
+// enabledWebhookEndpoints caches the endpoints that receive events, so that
+// the transactions reporting events don't all read them.
+var enabledWebhookEndpoints = &webhookEndpointsCache{}
+
+type webhookEndpointsCache struct {
+	mu        sync.Mutex
+	endpoints []*models.WebhookEndpoint
+	expiresAt time.Time
+}
+
+// get returns the enabled endpoints, read with conn once the cache has
+// expired. The endpoints are shared and must not be modified.
+func (c *webhookEndpointsCache) get(conn *storage.Connection) ([]*models.WebhookEndpoint, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(c.expiresAt) {
+		return c.endpoints, nil
+	}
+	endpoints, err := models.FindEnabledWebhookEndpoints(conn)
+	if err != nil {
+		return nil, err
+	}
+	c.endpoints = endpoints
+	c.expiresAt = now.Add(webhookEndpointsCacheTTL)
+	return endpoints, nil
+}
+
+// invalidate makes the next get read the endpoints again, it is called
+// once the change of an endpoint is committed.
+func (c *webhookEndpointsCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.endpoints = nil
+	c.expiresAt = time.Time{}
+}
+
+type WebhookEndpointParams struct {
+	URL        string   `json:"url"`
+	Secret     string   `json:"secret"`
+	Events     []string `json:"events"`
+	TimeoutSec *int     `json:"timeout_sec"`
+	Enabled    *bool    `json:"enabled"`
+	// SigningMode defaults to jwt for new endpoints.
+	SigningMode models.WebhookSigningMode `json:"signing_mode"`
+}
+
+func (p *WebhookEndpointParams) validate(forUpdate bool) error {
+	if !forUpdate && p.URL == "" {
+		return badRequestError("url is required")
+	}
+	if p.URL != "" {
+		endpointURL, err := url.ParseRequestURI(p.URL)
+		if err != nil || endpointURL.Host == "" {
+			return badRequestError("url is not a valid URL")
+		}
+		if endpointURL.Scheme != "http" && endpointURL.Scheme != "https" {
+			return badRequestError("url is not a HTTP or HTTPS URL")
+		}
+	}
+	if forUpdate && p.Secret != "" {
+		return badRequestError("The secret of a webhook endpoint is changed with rotate_secret")
+	}
+	switch p.SigningMode {
+	case "", models.WebhookSigningJWT, models.WebhookSigningStandard:
+	default:
+		return badRequestError("Unsupported webhook signing mode %q", p.SigningMode)
+	}
+	if p.Secret != "" {
+		signingMode := p.SigningMode
+		if signingMode == "" {
+			signingMode = models.WebhookSigningJWT
+		}
+		if err := validateWebhookSecret(signingMode, p.Secret); err != nil {
+			return err
+		}
+	}
+	for _, event := range p.Events {
+		if _, ok := hookEventVersions[HookEvent(event)]; !ok || event == ValidateEvent {
+			return badRequestError("Unsupported webhook event %q", event)
+		}
+	}
+	if p.TimeoutSec != nil && (*p.TimeoutSec < 0 || *p.TimeoutSec > maxWebhookEndpointTimeoutSec) {
+		return badRequestError("timeout_sec must be between 0 and %d", maxWebhookEndpointTimeoutSec)
+	}
+	return nil
+}
+
+// validateWebhookSecret checks that the secret can sign the requests of
+// the signing mode.
+func validateWebhookSecret(signingMode models.WebhookSigningMode, secret string) error {
+	if signingMode == models.WebhookSigningStandard {
+		if _, err := webhooks.NewWebhook(secret); err != nil || !strings.HasPrefix(secret, webhooks.SecretPrefix) {
+			return badRequestError("secret must be a Standard Webhooks secret, %s followed by the key in base64", webhooks.SecretPrefix)
+		}
+		return nil
+	}
+	if len(secret) < minWebhookSecretLength {
+		return badRequestError("secret must be at least %d characters", minWebhookSecretLength)
+	}
+	return nil
+}
+
+// newWebhookSecret generates a secret for the signing mode.
+func newWebhookSecret(signingMode models.WebhookSigningMode) (string, error) {
+	if signingMode == models.WebhookSigningStandard {
+		return webhooks.NewSecret()
+	}
+	return crypto.SecureToken(32), nil
+}
+
+// webhookEndpointWithSecret shows the secret of the endpoint, only after
+// it was set.
+type webhookEndpointWithSecret struct {
+	*models.WebhookEndpoint
+	Secret string `json:"secret"`
+}
+
+// loadWebhookEndpoint looks for an endpoint_id parameter in the URL route
+// and loads the webhook endpoint with that ID into the context.
+func (a *API) loadWebhookEndpoint(w http.ResponseWriter, r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+
+	endpointID, err := uuid.FromString(chi.URLParam(r, "endpoint_id"))
+	if err != nil {
+		return nil, notFoundError("Webhook endpoint not found")
+	}
+
+	endpoint, err := models.FindWebhookEndpointByID(db, endpointID)
+	if err != nil {
+		if models.IsNotFoundError(err) {
+			return nil, notFoundError("Webhook endpoint not found")
+		}
+		return nil, internalServerError("Database error finding webhook endpoint").WithInternalError(err)
+	}
+
+	observability.LogEntrySetField(r, "webhook_endpoint_id", endpoint.ID.String())
+
+	return withWebhookEndpoint(ctx, endpoint), nil
+}
+
+// adminWebhookEndpointsList lists the webhook endpoints, without their
+// secrets.
+func (a *API) adminWebhookEndpointsList(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+
+	endpoints, err := models.FindWebhookEndpoints(db)
+	if err != nil {
+		return internalServerError("Database error finding webhook endpoints").WithInternalError(err)
+	}
+
+	return sendJSON(w, http.StatusOK, map[string]interface{}{
+		"endpoints": endpoints,
+	})
+}
+
+// adminWebhookEndpointsCreate creates a webhook endpoint, its secret is
+// generated unless one is given and is only returned in the response.
+func (a *API) adminWebhookEndpointsCreate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+	adminUser := getAdminUser(ctx)
+
+	params, err := getWebhookEndpointParams(r)
+	if err != nil {
+		return err
+	}
+	if err := params.validate(false /* <- forUpdate */); err != nil {
+		return err
+	}
+
+	signingMode := params.SigningMode
+	if signingMode == "" {
+		signingMode = models.WebhookSigningJWT
+	}
+	secret := params.Secret
+	if secret == "" {
+		if secret, err = newWebhookSecret(signingMode); err != nil {
+			return internalServerError("Error generating webhook secret").WithInternalError(err)
+		}
+	}
+	timeoutSec := 0
+	if params.TimeoutSec != nil {
+		timeoutSec = *params.TimeoutSec
+	}
+
+	endpoint, err := models.NewWebhookEndpoint(params.URL, secret, params.Events, timeoutSec)
+	if err != nil {
+		return internalServerError("Error creating webhook endpoint").WithInternalError(err)
+	}
+	if params.Enabled != nil {
+		endpoint.Enabled = *params.Enabled
+	}
+	endpoint.SigningMode = signingMode
+
+	err = db.Transaction(func(tx *storage.Connection) error {
+		if terr := tx.Create(endpoint); terr != nil {
+			return internalServerError("Database error saving webhook endpoint").WithInternalError(terr)
+		}
+		return models.NewAuditLogEntry(r, tx, adminUser, models.WebhookEndpointCreatedAction, "", map[string]interface{}{
+			"endpoint_id":  endpoint.ID,
+			"url":          endpoint.URL,
+			"events":       endpoint.Events,
+			"signing_mode": endpoint.SigningMode,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	enabledWebhookEndpoints.invalidate()
+
+	return sendJSON(w, http.StatusCreated, &webhookEndpointWithSecret{
+		WebhookEndpoint: endpoint,
+		Secret:          secret,
+	})
+}
+
+// adminWebhookEndpointsGet returns a webhook endpoint, without its secret.
+func (a *API) adminWebhookEndpointsGet(w http.ResponseWriter, r *http.Request) error {
+	return sendJSON(w, http.StatusOK, getWebhookEndpoint(r.Context()))
+}
+
+// adminWebhookEndpointsUpdate updates the URL, events, timeout, enabled
+// flag or signing mode of a webhook endpoint, the fields left out are kept.
+func (a *API) adminWebhookEndpointsUpdate(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+	adminUser := getAdminUser(ctx)
+	endpoint := getWebhookEndpoint(ctx)
+
+	params, err := getWebhookEndpointParams(r)
+	if err != nil {
+		return err
+	}
+	if err := params.validate(true /* <- forUpdate */); err != nil {
+		return err
+	}
+
+	if params.URL != "" {
+		endpoint.URL = params.URL
+	}
+	// events are updated only when they are not nil, `[]` sends all the
+	// events to the endpoint
+	if params.Events != nil {
+		endpoint.Events = models.WebhookEvents(params.Events)
+	}
+	if params.TimeoutSec != nil {
+		endpoint.TimeoutSec = *params.TimeoutSec
+	}
+	if params.Enabled != nil {
+		endpoint.Enabled = *params.Enabled
+	}
+	if params.SigningMode != "" && params.SigningMode != endpoint.SigningMode {
+		// the secret isn't changed with the mode, receivers would reject
+		// the requests until they get the new secret
+		if err := validateWebhookSecret(params.SigningMode, endpoint.Secret); err != nil {
+			return badRequestError("The secret of the webhook endpoint can't sign in the %s mode, rotate it to a secret of this mode first", params.SigningMode)
+		}
+		endpoint.SigningMode = params.SigningMode
+	}
+
+	err = db.Transaction(func(tx *storage.Connection) error {
+		if terr := tx.UpdateOnly(endpoint, "url", "events", "timeout_sec", "enabled", "signing_mode", "updated_at"); terr != nil {
+			return internalServerError("Database error updating webhook endpoint").WithInternalError(terr)
+		}
+		return models.NewAuditLogEntry(r, tx, adminUser, models.WebhookEndpointUpdatedAction, "", map[string]interface{}{
+			"endpoint_id":  endpoint.ID,
+			"url":          endpoint.URL,
+			"events":       endpoint.Events,
+			"enabled":      endpoint.Enabled,
+			"signing_mode": endpoint.SigningMode,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	enabledWebhookEndpoints.invalidate()
+
+	return sendJSON(w, http.StatusOK, endpoint)
+}
+
+// adminWebhookEndpointsDelete deletes a webhook endpoint, its deliveries
+// are deleted with it.
+func (a *API) adminWebhookEndpointsDelete(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+	adminUser := getAdminUser(ctx)
+	endpoint := getWebhookEndpoint(ctx)
+
+	err := db.Transaction(func(tx *storage.Connection) error {
+		if terr := models.NewAuditLogEntry(r, tx, adminUser, models.WebhookEndpointDeletedAction, "", map[string]interface{}{
+			"endpoint_id": endpoint.ID,
+			"url":         endpoint.URL,
+		}); terr != nil {
+			return terr
+		}
+		if terr := tx.Destroy(endpoint); terr != nil {
+			return internalServerError("Database error deleting webhook endpoint").WithInternalError(terr)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	enabledWebhookEndpoints.invalidate()
+
+	return sendJSON(w, http.StatusOK, endpoint)
+}
+
+type RotateWebhookSecretParams struct {
+	Secret string `json:"secret"`
+	// OverlapSec is how long the replaced secret keeps signing the
+	// requests, WEBHOOK_ROTATION_OVERLAP when left out.
+	OverlapSec *int `json:"overlap_sec"`
+}
+
+// adminWebhookEndpointsRotateSecret replaces the secret of a webhook
+// endpoint. Requests are signed with both secrets during the overlap, so
+// that the receiver can switch without rejecting deliveries.
+func (a *API) adminWebhookEndpointsRotateSecret(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	db := a.db.WithContext(ctx)
+	config := a.config
+	adminUser := getAdminUser(ctx)
+	endpoint := getWebhookEndpoint(ctx)
+
+	body, err := getBodyBytes(r)
+	if err != nil {
+		return internalServerError("Unable to read request body").WithInternalError(err)
+	}
+	params := &RotateWebhookSecretParams{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, params); err != nil {
+			return badRequestError("Unable to parse JSON").WithInternalError(err)
+		}
+	}
+
+	if params.Secret != "" {
+		if err := validateWebhookSecret(endpoint.SigningMode, params.Secret); err != nil {
+			return err
+		}
+	}
+	overlap := config.Webhook.RotationOverlap
+	if params.OverlapSec != nil {
+		if *params.OverlapSec < 0 {
+			return badRequestError("overlap_sec must not be negative")
+		}
+		overlap = time.Duration(*params.OverlapSec) * time.Second
+	}
+
+	secret := params.Secret
+	if secret == "" {
+		if secret, err = newWebhookSecret(endpoint.SigningMode); err != nil {
+			return internalServerError("Error generating webhook secret").WithInternalError(err)
+		}
+	}
+
+	err = db.Transaction(func(tx *storage.Connection) error {
+		if terr := endpoint.RotateSecret(tx, secret, overlap); terr != nil {
+			return internalServerError("Database error rotating webhook secret").WithInternalError(terr)
+		}
+		return models.NewAuditLogEntry(r, tx, adminUser, models.WebhookSecretRotatedAction, "", map[string]interface{}{
+			"endpoint_id":                endpoint.ID,
+			"previous_secret_expires_at": endpoint.PreviousSecretExpiresAt,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	enabledWebhookEndpoints.invalidate()
+
+	return sendJSON(w, http.StatusOK, &webhookEndpointWithSecret{
+		WebhookEndpoint: endpoint,
+		Secret:          secret,
+	})
+}
+
+func getWebhookEndpointParams(r *http.Request) (*WebhookEndpointParams, error) {
+	body, err := getBodyBytes(r)
+	if err != nil {
+		return nil, internalServerError("Unable to read request body").WithInternalError(err)
+	}
+	params := &WebhookEndpointParams{}
+	if err := json.Unmarshal(body, params); err != nil {
+		return nil, badRequestError("Unable to parse JSON").WithInternalError(err)
+	}
+	return params, nil
+}
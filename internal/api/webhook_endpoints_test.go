@@ -0,0 +1,410 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid"
+	jwt "github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/supabase/gotrue/client/webhooks"
+	"github.com/supabase/gotrue/internal/conf"
+	"github.com/supabase/gotrue/internal/models"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+type WebhookEndpointsTestSuite struct {
+	suite.Suite
+	API    *API
+	Config *conf.GlobalConfiguration
+}
+
+func TestWebhookEndpoints(t *testing.T) {
+	api, config, err := setupAPIForTest()
+	require.NoError(t, err)
+
+	ts := &WebhookEndpointsTestSuite{
+		API:    api,
+		Config: config,
+	}
+	defer api.db.Close()
+
+	suite.Run(t, ts)
+}
+
+func (ts *WebhookEndpointsTestSuite) SetupTest() {
+	models.TruncateAll(ts.API.db)
+	enabledWebhookEndpoints.invalidate()
+	ts.Config.Webhook.URL = ""
+}
+
+func (ts *WebhookEndpointsTestSuite) request(method, path string, body map[string]interface{}) *httptest.ResponseRecorder {
+	var buffer bytes.Buffer
+	if body != nil {
+		require.NoError(ts.T(), json.NewEncoder(&buffer).Encode(body))
+	}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, &buffer)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ts.makeSuperAdmin()))
+	ts.API.handler.ServeHTTP(w, req)
+	return w
+}
+
+func (ts *WebhookEndpointsTestSuite) create(body map[string]interface{}) map[string]interface{} {
+	w := ts.request(http.MethodPost, "/admin/webhooks", body)
+	require.Equal(ts.T(), http.StatusCreated, w.Code, w.Body.String())
+	data := map[string]interface{}{}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&data))
+	return data
+}
+
+func (ts *WebhookEndpointsTestSuite) TestCreateListUpdateDelete() {
+	created := ts.create(map[string]interface{}{
+		"url":    "https://example.com/hook",
+		"events": []string{SignupEvent},
+	})
+	assert.NotEmpty(ts.T(), created["secret"])
+	assert.Equal(ts.T(), true, created["enabled"])
+	id := created["id"].(string)
+
+	w := ts.request(http.MethodGet, "/admin/webhooks", nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+	var list struct {
+		Endpoints []map[string]interface{} `json:"endpoints"`
+	}
+	require.NoError(ts.T(), json.NewDecoder(w.Body).Decode(&list))
+	require.Len(ts.T(), list.Endpoints, 1)
+	assert.NotContains(ts.T(), list.Endpoints[0], "secret")
+
+	w = ts.request(http.MethodPut, "/admin/webhooks/"+id, map[string]interface{}{
+		"events":      []string{LogoutEvent, UserDeletedEvent},
+		"timeout_sec": 10,
+		"enabled":     false,
+	})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	endpoint, err := models.FindWebhookEndpointByID(ts.API.db, uuid.Must(uuid.FromString(id)))
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), "https://example.com/hook", endpoint.URL)
+	assert.Equal(ts.T(), models.WebhookEvents{LogoutEvent, UserDeletedEvent}, endpoint.Events)
+	assert.Equal(ts.T(), 10, endpoint.TimeoutSec)
+	assert.False(ts.T(), endpoint.Enabled)
+
+	w = ts.request(http.MethodDelete, "/admin/webhooks/"+id, nil)
+	require.Equal(ts.T(), http.StatusOK, w.Code)
+
+	w = ts.request(http.MethodGet, "/admin/webhooks/"+id, nil)
+	require.Equal(ts.T(), http.StatusNotFound, w.Code)
+
+	entries, err := models.FindAuditLogEntries(ts.API.db, []string{"action"}, string(models.WebhookEndpointCreatedAction), nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), entries, 1)
+}
+
+func (ts *WebhookEndpointsTestSuite) TestInvalidParams() {
+	cases := map[string]map[string]interface{}{
+		"missing url":     {"events": []string{SignupEvent}},
+		"relative url":    {"url": "/hook"},
+		"ftp url":         {"url": "ftp://example.com/hook"},
+		"unknown event":   {"url": "https://example.com/hook", "events": []string{"unknown"}},
+		"validate event":  {"url": "https://example.com/hook", "events": []string{ValidateEvent}},
+		"short secret":    {"url": "https://example.com/hook", "secret": "short"},
+		"timeout too big": {"url": "https://example.com/hook", "timeout_sec": maxWebhookEndpointTimeoutSec + 1},
+	}
+	for name, body := range cases {
+		w := ts.request(http.MethodPost, "/admin/webhooks", body)
+		assert.Equal(ts.T(), http.StatusBadRequest, w.Code, name)
+	}
+
+	created := ts.create(map[string]interface{}{"url": "https://example.com/hook"})
+	w := ts.request(http.MethodPut, fmt.Sprintf("/admin/webhooks/%s", created["id"]), map[string]interface{}{
+		"secret": "a-new-secret-set-through-update",
+	})
+	assert.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *WebhookEndpointsTestSuite) TestDispatchSignedWithRotatedSecrets() {
+	var mu sync.Mutex
+	var events []string
+	var signatures []string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := map[string]interface{}{}
+		require.NoError(ts.T(), json.NewDecoder(r.Body).Decode(&data))
+		mu.Lock()
+		events = append(events, data["event"].(string))
+		signatures = r.Header.Values(headerHookSignature)
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+
+	// Allowing connection to localhost for the tests only
+	localhost := removeLocalhostFromPrivateIPBlock()
+	defer unshiftPrivateIPBlock(localhost)
+
+	created := ts.create(map[string]interface{}{
+		"url":    svr.URL,
+		"secret": "the-first-secret-of-the-endpoint",
+		"events": []string{SignupEvent},
+	})
+	ignored := ts.create(map[string]interface{}{
+		"url":    svr.URL + "/logout",
+		"events": []string{LogoutEvent},
+	})
+
+	w := ts.request(http.MethodPost, fmt.Sprintf("/admin/webhooks/%s/rotate_secret", created["id"]), map[string]interface{}{
+		"secret":      "the-second-secret-of-the-endpoint",
+		"overlap_sec": 3600,
+	})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	u, err := models.NewUser("", "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Transaction(func(tx *storage.Connection) error {
+		if terr := tx.Create(u); terr != nil {
+			return terr
+		}
+		return triggerEventHooks(context.Background(), tx, SignupEvent, u, ts.Config)
+	}))
+
+	deliveries, err := models.FindWebhookDeliveries(ts.API.db, models.WebhookDeliveryPending, nil)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), deliveries, 1)
+	assert.Equal(ts.T(), models.WebhookKindEndpoint, deliveries[0].Kind)
+	require.NotNil(ts.T(), deliveries[0].EndpointID)
+	assert.Equal(ts.T(), created["id"], deliveries[0].EndpointID.String())
+	assert.NotEqual(ts.T(), ignored["id"], deliveries[0].EndpointID.String())
+
+	attempted, err := RunWebhookDispatch(context.Background(), ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), 1, attempted)
+	assert.Equal(ts.T(), []string{SignupEvent}, events)
+
+	// the receiver accepts either secret during the overlap
+	require.Len(ts.T(), signatures, 2)
+	for i, secret := range []string{"the-second-secret-of-the-endpoint", "the-first-secret-of-the-endpoint"} {
+		p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+		_, err := p.Parse(signatures[i], func(token *jwt.Token) (interface{}, error) {
+			return []byte(secret), nil
+		})
+		assert.NoError(ts.T(), err, "signature %d", i)
+	}
+}
+
+func (ts *WebhookEndpointsTestSuite) TestDisabledEndpointKeepsDeliveries() {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+
+	// Allowing connection to localhost for the tests only
+	localhost := removeLocalhostFromPrivateIPBlock()
+	defer unshiftPrivateIPBlock(localhost)
+
+	created := ts.create(map[string]interface{}{"url": svr.URL})
+	id := created["id"].(string)
+	endpoint, err := models.FindWebhookEndpointByID(ts.API.db, uuid.Must(uuid.FromString(id)))
+	require.NoError(ts.T(), err)
+
+	delivery, err := models.NewWebhookDelivery(SignupEvent, models.WebhookKindEndpoint, endpoint.URL, map[string]interface{}{"event": SignupEvent})
+	require.NoError(ts.T(), err)
+	delivery.EndpointID = &endpoint.ID
+	require.NoError(ts.T(), ts.API.db.Create(delivery))
+
+	w := ts.request(http.MethodPut, "/admin/webhooks/"+id, map[string]interface{}{"enabled": false})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	// the dispatchers skip the deliveries of the disabled endpoint
+	attempted, err := RunWebhookDispatch(context.Background(), ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), 0, attempted)
+
+	// a delivery claimed before the endpoint was disabled isn't attempted
+	deliverWebhook(context.Background(), ts.API.db, ts.Config, delivery)
+	pending, err := models.FindWebhookDeliveryByID(ts.API.db, delivery.ID)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), models.WebhookDeliveryPending, pending.Status)
+	assert.Equal(ts.T(), 0, pending.Attempts)
+
+	w = ts.request(http.MethodPut, "/admin/webhooks/"+id, map[string]interface{}{"enabled": true})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	attempted, err = RunWebhookDispatch(context.Background(), ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), 1, attempted)
+	delivered, err := models.FindWebhookDeliveryByID(ts.API.db, delivery.ID)
+	require.NoError(ts.T(), err)
+	assert.Equal(ts.T(), models.WebhookDeliveryDelivered, delivered.Status)
+	assert.Equal(ts.T(), 1, delivered.Attempts)
+}
+
+func (ts *WebhookEndpointsTestSuite) TestEnabledEndpointsCached() {
+	created := ts.create(map[string]interface{}{"url": "https://example.com/hook"})
+
+	endpoints, err := enabledWebhookEndpoints.get(ts.API.db)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), endpoints, 1)
+
+	// changes outside of the admin API are seen once the cache expires
+	require.NoError(ts.T(), ts.API.db.RawQuery("update "+models.WebhookEndpoint{}.TableName()+" set enabled = false").Exec())
+	endpoints, err = enabledWebhookEndpoints.get(ts.API.db)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), endpoints, 1)
+
+	// admin writes reset the cache
+	w := ts.request(http.MethodPut, fmt.Sprintf("/admin/webhooks/%s", created["id"]), map[string]interface{}{"enabled": false})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+	endpoints, err = enabledWebhookEndpoints.get(ts.API.db)
+	require.NoError(ts.T(), err)
+	require.Empty(ts.T(), endpoints)
+}
+
+func (ts *WebhookEndpointsTestSuite) TestDeletedEndpointStillCached() {
+	ts.create(map[string]interface{}{"url": "https://example.com/hook"})
+	endpoints, err := enabledWebhookEndpoints.get(ts.API.db)
+	require.NoError(ts.T(), err)
+	require.Len(ts.T(), endpoints, 1)
+
+	// deleted by another replica, the events are no longer written for it
+	require.NoError(ts.T(), ts.API.db.Destroy(endpoints[0]))
+
+	u, err := models.NewUser("", "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Transaction(func(tx *storage.Connection) error {
+		if terr := tx.Create(u); terr != nil {
+			return terr
+		}
+		return triggerEventHooks(context.Background(), tx, SignupEvent, u, ts.Config)
+	}))
+
+	deliveries, err := models.FindWebhookDeliveries(ts.API.db, "", nil)
+	require.NoError(ts.T(), err)
+	require.Empty(ts.T(), deliveries)
+}
+
+func (ts *WebhookEndpointsTestSuite) TestDispatchStandardSignatures() {
+	var mu sync.Mutex
+	var verified []error
+	var secret string
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(ts.T(), err)
+		wh, err := webhooks.NewWebhook(secret)
+		require.NoError(ts.T(), err)
+		mu.Lock()
+		verified = append(verified, wh.Verify(body, r.Header))
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer svr.Close()
+
+	// Allowing connection to localhost for the tests only
+	localhost := removeLocalhostFromPrivateIPBlock()
+	defer unshiftPrivateIPBlock(localhost)
+
+	created := ts.create(map[string]interface{}{
+		"url":          svr.URL,
+		"signing_mode": models.WebhookSigningStandard,
+	})
+	assert.Equal(ts.T(), string(models.WebhookSigningStandard), created["signing_mode"])
+	secret = created["secret"].(string)
+	assert.True(ts.T(), strings.HasPrefix(secret, webhooks.SecretPrefix))
+
+	// jwt secrets can't be set on standard endpoints
+	w := ts.request(http.MethodPost, fmt.Sprintf("/admin/webhooks/%s/rotate_secret", created["id"]), map[string]interface{}{
+		"secret": "a-secret-that-is-not-standard",
+	})
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	u, err := models.NewUser("", "test@example.com", "password", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err)
+	require.NoError(ts.T(), ts.API.db.Transaction(func(tx *storage.Connection) error {
+		if terr := tx.Create(u); terr != nil {
+			return terr
+		}
+		return triggerEventHooks(context.Background(), tx, SignupEvent, u, ts.Config)
+	}))
+
+	attempted, err := RunWebhookDispatch(context.Background(), ts.API.db, ts.Config)
+	require.NoError(ts.T(), err)
+	require.Equal(ts.T(), 1, attempted)
+	require.Len(ts.T(), verified, 1)
+	assert.NoError(ts.T(), verified[0])
+}
+
+func (ts *WebhookEndpointsTestSuite) TestChangeSigningMode() {
+	created := ts.create(map[string]interface{}{"url": "https://example.com/hook"})
+	assert.Equal(ts.T(), string(models.WebhookSigningJWT), created["signing_mode"])
+	path := fmt.Sprintf("/admin/webhooks/%s", created["id"])
+
+	// the generated jwt secret isn't a Standard Webhooks secret
+	w := ts.request(http.MethodPut, path, map[string]interface{}{"signing_mode": models.WebhookSigningStandard})
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+
+	standardSecret, err := webhooks.NewSecret()
+	require.NoError(ts.T(), err)
+	w = ts.request(http.MethodPost, path+"/rotate_secret", map[string]interface{}{"secret": standardSecret})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	w = ts.request(http.MethodPut, path, map[string]interface{}{"signing_mode": models.WebhookSigningStandard})
+	require.Equal(ts.T(), http.StatusOK, w.Code, w.Body.String())
+
+	w = ts.request(http.MethodPut, path, map[string]interface{}{"signing_mode": "hmac"})
+	require.Equal(ts.T(), http.StatusBadRequest, w.Code)
+}
+
+func (ts *WebhookEndpointsTestSuite) makeSuperAdmin() string {
+	u, err := models.NewUser("", "admin@example.com", "test", ts.Config.JWT.Aud, nil)
+	require.NoError(ts.T(), err, "Error making new user")
+
+	u.Role = "supabase_admin"
+
+	token, err := ts.API.generateAccessToken(passwordGrantRequest(), ts.API.db, u, nil, models.PasswordGrant)
+	require.NoError(ts.T(), err, "Error generating access token")
+
+	return token
+}
+
+func TestWebhookStandardSignatures(t *testing.T) {
+	current, err := webhooks.NewSecret()
+	require.NoError(t, err)
+	previous, err := webhooks.NewSecret()
+	require.NoError(t, err)
+
+	payload := []byte(`{"event":"signup"}`)
+	w, err := newWebhook(&conf.WebhookConfig{}, "https://example.com/hook", []string{current, previous}, payload)
+	require.NoError(t, err)
+	require.NoError(t, w.useStandardSignatures("delivery-id", []string{current, previous}))
+
+	req := httptest.NewRequest(http.MethodPost, "https://example.com/hook", nil)
+	w.setStandardSignatures(req, time.Now())
+	assert.Equal(t, "delivery-id", req.Header.Get(webhooks.HeaderID))
+	assert.Len(t, strings.Fields(req.Header.Get(webhooks.HeaderSignature)), 2)
+	assert.Empty(t, req.Header.Get(headerHookSignature))
+
+	// the receiver accepts either secret during the overlap
+	for _, secret := range []string{current, previous} {
+		wh, err := webhooks.NewWebhook(secret)
+		require.NoError(t, err)
+		assert.NoError(t, wh.Verify(payload, req.Header))
+	}
+
+	// a previous jwt secret isn't used, a current one fails the delivery
+	w, err = newWebhook(&conf.WebhookConfig{}, "https://example.com/hook", nil, payload)
+	require.NoError(t, err)
+	require.NoError(t, w.useStandardSignatures("delivery-id", []string{current, "a-previous-jwt-secret"}))
+	assert.Len(t, w.standardSecrets, 1)
+	assert.Error(t, w.useStandardSignatures("delivery-id", []string{"a-current-jwt-secret"}))
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 )
 
 const defaultMinPasswordLength int = 6
+const defaultMaxPasswordLength int = 72
 const defaultChallengeExpiryDuration float64 = 300
 const defaultFlowStateExpiryDuration time.Duration = 300 * time.Second
 
@@ -57,6 +59,7 @@ type JWTConfiguration struct {
 	AdminGroupName   string   `json:"admin_group_name" split_words:"true"`
 	AdminRoles       []string `json:"admin_roles" split_words:"true"`
 	DefaultGroupName string   `json:"default_group_name" split_words:"true"`
+	Keys             JWTKeys  `json:"-"`
 }
 
 // MFAConfiguration holds all the MFA related Configuration
@@ -66,6 +69,16 @@ type MFAConfiguration struct {
 	RateLimitChallengeAndVerify float64 `split_words:"true" default:"15"`
 	MaxEnrolledFactors          float64 `split_words:"true" default:"10"`
 	MaxVerifiedFactors          int     `split_words:"true" default:"10"`
+
+	WebAuthn WebAuthnConfiguration `json:"webauthn"`
+}
+
+// WebAuthnConfiguration is the relying party of the webauthn factors, the
+// host and the origin of the site URL when left out.
+type WebAuthnConfiguration struct {
+	RPID          string `json:"rp_id" envconfig:"RP_ID"`
+	RPOrigin      string `json:"rp_origin" envconfig:"RP_ORIGIN"`
+	RPDisplayName string `json:"rp_display_name" envconfig:"RP_DISPLAY_NAME"`
 }
 
 type APIConfiguration struct {
@@ -111,14 +124,20 @@ type GlobalConfiguration struct {
 	IosSiteURL        string   `json:"ios_site_url" split_words:"true" required:"true"`
 	URIAllowList      []string `json:"uri_allow_list" split_words:"true"`
 	URIAllowListMap   map[string]glob.Glob
-	PasswordMinLength int                      `json:"password_min_length" split_words:"true"`
-	JWT               JWTConfiguration         `json:"jwt"`
-	Mailer            MailerConfiguration      `json:"mailer"`
-	Sms               SmsProviderConfiguration `json:"sms"`
-	DisableSignup     bool                     `json:"disable_signup" split_words:"true"`
-	Webhook           WebhookConfig            `json:"webhook" split_words:"true"`
-	Security          SecurityConfiguration    `json:"security"`
-	MFA               MFAConfiguration         `json:"MFA"`
+	PasswordMinLength int                         `json:"password_min_length" split_words:"true"`
+	PasswordPolicy    PasswordPolicyConfiguration `json:"password_policy" split_words:"true"`
+	JWT               JWTConfiguration            `json:"jwt"`
+	Mailer            MailerConfiguration         `json:"mailer"`
+	Sms               SmsProviderConfiguration    `json:"sms"`
+	DisableSignup     bool                        `json:"disable_signup" split_words:"true"`
+	Webhook           WebhookConfig               `json:"webhook" split_words:"true"`
+	Security          SecurityConfiguration       `json:"security"`
+	MFA               MFAConfiguration            `json:"MFA"`
+	Backoffice        BackofficeConfiguration     `json:"backoffice"`
+	Staff             StaffConfiguration          `json:"staff"`
+	ClaimsHook        ClaimsHookConfiguration     `json:"claims_hook" split_words:"true"`
+	Sessions          SessionsConfiguration       `json:"sessions"`
+	Cleanup           CleanupConfiguration        `json:"cleanup"`
 	Cookie            struct {
 		Key      string `json:"key"`
 		Domain   string `json:"domain"`
@@ -129,6 +148,206 @@ type GlobalConfiguration struct {
 	AutomationOTP   string            `json:"automation_otp" split_words:"true"`
 }
 
+// PasswordPolicyConfiguration holds the rules new passwords have to satisfy.
+type PasswordPolicyConfiguration struct {
+	// MinLength is in characters, it defaults to PasswordMinLength.
+	MinLength int `json:"min_length" split_words:"true"`
+	// MaxLength is in characters, like MinLength. Passwords are also
+	// limited to 72 bytes whatever it is, as bcrypt ignores anything past
+	// 72 bytes.
+	MaxLength        int  `json:"max_length" split_words:"true"`
+	RequireLowercase bool `json:"require_lowercase" split_words:"true" default:"true"`
+	RequireUppercase bool `json:"require_uppercase" split_words:"true" default:"true"`
+	RequireDigits    bool `json:"require_digits" split_words:"true" default:"true"`
+	RequireSymbols   bool `json:"require_symbols" split_words:"true" default:"true"`
+	// MinStrength is a zxcvbn style score from 0 (no check) to 4.
+	MinStrength            int      `json:"min_strength" split_words:"true"`
+	BannedWords            []string `json:"banned_words" split_words:"true"`
+	DisallowEmailLocalPart bool     `json:"disallow_email_local_part" split_words:"true"`
+	// HistorySize is the number of previous passwords that cannot be
+	// reused, 0 disables the check.
+	HistorySize int `json:"history_size" split_words:"true"`
+}
+
+func (p *PasswordPolicyConfiguration) Validate() error {
+	if p.MaxLength > defaultMaxPasswordLength {
+		return fmt.Errorf("password policy max length cannot be more than %d characters", defaultMaxPasswordLength)
+	}
+	if p.MinLength > p.MaxLength {
+		return errors.New("password policy min length is greater than max length")
+	}
+	if p.MinStrength < 0 || p.MinStrength > 4 {
+		return errors.New("password policy min strength must be between 0 and 4")
+	}
+	if p.HistorySize < 0 {
+		return errors.New("password policy history size cannot be negative")
+	}
+	return nil
+}
+
+// BackofficeConfiguration identifies the accounts of backoffice staff, a
+// user matching any of the rules is a backoffice user.
+type BackofficeConfiguration struct {
+	Roles []string `json:"roles"`
+	// AppMetadata matches app_metadata key:value pairs, e.g. "staff:true".
+	AppMetadata map[string]string `json:"app_metadata" split_words:"true"`
+	// EmailDomains matches the domain of confirmed email addresses.
+	EmailDomains []string `json:"email_domains" split_words:"true"`
+}
+
+// IsBackoffice checks if an account with the given role, app_metadata and
+// confirmed email (empty if unconfirmed) is a backoffice account.
+func (c *BackofficeConfiguration) IsBackoffice(role string, appMetaData map[string]interface{}, email string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	for key, value := range c.AppMetadata {
+		if v, ok := appMetaData[key]; ok && v != nil && fmt.Sprint(v) == value {
+			return true
+		}
+	}
+
+	if i := strings.LastIndex(email, "@"); i >= 0 {
+		domain := email[i+1:]
+		for _, d := range c.EmailDomains {
+			if strings.EqualFold(strings.TrimPrefix(strings.TrimSpace(d), "@"), domain) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// StaffConfiguration maps the staff types admins grant to users to the role
+// and issuer of the access tokens issued to them on refresh.
+type StaffConfiguration struct {
+	// Roles maps staff types to JWT roles, e.g. "BOS:service_role".
+	Roles map[string]string `json:"roles" default:"BOS:service_role,AMBO:service_role"`
+	// Issuers maps staff types to JWT issuers, e.g. "BOS:admin-token".
+	Issuers map[string]string `json:"issuers" default:"BOS:admin-token,AMBO:admin-token"`
+}
+
+// IsStaffType checks if the staff type is configured.
+func (c *StaffConfiguration) IsStaffType(staffType string) bool {
+	_, ok := c.Roles[staffType]
+	return ok
+}
+
+// SessionsConfiguration limits the lifetime of sessions, refreshing a
+// session past a limit fails. Zero durations don't limit sessions.
+type SessionsConfiguration struct {
+	// Timebox is the maximum lifetime of sessions since their creation.
+	Timebox time.Duration `json:"timebox"`
+	// InactivityTimeout expires sessions that weren't refreshed for the
+	// duration.
+	InactivityTimeout time.Duration `json:"inactivity_timeout" split_words:"true"`
+	// RoleTimebox and RoleInactivityTimeout override the limits for the
+	// role of the access token, e.g. "service_role:8h".
+	RoleTimebox           map[string]time.Duration `json:"role_timebox" split_words:"true"`
+	RoleInactivityTimeout map[string]time.Duration `json:"role_inactivity_timeout" split_words:"true"`
+}
+
+// Limits returns the session limits for a role.
+func (c *SessionsConfiguration) Limits(role string) (timebox, inactivityTimeout time.Duration) {
+	timebox, inactivityTimeout = c.Timebox, c.InactivityTimeout
+	if d, ok := c.RoleTimebox[role]; ok {
+		timebox = d
+	}
+	if d, ok := c.RoleInactivityTimeout[role]; ok {
+		inactivityTimeout = d
+	}
+	return timebox, inactivityTimeout
+}
+
+// LongestLimits returns the longest session limits over all the roles,
+// zero when the sessions of any role aren't limited.
+func (c *SessionsConfiguration) LongestLimits() (timebox, inactivityTimeout time.Duration) {
+	longest := func(global time.Duration, roles map[string]time.Duration) time.Duration {
+		if global <= 0 {
+			return 0
+		}
+		for _, d := range roles {
+			if d <= 0 {
+				return 0
+			}
+			if d > global {
+				global = d
+			}
+		}
+		return global
+	}
+	return longest(c.Timebox, c.RoleTimebox), longest(c.InactivityTimeout, c.RoleInactivityTimeout)
+}
+
+// CleanupConfiguration holds the cleanup of expired auth artifacts, run in
+// the background by the API server or once with the cleanup command.
+type CleanupConfiguration struct {
+	Enabled  bool          `json:"enabled"`
+	Interval time.Duration `json:"interval" default:"10m"`
+	// BatchSize rows are deleted per transaction, up to MaxBatches per
+	// table and run.
+	BatchSize  int `json:"batch_size" split_words:"true" default:"1000"`
+	MaxBatches int `json:"max_batches" split_words:"true" default:"100"`
+	// Retention keeps the expired rows of a table for the duration, tables
+	// without a retention aren't cleaned.
+	Retention map[string]time.Duration `json:"retention" default:"flow_state:24h,saml_relay_states:24h,mfa_challenges:24h,mfa_factors:24h,refresh_tokens:24h,sessions:24h,webhook_outbox:168h"`
+}
+
+func (c *CleanupConfiguration) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Interval <= 0 {
+		return errors.New("cleanup interval must be positive")
+	}
+	if c.BatchSize <= 0 || c.MaxBatches <= 0 {
+		return errors.New("cleanup batch size and max batches must be positive")
+	}
+	return nil
+}
+
+// ClaimsHookConfiguration holds the hook adding custom claims to access
+// tokens, either an HTTP endpoint or a Postgres function.
+type ClaimsHookConfiguration struct {
+	URL string `json:"url"`
+	// Secret signs the requests to the URL, defaults to the JWT secret.
+	Secret string `json:"secret"`
+	// Function is the name of a Postgres function taking and returning
+	// jsonb, e.g. "public.custom_access_token_claims".
+	Function   string `json:"function"`
+	TimeoutSec int    `json:"timeout_sec" split_words:"true" default:"2"`
+	// FailClosed rejects the grant when the hook fails, instead of issuing
+	// the access token without custom claims.
+	FailClosed bool `json:"fail_closed" split_words:"true"`
+}
+
+var claimsHookFunctionRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*(\.[a-zA-Z_][a-zA-Z0-9_]*)?$`)
+
+// Enabled checks if a claims hook is configured.
+func (c *ClaimsHookConfiguration) Enabled() bool {
+	return c.URL != "" || c.Function != ""
+}
+
+func (c *ClaimsHookConfiguration) Validate() error {
+	if c.URL != "" && c.Function != "" {
+		return errors.New("claims hook can either be a URL or a function, not both")
+	}
+	if c.URL != "" {
+		u, err := url.ParseRequestURI(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("claims hook URL %q is not an absolute HTTP URL", c.URL)
+		}
+	}
+	if c.Function != "" && !claimsHookFunctionRegexp.MatchString(c.Function) {
+		return fmt.Errorf("claims hook function %q is not a valid function name", c.Function)
+	}
+	return nil
+}
+
 // EmailContentConfiguration holds the configuration for emails, both subjects and template URLs.
 type EmailContentConfiguration struct {
 	Invite           string `json:"invite"`
@@ -137,6 +356,9 @@ type EmailContentConfiguration struct {
 	EmailChange      string `json:"email_change" split_words:"true"`
 	MagicLink        string `json:"magic_link" split_words:"true"`
 	Reauthentication string `json:"reauthentication"`
+	AccountLocked    string `json:"account_locked" split_words:"true"`
+	SessionsRevoked  string `json:"sessions_revoked" split_words:"true"`
+	TokenReused      string `json:"token_reused" split_words:"true"`
 }
 
 type ProviderConfiguration struct {
@@ -268,16 +490,172 @@ func (c *CaptchaConfiguration) Validate() error {
 }
 
 type SecurityConfiguration struct {
-	Captcha                               CaptchaConfiguration `json:"captcha"`
-	RefreshTokenRotationEnabled           bool                 `json:"refresh_token_rotation_enabled" split_words:"true" default:"true"`
-	RefreshTokenReuseInterval             int                  `json:"refresh_token_reuse_interval" split_words:"true"`
-	UpdatePasswordRequireReauthentication bool                 `json:"update_password_require_reauthentication" split_words:"true"`
+	Captcha                               CaptchaConfiguration           `json:"captcha"`
+	RefreshTokenRotationEnabled           bool                           `json:"refresh_token_rotation_enabled" split_words:"true" default:"true"`
+	RefreshTokenReuseInterval             int                            `json:"refresh_token_reuse_interval" split_words:"true"`
+	RefreshTokenReuseNotifyUser           bool                           `json:"refresh_token_reuse_notify_user" split_words:"true"`
+	UpdatePasswordRequireReauthentication bool                           `json:"update_password_require_reauthentication" split_words:"true"`
+	BreachedPasswords                     BreachedPasswordsConfiguration `json:"breached_passwords" split_words:"true"`
+	PasswordExpiry                        PasswordExpiryConfiguration    `json:"password_expiry" split_words:"true"`
+	Lockout                               LockoutConfiguration           `json:"lockout"`
+	SingleSession                         SingleSessionConfiguration     `json:"single_session" split_words:"true"`
+	// UserAppMetadataKeys are the app_metadata keys users can set through
+	// PUT /user, all the other keys can only be set by admins.
+	UserAppMetadataKeys []string `json:"user_app_metadata_keys" split_words:"true"`
 }
 
 func (c *SecurityConfiguration) Validate() error {
+	if err := c.BreachedPasswords.Validate(); err != nil {
+		return err
+	}
 	return c.Captcha.Validate()
 }
 
+// BreachedPasswordsConfiguration holds the configuration of the offline
+// check of new passwords against a local copy of the Have I Been Pwned corpus.
+type BreachedPasswordsConfiguration struct {
+	Enabled bool `json:"enabled"`
+	// Path is a directory of range files named after their SHA-1 prefix, or
+	// a single file of HASH:COUNT lines.
+	Path string `json:"path"`
+	// MinCount ignores passwords seen fewer times in breaches.
+	MinCount int `json:"min_count" split_words:"true"`
+	// FlagOnLogin also checks passwords on login, breached passwords are
+	// still let in but flagged in the response and the audit log.
+	FlagOnLogin bool `json:"flag_on_login" split_words:"true"`
+}
+
+// PasswordExpiryConfiguration holds the max age of passwords of staff
+// accounts, identified by role or by a marker in their app_metadata.
+type PasswordExpiryConfiguration struct {
+	// Roles maps roles to the max age of their passwords, e.g. "admin:720h".
+	Roles map[string]time.Duration `json:"roles"`
+	// MaxAge applies to users with AppMetadataKey in their app_metadata,
+	// set to AppMetadataValue when it isn't empty.
+	AppMetadataKey   string        `json:"app_metadata_key" split_words:"true"`
+	AppMetadataValue string        `json:"app_metadata_value" split_words:"true"`
+	MaxAge           time.Duration `json:"max_age" split_words:"true"`
+}
+
+// MaxAgeFor returns the shortest max age applying to a user with the given
+// role and app_metadata, 0 if their password never expires.
+func (c *PasswordExpiryConfiguration) MaxAgeFor(role string, appMetaData map[string]interface{}) time.Duration {
+	var maxAge time.Duration
+	if d, ok := c.Roles[role]; ok && d > 0 {
+		maxAge = d
+	}
+	if c.AppMetadataKey != "" && c.MaxAge > 0 {
+		if v, ok := appMetaData[c.AppMetadataKey]; ok && v != nil && (c.AppMetadataValue == "" || fmt.Sprint(v) == c.AppMetadataValue) {
+			if maxAge == 0 || c.MaxAge < maxAge {
+				maxAge = c.MaxAge
+			}
+		}
+	}
+	return maxAge
+}
+
+// LockoutConfiguration holds the per account lockout after repeated failed
+// password logins, with or without a legacy credential.
+type LockoutConfiguration struct {
+	// MaxAttempts is the number of consecutive failed logins locking the
+	// account, 0 disables lockouts.
+	MaxAttempts int `json:"max_attempts" split_words:"true"`
+	// Duration is the length of the first lockout, doubled on every
+	// following lockout up to MaxDuration, 0 leaves them uncapped.
+	Duration    time.Duration `json:"duration" default:"5m"`
+	MaxDuration time.Duration `json:"max_duration" split_words:"true" default:"24h"`
+	// NotifyUser emails the user when their account gets locked.
+	NotifyUser bool `json:"notify_user" split_words:"true"`
+}
+
+func (c *LockoutConfiguration) Validate() error {
+	if c.MaxAttempts <= 0 {
+		return nil
+	}
+	if c.Duration <= 0 {
+		return errors.New("lockout duration must be positive")
+	}
+	if c.MaxDuration > 0 && c.MaxDuration < c.Duration {
+		return errors.New("lockout max duration must not be shorter than the lockout duration")
+	}
+	return nil
+}
+
+// Policies applied when a user limited to a single session signs in while
+// they have another session.
+const (
+	// SingleSessionRevoke signs the user out of their other sessions.
+	SingleSessionRevoke = "revoke"
+	// SingleSessionReject rejects the new login.
+	SingleSessionReject = "reject"
+)
+
+// SingleSessionConfiguration limits users, selected by role or as backoffice
+// users, to one session at a time.
+type SingleSessionConfiguration struct {
+	Roles      []string `json:"roles"`
+	Backoffice bool     `json:"backoffice"`
+	Policy     string   `json:"policy" default:"revoke"`
+	// NotifyUser emails the user when signing in revoked their other
+	// sessions.
+	NotifyUser bool `json:"notify_user" split_words:"true"`
+}
+
+// Applies checks if the single session policy applies to a user with the
+// given role and backoffice classification.
+func (c *SingleSessionConfiguration) Applies(role string, backoffice bool) bool {
+	if c.Backoffice && backoffice {
+		return true
+	}
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the policy against the session limits: rejecting logins
+// locks users who lost the device of their session out of their account
+// until that session expires, so sessions have to expire.
+func (c *SingleSessionConfiguration) Validate(sessions *SessionsConfiguration) error {
+	switch c.Policy {
+	case SingleSessionRevoke:
+		return nil
+	case SingleSessionReject:
+	default:
+		return fmt.Errorf("single session policy must be %q or %q", SingleSessionRevoke, SingleSessionReject)
+	}
+
+	limited := func(timebox, inactivityTimeout time.Duration) bool {
+		return timebox > 0 || inactivityTimeout > 0
+	}
+	err := fmt.Errorf("single session policy %q requires a sessions timebox or inactivity timeout", SingleSessionReject)
+	// backoffice users can have any role
+	if c.Backoffice && !limited(sessions.LongestLimits()) {
+		return err
+	}
+	for _, role := range c.Roles {
+		if !limited(sessions.Limits(role)) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *BreachedPasswordsConfiguration) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Path == "" {
+		return errors.New("breached passwords check requires a path to the corpus")
+	}
+	if _, err := os.Stat(c.Path); err != nil {
+		return fmt.Errorf("breached passwords corpus cannot be read: %w", err)
+	}
+	return nil
+}
+
 func loadEnvironment(filename string) error {
 	var err error
 	if filename != "" {
@@ -298,6 +676,49 @@ type WebhookConfig struct {
 	TimeoutSec int      `json:"timeout_sec"`
 	Secret     string   `json:"secret"`
 	Events     []string `json:"events"`
+
+	// Blocking delivers the events during the request, so that the
+	// endpoint can reject it or update the user's metadata. Otherwise the
+	// events are written to the outbox and delivered in the background.
+	Blocking bool `json:"blocking"`
+	// MaxAttempts deliveries are attempted, Backoff apart doubling up to
+	// MaxBackoff, before they are moved to the dead state.
+	MaxAttempts int           `json:"max_attempts" split_words:"true" default:"8"`
+	Backoff     time.Duration `json:"backoff" default:"30s"`
+	MaxBackoff  time.Duration `json:"max_backoff" split_words:"true" default:"1h"`
+	// Concurrency limits the deliveries in flight per endpoint.
+	Concurrency  int           `json:"concurrency" default:"4"`
+	PollInterval time.Duration `json:"poll_interval" split_words:"true" default:"5s"`
+	BatchSize    int           `json:"batch_size" split_words:"true" default:"100"`
+	// RotationOverlap is how long the replaced secret of a webhook endpoint
+	// keeps signing the requests, unless the rotation sets its own.
+	RotationOverlap time.Duration `json:"rotation_overlap" split_words:"true" default:"24h"`
+}
+
+func (w *WebhookConfig) Validate() error {
+	if w.MaxAttempts <= 0 || w.Concurrency <= 0 || w.BatchSize <= 0 {
+		return errors.New("webhook max attempts, concurrency and batch size must be positive")
+	}
+	if w.Backoff <= 0 || w.MaxBackoff < w.Backoff || w.PollInterval <= 0 {
+		return errors.New("webhook backoff and poll interval must be positive, and max backoff at least the backoff")
+	}
+	if w.RotationOverlap < 0 {
+		return errors.New("webhook rotation overlap must not be negative")
+	}
+	return nil
+}
+
+// NextAttempt returns the delay before attempting again a delivery that
+// failed attempts times.
+func (w *WebhookConfig) NextAttempt(attempts int) time.Duration {
+	delay := w.Backoff
+	for i := 1; i < attempts && delay < w.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > w.MaxBackoff {
+		delay = w.MaxBackoff
+	}
+	return delay
 }
 
 func (w *WebhookConfig) HasEvent(event string) bool {
@@ -425,6 +846,14 @@ func (config *GlobalConfiguration) ApplyDefaults() error {
 	if config.PasswordMinLength < defaultMinPasswordLength {
 		config.PasswordMinLength = defaultMinPasswordLength
 	}
+	if config.PasswordPolicy.MinLength < config.PasswordMinLength {
+		config.PasswordPolicy.MinLength = config.PasswordMinLength
+	}
+	// keep the legacy setting in sync, it is still reported by some endpoints
+	config.PasswordMinLength = config.PasswordPolicy.MinLength
+	if config.PasswordPolicy.MaxLength == 0 {
+		config.PasswordPolicy.MaxLength = defaultMaxPasswordLength
+	}
 	if config.MFA.ChallengeExpiryDuration < defaultChallengeExpiryDuration {
 		config.MFA.ChallengeExpiryDuration = defaultChallengeExpiryDuration
 	}
@@ -446,11 +875,17 @@ func (c *GlobalConfiguration) Validate() error {
 	}{
 		&c.API,
 		&c.DB,
+		&c.JWT,
 		&c.Tracing,
 		&c.Metrics,
 		&c.SMTP,
 		&c.SAML,
 		&c.Security,
+		&c.Security.Lockout,
+		&c.PasswordPolicy,
+		&c.ClaimsHook,
+		&c.Cleanup,
+		&c.Webhook,
 	}
 
 	for _, validatable := range validatables {
@@ -459,7 +894,7 @@ func (c *GlobalConfiguration) Validate() error {
 		}
 	}
 
-	return nil
+	return c.Security.SingleSession.Validate(&c.Sessions)
 }
 
 func (o *OAuthProviderConfiguration) Validate() error {
@@ -3,6 +3,7 @@ package conf
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -25,3 +26,102 @@ func TestGlobal(t *testing.T) {
 	require.NotNil(t, gc)
 	assert.Equal(t, "X-Request-ID", gc.API.RequestIDHeader)
 }
+
+func TestPasswordExpiryMaxAgeFor(t *testing.T) {
+	c := &PasswordExpiryConfiguration{
+		Roles: map[string]time.Duration{
+			"admin":   24 * time.Hour,
+			"support": 72 * time.Hour,
+		},
+		AppMetadataKey:   "staff",
+		AppMetadataValue: "true",
+		MaxAge:           48 * time.Hour,
+	}
+
+	assert.Equal(t, time.Duration(0), c.MaxAgeFor("authenticated", nil))
+	assert.Equal(t, 24*time.Hour, c.MaxAgeFor("admin", nil))
+	assert.Equal(t, 48*time.Hour, c.MaxAgeFor("authenticated", map[string]interface{}{"staff": true}))
+	assert.Equal(t, time.Duration(0), c.MaxAgeFor("authenticated", map[string]interface{}{"staff": false}))
+	// the shortest max age wins
+	assert.Equal(t, 24*time.Hour, c.MaxAgeFor("admin", map[string]interface{}{"staff": true}))
+	assert.Equal(t, 48*time.Hour, c.MaxAgeFor("support", map[string]interface{}{"staff": "true"}))
+}
+
+func TestBackofficeIsBackoffice(t *testing.T) {
+	c := &BackofficeConfiguration{
+		Roles:        []string{"staff"},
+		AppMetadata:  map[string]string{"type": "BOS"},
+		EmailDomains: []string{"@example.com"},
+	}
+
+	assert.False(t, c.IsBackoffice("authenticated", nil, "shopper@gmail.com"))
+	assert.False(t, c.IsBackoffice("authenticated", map[string]interface{}{"type": "shopper"}, ""))
+	assert.True(t, c.IsBackoffice("staff", nil, ""))
+	assert.True(t, c.IsBackoffice("authenticated", map[string]interface{}{"type": "BOS"}, ""))
+	assert.True(t, c.IsBackoffice("authenticated", nil, "jane@EXAMPLE.com"))
+	assert.False(t, c.IsBackoffice("authenticated", nil, "jane@notexample.com"))
+}
+
+func TestSessionsLongestLimits(t *testing.T) {
+	c := &SessionsConfiguration{
+		Timebox:           24 * time.Hour,
+		InactivityTimeout: time.Hour,
+		RoleTimebox:       map[string]time.Duration{"service_role": 8 * time.Hour, "support": 48 * time.Hour},
+	}
+	timebox, inactivityTimeout := c.LongestLimits()
+	assert.Equal(t, 48*time.Hour, timebox)
+	assert.Equal(t, time.Hour, inactivityTimeout)
+
+	// a role without limit keeps its sessions
+	c.RoleInactivityTimeout = map[string]time.Duration{"support": 0}
+	_, inactivityTimeout = c.LongestLimits()
+	assert.Equal(t, time.Duration(0), inactivityTimeout)
+}
+
+func TestSingleSessionValidate(t *testing.T) {
+	sessions := &SessionsConfiguration{}
+	c := &SingleSessionConfiguration{Roles: []string{"support"}, Backoffice: true, Policy: SingleSessionRevoke}
+	assert.NoError(t, c.Validate(sessions))
+
+	// rejecting logins requires the sessions to expire
+	c.Policy = SingleSessionReject
+	assert.Error(t, c.Validate(sessions))
+
+	sessions.InactivityTimeout = 8 * time.Hour
+	assert.NoError(t, c.Validate(sessions))
+
+	sessions.RoleInactivityTimeout = map[string]time.Duration{"support": 0}
+	assert.Error(t, c.Validate(sessions))
+
+	c.Policy = "ignore"
+	assert.Error(t, c.Validate(&SessionsConfiguration{Timebox: time.Hour}))
+}
+
+func TestLockoutValidate(t *testing.T) {
+	c := &LockoutConfiguration{Duration: 5 * time.Minute}
+	assert.NoError(t, c.Validate())
+
+	c.MaxAttempts = 5
+	assert.NoError(t, c.Validate())
+
+	c.MaxDuration = time.Minute
+	assert.Error(t, c.Validate())
+
+	c.MaxDuration = 0
+	assert.NoError(t, c.Validate())
+
+	c.Duration = 0
+	assert.Error(t, c.Validate())
+}
+
+func TestWebhookNextAttempt(t *testing.T) {
+	c := &WebhookConfig{
+		Backoff:    30 * time.Second,
+		MaxBackoff: 5 * time.Minute,
+	}
+	assert.Equal(t, 30*time.Second, c.NextAttempt(1))
+	assert.Equal(t, time.Minute, c.NextAttempt(2))
+	assert.Equal(t, 4*time.Minute, c.NextAttempt(4))
+	assert.Equal(t, 5*time.Minute, c.NextAttempt(5))
+	assert.Equal(t, 5*time.Minute, c.NextAttempt(50))
+}
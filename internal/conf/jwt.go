@@ -0,0 +1,157 @@
+package conf
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Statuses of JWT keys. Keys are rotated in stages: a new key is added with
+// the verify status so it is published before any token is signed with it,
+// then promoted to active while the previous key is demoted to verify and
+// finally retired once all the tokens it signed have expired.
+const (
+	// JWTKeyActive signs new tokens, only one key can be active.
+	JWTKeyActive = "active"
+	// JWTKeyVerify only verifies tokens, it is the default.
+	JWTKeyVerify = "verify"
+	// JWTKeyRetired is neither used to verify tokens nor published.
+	JWTKeyRetired = "retired"
+)
+
+// JWTKey is a key signing or verifying access tokens.
+type JWTKey struct {
+	// KeyID is sent in the kid header of the tokens signed with the key,
+	// tokens without kid are verified with the keys without one.
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	// Key is the PEM encoded private key, or public key for keys that only
+	// verify tokens. HMAC keys default to the JWT secret.
+	Key    string `json:"key"`
+	Status string `json:"status"`
+
+	SigningKey   interface{} `json:"-"`
+	VerifyingKey interface{} `json:"-"`
+}
+
+// JWTKeys is a set of JWT keys, configured as a JSON array.
+type JWTKeys []JWTKey
+
+// Decode reads the keys from their JSON representation.
+func (k *JWTKeys) Decode(value string) error {
+	return json.Unmarshal([]byte(value), (*[]JWTKey)(k))
+}
+
+// Validate checks the keys and parses them, access tokens are signed with
+// the JWT secret (HS256) when no key is configured.
+func (c *JWTConfiguration) Validate() error {
+	active := 0
+	kids := make(map[string]bool, len(c.Keys))
+	for i := range c.Keys {
+		key := &c.Keys[i]
+		if key.Status == "" {
+			key.Status = JWTKeyVerify
+		}
+		switch key.Status {
+		case JWTKeyActive:
+			active += 1
+		case JWTKeyVerify:
+		case JWTKeyRetired:
+			continue
+		default:
+			return fmt.Errorf("jwt: unknown status %q for key %q", key.Status, key.KeyID)
+		}
+		if kids[key.KeyID] {
+			return fmt.Errorf("jwt: more than one key with kid %q", key.KeyID)
+		}
+		kids[key.KeyID] = true
+		if err := key.parse(c.Secret); err != nil {
+			return fmt.Errorf("jwt: invalid key %q: %w", key.KeyID, err)
+		}
+	}
+	if active > 1 {
+		return errors.New("jwt: only one key can be active")
+	}
+	if len(c.Keys) > 0 && active == 0 {
+		return errors.New("jwt: one key must be active")
+	}
+	return nil
+}
+
+func (k *JWTKey) parse(secret string) error {
+	if jwt.GetSigningMethod(k.Algorithm) == nil || k.Algorithm == "none" {
+		return fmt.Errorf("unsupported algorithm %q", k.Algorithm)
+	}
+
+	if strings.HasPrefix(k.Algorithm, "HS") {
+		key := k.Key
+		if key == "" {
+			key = secret
+		}
+		k.SigningKey = []byte(key)
+		k.VerifyingKey = []byte(key)
+		return nil
+	}
+
+	if k.KeyID == "" {
+		return errors.New("asymmetric keys require a kid")
+	}
+
+	var err error
+	pem := []byte(k.Key)
+	switch {
+	case strings.HasPrefix(k.Algorithm, "RS"), strings.HasPrefix(k.Algorithm, "PS"):
+		if private, perr := jwt.ParseRSAPrivateKeyFromPEM(pem); perr == nil {
+			k.SigningKey, k.VerifyingKey = private, &private.PublicKey
+		} else {
+			k.VerifyingKey, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+		}
+	case strings.HasPrefix(k.Algorithm, "ES"):
+		if private, perr := jwt.ParseECPrivateKeyFromPEM(pem); perr == nil {
+			k.SigningKey, k.VerifyingKey = private, &private.PublicKey
+		} else {
+			k.VerifyingKey, err = jwt.ParseECPublicKeyFromPEM(pem)
+		}
+	case k.Algorithm == "EdDSA":
+		if private, perr := jwt.ParseEdPrivateKeyFromPEM(pem); perr == nil {
+			k.SigningKey = private
+			k.VerifyingKey = private.(crypto.Signer).Public()
+		} else {
+			k.VerifyingKey, err = jwt.ParseEdPublicKeyFromPEM(pem)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if k.Status == JWTKeyActive && k.SigningKey == nil {
+		return errors.New("the active key must be a private key")
+	}
+	return nil
+}
+
+// ActiveKey returns the key signing new tokens, nil when tokens are signed
+// with the JWT secret.
+func (c *JWTConfiguration) ActiveKey() *JWTKey {
+	for i := range c.Keys {
+		if c.Keys[i].Status == JWTKeyActive {
+			return &c.Keys[i]
+		}
+	}
+	return nil
+}
+
+// VerificationKey returns the non retired key with the kid, nil when there
+// is none.
+func (c *JWTConfiguration) VerificationKey(kid string) *JWTKey {
+	for i := range c.Keys {
+		if c.Keys[i].Status != JWTKeyRetired && c.Keys[i].KeyID == kid {
+			return &c.Keys[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package crypto
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1" //#nosec G505 -- The corpus is indexed by SHA-1.
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const breachedPasswordPrefixLength = 5
+
+// BreachedPasswordCorpus looks up passwords in a local copy of the Have I
+// Been Pwned corpus of breached passwords, so no password (or hash prefix)
+// ever leaves the server.
+//
+// The path is either:
+//   - a directory of range files, each named after a 5 character SHA-1
+//     prefix (optionally with a .txt extension) and containing one
+//     SUFFIX:COUNT line per hash, as served by the range API. Range files are
+//     read on every lookup.
+//   - a single file with one HASH:COUNT line per hash, as produced by the
+//     downloader. It is loaded in memory on the first lookup, so it is best
+//     suited to curated subsets of the corpus.
+//
+// Hashes seen fewer than minCount times are ignored.
+type BreachedPasswordCorpus struct {
+	path     string
+	minCount int
+
+	once   sync.Once
+	hashes map[string]struct{}
+	err    error
+}
+
+// NewBreachedPasswordCorpus creates a corpus reading from path, no file is
+// read until the first lookup.
+func NewBreachedPasswordCorpus(path string, minCount int) *BreachedPasswordCorpus {
+	return &BreachedPasswordCorpus{
+		path:     path,
+		minCount: minCount,
+	}
+}
+
+// IsBreached reports whether the password appears in the corpus.
+func (c *BreachedPasswordCorpus) IsBreached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password)) //#nosec G401 -- The corpus is indexed by SHA-1.
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return false, err
+	}
+
+	if info.IsDir() {
+		return c.lookupRange(hash)
+	}
+
+	c.once.Do(func() {
+		c.hashes, c.err = c.load()
+	})
+	if c.err != nil {
+		return false, c.err
+	}
+
+	_, ok := c.hashes[hash]
+	return ok, nil
+}
+
+func (c *BreachedPasswordCorpus) lookupRange(hash string) (bool, error) {
+	prefix, suffix := hash[:breachedPasswordPrefixLength], hash[breachedPasswordPrefixLength:]
+
+	var file *os.File
+	var err error
+	for _, name := range []string{prefix, prefix + ".txt", strings.ToLower(prefix), strings.ToLower(prefix) + ".txt"} {
+		file, err = os.Open(filepath.Join(c.path, name)) //#nosec G304 -- The name is a hex prefix.
+		if err == nil || !errors.Is(err, os.ErrNotExist) {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// no range file means no breached password with this prefix
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	found := false
+	err = c.scan(file, len(suffix), func(s string) bool {
+		found = s == suffix
+		return !found
+	})
+
+	return found, err
+}
+
+func (c *BreachedPasswordCorpus) load() (map[string]struct{}, error) {
+	file, err := os.Open(c.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hashes := make(map[string]struct{})
+	err = c.scan(file, sha1.Size*2, func(hash string) bool {
+		hashes[hash] = struct{}{}
+		return true
+	})
+
+	return hashes, err
+}
+
+// scan calls fn with every hash of the expected length seen at least
+// minCount times, until fn returns false.
+func (c *BreachedPasswordCorpus) scan(r io.Reader, length int, fn func(hash string) bool) error {
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line += 1
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		hash, count, hasCount := strings.Cut(text, ":")
+		if len(hash) != length {
+			return fmt.Errorf("crypto: malformed breached password hash on line %d", line)
+		}
+
+		if hasCount && c.minCount > 1 {
+			n, err := strconv.Atoi(count)
+			if err != nil {
+				return fmt.Errorf("crypto: malformed breached password count on line %d: %w", line, err)
+			}
+			if n < c.minCount {
+				continue
+			}
+		}
+
+		if !fn(strings.ToUpper(hash)) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
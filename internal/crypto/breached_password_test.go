@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// SHA-1 of "password" is 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8 and of
+// "P@ssw0rd" is 21BD12DC183F740EE76F27B78EB39C8AD972A757.
+const (
+	breachedPasswordRange = "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" +
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\r\n" +
+		"1E5E5AFBB2E2B6AEAC8A88F21DAFBA7C3A3:2\r\n"
+	breachedPasswordFile = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9659365\n" +
+		"21BD12DC183F740EE76F27B78EB39C8AD972A757:3\n"
+)
+
+func TestBreachedPasswordCorpusRangeFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "5BAA6.txt"), []byte(breachedPasswordRange), 0600))
+
+	corpus := NewBreachedPasswordCorpus(dir, 0)
+
+	breached, err := corpus.IsBreached(ctx, "password")
+	require.NoError(t, err)
+	require.True(t, breached)
+
+	// no range file for this prefix
+	breached, err = corpus.IsBreached(ctx, "P@ssw0rd")
+	require.NoError(t, err)
+	require.False(t, breached)
+}
+
+func TestBreachedPasswordCorpusFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	require.NoError(t, os.WriteFile(path, []byte(breachedPasswordFile), 0600))
+
+	corpus := NewBreachedPasswordCorpus(path, 0)
+	for _, password := range []string{"password", "P@ssw0rd"} {
+		breached, err := corpus.IsBreached(ctx, password)
+		require.NoError(t, err)
+		require.True(t, breached, password)
+	}
+
+	breached, err := corpus.IsBreached(ctx, "not in the corpus")
+	require.NoError(t, err)
+	require.False(t, breached)
+
+	// rarely breached passwords are ignored
+	corpus = NewBreachedPasswordCorpus(path, 10)
+	breached, err = corpus.IsBreached(ctx, "P@ssw0rd")
+	require.NoError(t, err)
+	require.False(t, breached)
+}
+
+func TestBreachedPasswordCorpusErrors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewBreachedPasswordCorpus(filepath.Join(t.TempDir(), "missing"), 0).IsBreached(ctx, "password")
+	require.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "malformed.txt")
+	require.NoError(t, os.WriteFile(path, []byte("5BAA61E4:1\n"), 0600))
+	_, err = NewBreachedPasswordCorpus(path, 0).IsBreached(ctx, "password")
+	require.Error(t, err)
+}
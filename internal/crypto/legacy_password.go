@@ -2,71 +2,122 @@ package crypto
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/hex"
 	"errors"
-	"strings"
+	"fmt"
+	"sync"
 
-	"golang.org/x/crypto/argon2"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func CompareLegacyHashAndPassword(ctx context.Context, hash, password string) error {
-	if password == "" || hash == "" {
-		return errors.New("password or hash can't empty")
-	}
-	splitedHash := strings.Split(hash, ":")
-	if len(splitedHash) < 3 {
-		return errors.New("failed legacy hash format")
-	}
+// LegacyHashVerifier verifies passwords against hashes imported from a
+// legacy application. Each verifier understands exactly one hash format.
+type LegacyHashVerifier interface {
+	// Algorithm is the name of the format, as stored in the algorithm
+	// column of legacy_credentials.
+	Algorithm() string
+
+	// Recognizes reports whether the hash looks like it was produced by
+	// this format. It is used when no algorithm has been recorded.
+	Recognizes(hash string) bool
+
+	// Check returns an error if the hash is malformed or its cost
+	// parameters are beyond what a login attempt may compute. It is used
+	// to validate hashes before they are imported.
+	Check(hash string) error
 
-	legacyHash := splitedHash[0]
-	salt := splitedHash[1]
+	// Compare returns nil if the password matches the hash, hashes rejected
+	// by Check are never computed.
+	Compare(hash, password string) error
+}
+
+var (
+	// ErrLegacyHashMismatch is returned when a password does not match a
+	// legacy hash.
+	ErrLegacyHashMismatch = errors.New("password is invalid")
+
+	// ErrUnknownLegacyHashAlgorithm is returned when no registered verifier
+	// handles a legacy hash.
+	ErrUnknownLegacyHashAlgorithm = errors.New("unknown legacy hash algorithm")
+)
+
+var (
+	legacyHashVerifiersLock sync.RWMutex
+	legacyHashVerifiers     []LegacyHashVerifier
+)
 
-	// use ARGON2ID13
-	hashedArgon := getArgonHash([]byte(password), salt)
+// RegisterLegacyHashVerifier adds a verifier to the registry. A verifier
+// registered with the name of an existing one replaces it. When detecting
+// the format of a hash, verifiers are tried in registration order.
+func RegisterLegacyHashVerifier(verifier LegacyHashVerifier) {
+	legacyHashVerifiersLock.Lock()
+	defer legacyHashVerifiersLock.Unlock()
 
-	match := compareHashes([]byte(legacyHash), []byte(hashedArgon))
-	if match {
-		return nil
-	} else {
-		return errors.New("password is invalid")
+	for i, v := range legacyHashVerifiers {
+		if v.Algorithm() == verifier.Algorithm() {
+			legacyHashVerifiers[i] = verifier
+			return
+		}
 	}
+
+	legacyHashVerifiers = append(legacyHashVerifiers, verifier)
 }
 
-func getArgonHash(data []byte, salt string) string {
-	if salt == "" {
-		saltBytes := make([]byte, 16)
-		rand.Read(saltBytes)
-		salt = hex.EncodeToString(saltBytes)
-	} else {
-		salt = salt[:16]
-		if len(salt) < 16 {
-			salt = padString(salt, 16)
+// FindLegacyHashVerifier returns the verifier for the algorithm, or if the
+// algorithm is empty the first verifier that recognizes the hash.
+func FindLegacyHashVerifier(algorithm, hash string) (LegacyHashVerifier, error) {
+	legacyHashVerifiersLock.RLock()
+	defer legacyHashVerifiersLock.RUnlock()
+
+	for _, v := range legacyHashVerifiers {
+		if algorithm != "" && v.Algorithm() == algorithm {
+			return v, nil
+		} else if algorithm == "" && v.Recognizes(hash) {
+			return v, nil
 		}
 	}
 
-	hash := argon2.IDKey(data, []byte(salt), 2, 64*1024, 1, 32)
+	if algorithm != "" {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownLegacyHashAlgorithm, algorithm)
+	}
 
-	return hex.EncodeToString(hash)
+	return nil, ErrUnknownLegacyHashAlgorithm
 }
 
-func padString(s string, length int) string {
-	for len(s) < length {
-		s += s
+// CompareLegacyHashAndPassword compares a legacy hash and password, returns
+// nil if equal otherwise an error. The algorithm may be empty, in which case
+// it is detected from the format of the hash.
+func CompareLegacyHashAndPassword(ctx context.Context, algorithm, hash, password string) (err error) {
+	if password == "" || hash == "" {
+		return errors.New("password or hash can't empty")
 	}
-	return s[:length]
-}
 
-func compareHashes(hash1, hash2 []byte) bool {
-	if len(hash1) != len(hash2) {
-		return false
+	verifier, err := FindLegacyHashVerifier(algorithm, hash)
+	if err != nil {
+		return err
 	}
 
-	for i := 0; i < len(hash1); i++ {
-		if hash1[i] != hash2[i] {
-			return false
-		}
+	attributes := []attribute.KeyValue{
+		attribute.String("alg", verifier.Algorithm()),
+		attribute.Bool("legacy", true),
 	}
 
-	return true
+	compareHashAndPasswordSubmittedCounter.Add(ctx, 1, attributes...)
+	defer func() {
+		attributes = append(attributes, attribute.Bool("match", err == nil))
+
+		compareHashAndPasswordCompletedCounter.Add(ctx, 1, attributes...)
+	}()
+
+	return verifier.Compare(hash, password)
+}
+
+func init() {
+	// prefixed formats first, the colon separated format of the original
+	// legacy app matches almost anything so it goes last
+	RegisterLegacyHashVerifier(BcryptLegacyVerifier{})
+	RegisterLegacyHashVerifier(Argon2idPHCLegacyVerifier{})
+	RegisterLegacyHashVerifier(ScryptLegacyVerifier{})
+	RegisterLegacyHashVerifier(PBKDF2SHA256LegacyVerifier{})
+	RegisterLegacyHashVerifier(SaltedSHA1LegacyVerifier{})
+	RegisterLegacyHashVerifier(Argon2idColonLegacyVerifier{})
 }
@@ -0,0 +1,126 @@
+package crypto
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Known vectors, taken from the reference implementations' test suites where
+// one exists:
+//   - argon2id: phc-winner-argon2 test.c (t=2, m=2^16, p=1)
+//   - bcrypt: golang.org/x/crypto/bcrypt tests
+//   - pbkdf2_sha256 and sha1: Django's test_hashers.py
+//   - scrypt: RFC 7914 section 12 (N=1024, r=8, p=16, dkLen=64)
+var legacyHashVectors = []struct {
+	algorithm string
+	hash      string
+	password  string
+}{
+	{
+		algorithm: LegacyArgon2idPHC,
+		hash:      "$argon2id$v=19$m=65536,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc",
+		password:  "password",
+	},
+	{
+		algorithm: LegacyBcrypt,
+		hash:      "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga",
+		password:  "allmine",
+	},
+	{
+		algorithm: LegacyPBKDF2SHA256,
+		hash:      "pbkdf2_sha256$10000$seasalt$CWWFdHOWwPnki7HvkcqN9iA2T3KLW1cf2uZ5kvArtVY=",
+		password:  "lètmein",
+	},
+	{
+		algorithm: LegacyScrypt,
+		hash:      "$scrypt$ln=10,r=8,p=16$TmFDbA$/bq+HJ00cgB4VucZDQHp/nxq18vII3gw53N2Y0s3MWIurzDZLiKjiG/xCSedmDDaxyevuUqD7m2DYMvfoswGQA",
+		password:  "password",
+	},
+	{
+		algorithm: LegacySaltedSHA1,
+		hash:      "sha1$seasalt$cff36ea83f5706ce9aa7454e63e431fc726b2dc8",
+		password:  "lètmein",
+	},
+	{
+		algorithm: LegacyArgon2idColon,
+		hash:      "8e2f1c112a77bc6fe9743ddb85faf35319f70191e12f4bd07c61029a0b027333:0123456789abcdef:1",
+		password:  "legacypassword",
+	},
+}
+
+func TestCompareLegacyHashAndPassword(t *testing.T) {
+	ctx := context.Background()
+
+	for _, v := range legacyHashVectors {
+		t.Run(v.algorithm, func(t *testing.T) {
+			verifier, err := FindLegacyHashVerifier("", v.hash)
+			require.NoError(t, err)
+			require.Equal(t, v.algorithm, verifier.Algorithm())
+
+			// detected from the hash
+			require.NoError(t, CompareLegacyHashAndPassword(ctx, "", v.hash, v.password))
+			// explicitly selected
+			require.NoError(t, CompareLegacyHashAndPassword(ctx, v.algorithm, v.hash, v.password))
+
+			err = CompareLegacyHashAndPassword(ctx, v.algorithm, v.hash, v.password+"x")
+			require.True(t, errors.Is(err, ErrLegacyHashMismatch), "expected mismatch, got %v", err)
+		})
+	}
+}
+
+func TestCompareLegacyHashAndPasswordErrors(t *testing.T) {
+	ctx := context.Background()
+
+	require.Error(t, CompareLegacyHashAndPassword(ctx, "", "", "password"))
+	require.Error(t, CompareLegacyHashAndPassword(ctx, "", "sha1$salt$abc", ""))
+
+	err := CompareLegacyHashAndPassword(ctx, "md5", "sha1$salt$abc", "password")
+	require.True(t, errors.Is(err, ErrUnknownLegacyHashAlgorithm))
+
+	err = CompareLegacyHashAndPassword(ctx, "", "$md5$whatever", "password")
+	require.True(t, errors.Is(err, ErrUnknownLegacyHashAlgorithm))
+
+	// malformed hashes of a known format
+	require.Error(t, CompareLegacyHashAndPassword(ctx, LegacyPBKDF2SHA256, "pbkdf2_sha256$abc$salt$hash", "password"))
+	require.Error(t, CompareLegacyHashAndPassword(ctx, LegacyArgon2idPHC, "$argon2id$v=16$m=16,t=2,p=1$c2FsdA$aGFzaA", "password"))
+	require.Error(t, CompareLegacyHashAndPassword(ctx, LegacyScrypt, "$scrypt$ln=99,r=8,p=1$c2FsdA$aGFzaA", "password"))
+	require.Error(t, CompareLegacyHashAndPassword(ctx, LegacyArgon2idColon, "abc::1", "password"))
+}
+
+func TestArgon2idColonLegacyVerifierShortSalt(t *testing.T) {
+	// salts shorter than 16 bytes are repeated rather than rejected
+	require.Error(t, Argon2idColonLegacyVerifier{}.Compare("00:abc:1", "password"))
+}
+
+func TestLegacyHashCostLimits(t *testing.T) {
+	for _, v := range legacyHashVectors {
+		verifier, err := FindLegacyHashVerifier(v.algorithm, v.hash)
+		require.NoError(t, err)
+		require.NoError(t, verifier.Check(v.hash), v.algorithm)
+	}
+
+	costly := []struct {
+		algorithm string
+		hash      string
+	}{
+		{LegacyArgon2idPHC, "$argon2id$v=19$m=2000000000,t=2,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"},
+		{LegacyArgon2idPHC, "$argon2id$v=19$m=65536,t=100000,p=1$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"},
+		{LegacyArgon2idPHC, "$argon2id$v=19$m=65536,t=2,p=255$c29tZXNhbHQ$CTFhFdXPJO1aFaMaO6Mm5c8y7cJHAph8ArZWb2GRPPc"},
+		{LegacyBcrypt, "$2a$31$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"},
+		{LegacyPBKDF2SHA256, "pbkdf2_sha256$1000000000$seasalt$CWWFdHOWwPnki7HvkcqN9iA2T3KLW1cf2uZ5kvArtVY="},
+		{LegacyScrypt, "$scrypt$ln=20,r=1024,p=1$TmFDbA$/bq+HJ00cgB4VucZDQHp/nxq18vII3gw53N2Y0s3MWIurzDZLiKjiG/xCSedmDDaxyevuUqD7m2DYMvfoswGQA"},
+		{LegacyScrypt, "$scrypt$ln=10,r=8,p=9223372036854775807$TmFDbA$/bq+HJ00cgB4VucZDQHp/nxq18vII3gw53N2Y0s3MWIurzDZLiKjiG/xCSedmDDaxyevuUqD7m2DYMvfoswGQA"},
+	}
+	for _, c := range costly {
+		verifier, err := FindLegacyHashVerifier(c.algorithm, c.hash)
+		require.NoError(t, err)
+		require.Error(t, verifier.Check(c.hash), c.hash)
+		// rejected without being computed
+		err = CompareLegacyHashAndPassword(context.Background(), c.algorithm, c.hash, "password")
+		require.Error(t, err, c.hash)
+		require.False(t, errors.Is(err, ErrLegacyHashMismatch), c.hash)
+	}
+}
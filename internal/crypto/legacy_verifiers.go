@@ -0,0 +1,372 @@
+package crypto
+
+import (
+	"crypto/sha1" //#nosec G505 -- Only used to verify imported legacy hashes.
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Names of the legacy hash formats, as stored in legacy_credentials.algorithm.
+const (
+	LegacyArgon2idColon = "argon2id_colon"
+	LegacyArgon2idPHC   = "argon2id"
+	LegacyBcrypt        = "bcrypt"
+	LegacyPBKDF2SHA256  = "pbkdf2_sha256"
+	LegacyScrypt        = "scrypt"
+	LegacySaltedSHA1    = "sha1"
+)
+
+// Bounds of the cost parameters read from legacy hashes. Anyone can make a
+// login attempt pay for them, so hashes beyond them are rejected rather
+// than computed.
+const (
+	maxLegacyArgon2idMemory   = 256 * 1024 // KiB
+	maxLegacyArgon2idTime     = 16
+	maxLegacyArgon2idThreads  = 16
+	maxLegacyBcryptCost       = 15
+	maxLegacyPBKDF2Iterations = 2000000
+	maxLegacyScryptMemory     = 256 << 20 // bytes, 128 * N * r
+	maxLegacyScryptWork       = 1 << 24   // N * r * p
+	maxLegacyDerivedKeyLength = 128
+)
+
+func errLegacyHashCost(algorithm string) error {
+	return fmt.Errorf("%s hash parameters exceed the supported cost", algorithm)
+}
+
+func compareLegacyDigest(expected, actual []byte) error {
+	if len(expected) == 0 || subtle.ConstantTimeCompare(expected, actual) != 1 {
+		return ErrLegacyHashMismatch
+	}
+	return nil
+}
+
+// decodeLegacyBase64 decodes base64 with or without padding. The "adapted"
+// alphabet used by passlib, which has '.' instead of '+', is accepted too.
+func decodeLegacyBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.ReplaceAll(s, ".", "+"), "=")
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// parseLegacyParams parses PHC style "k=v,k=v" parameters into integers.
+func parseLegacyParams(s string) (map[string]int, error) {
+	params := make(map[string]int)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("malformed hash parameter %q", pair)
+		}
+		v, err := strconv.Atoi(kv[1])
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("malformed hash parameter %q", pair)
+		}
+		params[kv[0]] = v
+	}
+	return params, nil
+}
+
+// Argon2idColonLegacyVerifier verifies hashes of the original legacy app,
+// laid out as "<hex argon2id>:<salt>:...". The salt is used as text,
+// truncated or repeated to 16 bytes, with fixed parameters t=2, m=64MiB,
+// p=1 and a 32 byte key.
+type Argon2idColonLegacyVerifier struct{}
+
+func (Argon2idColonLegacyVerifier) Algorithm() string {
+	return LegacyArgon2idColon
+}
+
+func (Argon2idColonLegacyVerifier) Recognizes(hash string) bool {
+	return !strings.HasPrefix(hash, "$") && len(strings.Split(hash, ":")) >= 3
+}
+
+func (Argon2idColonLegacyVerifier) Check(hash string) error {
+	_, _, err := parseArgon2idColonHash(hash)
+	return err
+}
+
+func (Argon2idColonLegacyVerifier) Compare(hash, password string) error {
+	expected, salt, err := parseArgon2idColonHash(hash)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), []byte(salt), 2, 64*1024, 1, 32)
+
+	return compareLegacyDigest([]byte(strings.ToLower(expected)), []byte(hex.EncodeToString(key)))
+}
+
+// parseArgon2idColonHash returns the hex digest and the salt, truncated or
+// repeated to 16 bytes, of the hash.
+func parseArgon2idColonHash(hash string) (string, string, error) {
+	parts := strings.Split(hash, ":")
+	if len(parts) < 3 || parts[1] == "" {
+		return "", "", errors.New("failed legacy hash format")
+	}
+
+	salt := parts[1]
+	for len(salt) < 16 {
+		salt += salt
+	}
+	return parts[0], salt[:16], nil
+}
+
+// Argon2idPHCLegacyVerifier verifies PHC formatted argon2id hashes, as in
+// "$argon2id$v=19$m=65536,t=2,p=4$<salt>$<hash>".
+type Argon2idPHCLegacyVerifier struct{}
+
+func (Argon2idPHCLegacyVerifier) Algorithm() string {
+	return LegacyArgon2idPHC
+}
+
+func (Argon2idPHCLegacyVerifier) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (Argon2idPHCLegacyVerifier) Check(hash string) error {
+	_, _, _, err := parseArgon2idPHCHash(hash)
+	return err
+}
+
+func (Argon2idPHCLegacyVerifier) Compare(hash, password string) error {
+	params, salt, expected, err := parseArgon2idPHCHash(hash)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, uint32(params["t"]), uint32(params["m"]), uint8(params["p"]), uint32(len(expected)))
+
+	return compareLegacyDigest(expected, key)
+}
+
+// parseArgon2idPHCHash returns the parameters, the salt and the digest of
+// the hash.
+func parseArgon2idPHCHash(hash string) (map[string]int, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, nil, nil, errors.New("failed argon2id hash format")
+	}
+	if parts[2] != fmt.Sprintf("v=%d", argon2.Version) {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+
+	params, err := parseLegacyParams(parts[3])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if params["m"] == 0 || params["t"] == 0 || params["p"] == 0 {
+		return nil, nil, nil, errors.New("failed argon2id hash parameters")
+	}
+	if params["m"] > maxLegacyArgon2idMemory || params["t"] > maxLegacyArgon2idTime || params["p"] > maxLegacyArgon2idThreads {
+		return nil, nil, nil, errLegacyHashCost(LegacyArgon2idPHC)
+	}
+
+	salt, err := decodeLegacyBase64(parts[4])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	expected, err := decodeLegacyBase64(parts[5])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(expected) > maxLegacyDerivedKeyLength {
+		return nil, nil, nil, errLegacyHashCost(LegacyArgon2idPHC)
+	}
+	return params, salt, expected, nil
+}
+
+// BcryptLegacyVerifier verifies modular crypt formatted bcrypt hashes
+// ($2a$, $2b$ and $2y$).
+type BcryptLegacyVerifier struct{}
+
+func (BcryptLegacyVerifier) Algorithm() string {
+	return LegacyBcrypt
+}
+
+func (BcryptLegacyVerifier) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+func (BcryptLegacyVerifier) Check(hash string) error {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return err
+	}
+	if cost > maxLegacyBcryptCost {
+		return errLegacyHashCost(LegacyBcrypt)
+	}
+	return nil
+}
+
+func (v BcryptLegacyVerifier) Compare(hash, password string) error {
+	if err := v.Check(hash); err != nil {
+		return err
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrLegacyHashMismatch
+	}
+	return err
+}
+
+// PBKDF2SHA256LegacyVerifier verifies Django style PBKDF2-SHA256 hashes, as
+// in "pbkdf2_sha256$<iterations>$<salt>$<base64 hash>".
+type PBKDF2SHA256LegacyVerifier struct{}
+
+func (PBKDF2SHA256LegacyVerifier) Algorithm() string {
+	return LegacyPBKDF2SHA256
+}
+
+func (PBKDF2SHA256LegacyVerifier) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "pbkdf2_sha256$")
+}
+
+func (PBKDF2SHA256LegacyVerifier) Check(hash string) error {
+	_, _, _, err := parsePBKDF2SHA256Hash(hash)
+	return err
+}
+
+func (PBKDF2SHA256LegacyVerifier) Compare(hash, password string) error {
+	iterations, salt, expected, err := parsePBKDF2SHA256Hash(hash)
+	if err != nil {
+		return err
+	}
+
+	key := pbkdf2.Key([]byte(password), []byte(salt), iterations, len(expected), sha256.New)
+
+	return compareLegacyDigest(expected, key)
+}
+
+// parsePBKDF2SHA256Hash returns the iterations, the salt and the digest of
+// the hash.
+func parsePBKDF2SHA256Hash(hash string) (int, string, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2_sha256" {
+		return 0, "", nil, errors.New("failed pbkdf2_sha256 hash format")
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return 0, "", nil, errors.New("failed pbkdf2_sha256 iterations")
+	}
+	if iterations > maxLegacyPBKDF2Iterations {
+		return 0, "", nil, errLegacyHashCost(LegacyPBKDF2SHA256)
+	}
+
+	expected, err := decodeLegacyBase64(parts[3])
+	if err != nil {
+		return 0, "", nil, err
+	}
+	// every 32 bytes of the key cost the iterations again
+	if len(expected) > maxLegacyDerivedKeyLength {
+		return 0, "", nil, errLegacyHashCost(LegacyPBKDF2SHA256)
+	}
+	return iterations, parts[2], expected, nil
+}
+
+// ScryptLegacyVerifier verifies PHC formatted scrypt hashes, as in
+// "$scrypt$ln=15,r=8,p=1$<salt>$<hash>" where N is 2^ln.
+type ScryptLegacyVerifier struct{}
+
+func (ScryptLegacyVerifier) Algorithm() string {
+	return LegacyScrypt
+}
+
+func (ScryptLegacyVerifier) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "$scrypt$")
+}
+
+func (ScryptLegacyVerifier) Check(hash string) error {
+	_, _, _, err := parseScryptHash(hash)
+	return err
+}
+
+func (ScryptLegacyVerifier) Compare(hash, password string) error {
+	params, salt, expected, err := parseScryptHash(hash)
+	if err != nil {
+		return err
+	}
+
+	key, err := scrypt.Key([]byte(password), salt, 1<<params["ln"], params["r"], params["p"], len(expected))
+	if err != nil {
+		return err
+	}
+
+	return compareLegacyDigest(expected, key)
+}
+
+// parseScryptHash returns the parameters, the salt and the digest of the
+// hash.
+func parseScryptHash(hash string) (map[string]int, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[1] != "scrypt" {
+		return nil, nil, nil, errors.New("failed scrypt hash format")
+	}
+
+	params, err := parseLegacyParams(parts[2])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if params["ln"] == 0 || params["ln"] > 30 || params["r"] == 0 || params["p"] == 0 {
+		return nil, nil, nil, errors.New("failed scrypt hash parameters")
+	}
+	// divided rather than multiplied, r and p can be anything up to the
+	// largest int
+	n := 1 << params["ln"]
+	if params["r"] > maxLegacyScryptMemory/(128*n) || params["p"] > maxLegacyScryptWork/(n*params["r"]) {
+		return nil, nil, nil, errLegacyHashCost(LegacyScrypt)
+	}
+
+	salt, err := decodeLegacyBase64(parts[3])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	expected, err := decodeLegacyBase64(parts[4])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(expected) > maxLegacyDerivedKeyLength {
+		return nil, nil, nil, errLegacyHashCost(LegacyScrypt)
+	}
+	return params, salt, expected, nil
+}
+
+// SaltedSHA1LegacyVerifier verifies Django style salted SHA-1 hashes, as in
+// "sha1$<salt>$<hex sha1(salt + password)>".
+type SaltedSHA1LegacyVerifier struct{}
+
+func (SaltedSHA1LegacyVerifier) Algorithm() string {
+	return LegacySaltedSHA1
+}
+
+func (SaltedSHA1LegacyVerifier) Recognizes(hash string) bool {
+	return strings.HasPrefix(hash, "sha1$")
+}
+
+func (SaltedSHA1LegacyVerifier) Check(hash string) error {
+	if parts := strings.Split(hash, "$"); len(parts) != 3 || parts[0] != "sha1" {
+		return errors.New("failed sha1 hash format")
+	}
+	return nil
+}
+
+func (v SaltedSHA1LegacyVerifier) Compare(hash, password string) error {
+	if err := v.Check(hash); err != nil {
+		return err
+	}
+	parts := strings.Split(hash, "$")
+
+	sum := sha1.Sum([]byte(parts[1] + password)) //#nosec G401 -- Legacy format.
+
+	return compareLegacyDigest([]byte(strings.ToLower(parts[2])), []byte(hex.EncodeToString(sum[:])))
+}
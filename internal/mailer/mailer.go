@@ -3,6 +3,7 @@ package mailer
 import (
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/netlify/mailme"
@@ -21,6 +22,9 @@ type Mailer interface {
 	MagicLinkMail(user *models.User, otp, referrerURL string) error
 	EmailChangeMail(user *models.User, otpNew, otpCurrent, referrerURL string) error
 	ReauthenticateMail(user *models.User, otp string) error
+	AccountLockedMail(user *models.User, lockedUntil time.Time) error
+	SessionsRevokedMail(user *models.User, devices []string) error
+	TokenReusedMail(user *models.User, ipAddress, userAgent string) error
 	ValidateEmail(email string) error
 	GetEmailActionLink(user *models.User, actionType, referrerURL string) (string, error)
 	Conf() *conf.GlobalConfiguration
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/badoux/checkmail"
 	"github.com/supabase/gotrue/internal/conf"
@@ -82,6 +83,24 @@ const defaultReauthenticateMail = `
 <p><div style="border-width:3px; border-style:solid; border-color:#FF0000; padding: 1em; display: inline-block;"><strong>{{ .Token }}</strong></div></p>
 `
 
+const defaultAccountLockedMail = `
+<p>Kami mendeteksi beberapa kali percobaan masuk yang gagal ke akun Anda. Demi keamanan, akun Anda dikunci sementara hingga {{ .LockedUntil }}.</p>
+<p>Jika percobaan tersebut bukan dari Anda, kami sarankan untuk segera mengganti password Anda setelah akun dapat digunakan kembali.</p>
+<p>Jika Anda memiliki pertanyaan, jangan ragu untuk menghubungi tim dukungan kami di cs-aladinmall@misteraladin.com atau hubungi kami di nomor Whatsapp +62 811 113 8080.</p>
+`
+
+const defaultSessionsRevokedMail = `
+<p>Akun Anda baru saja digunakan untuk masuk dari perangkat lain. Akun ini hanya dapat digunakan pada satu perangkat, sehingga Anda telah dikeluarkan dari perangkat berikut:</p>
+<ul>{{ range .Devices }}<li>{{ . }}</li>{{ end }}</ul>
+<p>Jika Anda tidak merasa masuk dari perangkat lain, segera ganti password Anda dan hubungi tim dukungan kami di cs-aladinmall@misteraladin.com atau hubungi kami di nomor Whatsapp +62 811 113 8080.</p>
+`
+
+const defaultTokenReusedMail = `
+<p>Kami mendeteksi penggunaan ulang sesi login akun Anda dari alamat IP {{ .IPAddress }}, yang dapat berarti sesi Anda telah dicuri. Demi keamanan, sesi tersebut telah kami akhiri.</p>
+<p>Jika ini bukan Anda, kami sarankan untuk segera mengganti password Anda dan keluar dari semua perangkat.</p>
+<p>Jika Anda memiliki pertanyaan, jangan ragu untuk menghubungi tim dukungan kami di cs-aladinmall@misteraladin.com atau hubungi kami di nomor Whatsapp +62 811 113 8080.</p>
+`
+
 const defaultSuccessRegisterMail = `
 <p>Terima kasih telah bergabung dengan AladinMall! Kami senang sekali Anda menjadi pelanggan baru kami.</p>
 <p>Kami ingin memberitahu Anda tentang AladinMall dan apa yang kami tawarkan. AladinMall adalah toko online yang menyediakan produk-produk berkualitas dan terpercaya dengan harga yang terjangkau. Kami selalu berusaha memberikan pengalaman belanja yang mudah, cepat, dan menyenangkan.</p>
@@ -165,6 +184,64 @@ func (m *TemplateMailer) ReauthenticateMail(user *models.User, otp string) error
 	)
 }
 
+// AccountLockedMail notifies a user that their account got locked after
+// too many failed logins
+func (m *TemplateMailer) AccountLockedMail(user *models.User, lockedUntil time.Time) error {
+	data := map[string]interface{}{
+		"SiteURL":     m.Config.SiteURL,
+		"Email":       user.Email,
+		"LockedUntil": lockedUntil.Format(time.RFC1123),
+		"Data":        user.UserMetaData,
+	}
+
+	return m.Mailer.Mail(
+		user.GetEmail(),
+		string(withDefault(m.Config.Mailer.Subjects.AccountLocked, "Akun Anda dikunci sementara")),
+		m.Config.Mailer.Templates.AccountLocked,
+		addLayout(defaultAccountLockedMail, m.Config),
+		data,
+	)
+}
+
+// SessionsRevokedMail notifies a user limited to a single session that
+// signing in signed them out of their other devices
+func (m *TemplateMailer) SessionsRevokedMail(user *models.User, devices []string) error {
+	data := map[string]interface{}{
+		"SiteURL": m.Config.SiteURL,
+		"Email":   user.Email,
+		"Devices": devices,
+		"Data":    user.UserMetaData,
+	}
+
+	return m.Mailer.Mail(
+		user.GetEmail(),
+		string(withDefault(m.Config.Mailer.Subjects.SessionsRevoked, "Anda telah keluar dari perangkat lain")),
+		m.Config.Mailer.Templates.SessionsRevoked,
+		addLayout(defaultSessionsRevokedMail, m.Config),
+		data,
+	)
+}
+
+// TokenReusedMail warns a user that a revoked refresh token of theirs was
+// reused, which usually means it was stolen
+func (m *TemplateMailer) TokenReusedMail(user *models.User, ipAddress, userAgent string) error {
+	data := map[string]interface{}{
+		"SiteURL":   m.Config.SiteURL,
+		"Email":     user.Email,
+		"IPAddress": ipAddress,
+		"UserAgent": userAgent,
+		"Data":      user.UserMetaData,
+	}
+
+	return m.Mailer.Mail(
+		user.GetEmail(),
+		string(withDefault(m.Config.Mailer.Subjects.TokenReused, "Aktivitas mencurigakan pada akun Anda")),
+		m.Config.Mailer.Templates.TokenReused,
+		addLayout(defaultTokenReusedMail, m.Config),
+		data,
+	)
+}
+
 // EmailChangeMail sends an email change confirmation mail to a user
 func (m *TemplateMailer) EmailChangeMail(user *models.User, otpNew, otpCurrent, referrerURL string) error {
 	type Email struct {
@@ -23,6 +23,7 @@ const (
 	UserSignedUpAction              AuditAction = "user_signedup"
 	UserInvitedAction               AuditAction = "user_invited"
 	UserDeletedAction               AuditAction = "user_deleted"
+	UsersImportedAction             AuditAction = "users_imported"
 	UserModifiedAction              AuditAction = "user_modified"
 	UserRecoveryRequestedAction     AuditAction = "user_recovery_requested"
 	UserReauthenticateAction        AuditAction = "user_reauthenticate_requested"
@@ -31,6 +32,7 @@ const (
 	UserUpdatePasswordAction        AuditAction = "user_updated_password"
 	TokenRevokedAction              AuditAction = "token_revoked"
 	TokenRefreshedAction            AuditAction = "token_refreshed"
+	TokenReusedAction               AuditAction = "token_reused"
 	GenerateRecoveryCodesAction     AuditAction = "generate_recovery_codes"
 	EnrollFactorAction              AuditAction = "factor_in_progress"
 	UnenrollFactorAction            AuditAction = "factor_unenrolled"
@@ -40,6 +42,24 @@ const (
 	DeleteRecoveryCodesAction       AuditAction = "recovery_codes_deleted"
 	UpdateFactorAction              AuditAction = "factor_updated"
 	MFACodeLoginAction              AuditAction = "mfa_code_login"
+	LegacyCredentialMigratedAction  AuditAction = "legacy_credential_migrated"
+	BreachedPasswordLoginAction     AuditAction = "breached_password_login"
+	AccountLockedAction             AuditAction = "account_locked"
+	AccountUnlockedAction           AuditAction = "account_unlocked"
+	StaffGrantedAction              AuditAction = "staff_granted"
+	StaffRevokedAction              AuditAction = "staff_revoked"
+	AppMetadataUpdatedAction        AuditAction = "app_metadata_updated"
+	SessionRevokedAction            AuditAction = "session_revoked"
+	OtherSessionsRevokedAction      AuditAction = "other_sessions_revoked"
+	SingleSessionEnforcedAction     AuditAction = "single_session_enforced"
+	WebhookDeliveryReplayedAction   AuditAction = "webhook_delivery_replayed"
+	UserBannedAction                AuditAction = "user_banned"
+	IdentityLinkedAction            AuditAction = "identity_linked"
+	PhoneChangedAction              AuditAction = "phone_changed"
+	WebhookEndpointCreatedAction    AuditAction = "webhook_endpoint_created"
+	WebhookEndpointUpdatedAction    AuditAction = "webhook_endpoint_updated"
+	WebhookEndpointDeletedAction    AuditAction = "webhook_endpoint_deleted"
+	WebhookSecretRotatedAction      AuditAction = "webhook_secret_rotated"
 
 	account       auditLogType = "account"
 	team          auditLogType = "team"
@@ -56,13 +76,33 @@ var ActionLogTypeMap = map[AuditAction]auditLogType{
 	UserSignedUpAction:              team,
 	UserInvitedAction:               team,
 	UserDeletedAction:               team,
+	UsersImportedAction:             team,
 	TokenRevokedAction:              token,
 	TokenRefreshedAction:            token,
+	TokenReusedAction:               token,
 	UserModifiedAction:              user,
 	UserRecoveryRequestedAction:     user,
 	UserConfirmationRequestedAction: user,
 	UserRepeatedSignUpAction:        user,
 	UserUpdatePasswordAction:        user,
+	LegacyCredentialMigratedAction:  user,
+	BreachedPasswordLoginAction:     user,
+	AccountLockedAction:             account,
+	AccountUnlockedAction:           team,
+	StaffGrantedAction:              team,
+	StaffRevokedAction:              team,
+	AppMetadataUpdatedAction:        user,
+	SessionRevokedAction:            account,
+	OtherSessionsRevokedAction:      account,
+	SingleSessionEnforcedAction:     account,
+	WebhookDeliveryReplayedAction:   team,
+	UserBannedAction:                team,
+	IdentityLinkedAction:            account,
+	PhoneChangedAction:              user,
+	WebhookEndpointCreatedAction:    team,
+	WebhookEndpointUpdatedAction:    team,
+	WebhookEndpointDeletedAction:    team,
+	WebhookSecretRotatedAction:      team,
 	GenerateRecoveryCodesAction:     user,
 	EnrollFactorAction:              factor,
 	UnenrollFactorAction:            factor,
@@ -15,6 +15,9 @@ type Challenge struct {
 	VerifiedAt *time.Time `json:"verified_at,omitempty" db:"verified_at"`
 	IPAddress  string     `json:"ip_address" db:"ip_address"`
 	Factor     *Factor    `json:"factor,omitempty" belongs_to:"factor"`
+	// WebAuthnSessionData is the state of the ceremony of a webauthn
+	// factor.
+	WebAuthnSessionData *WebAuthnSessionData `json:"-" db:"web_authn_session_data"`
 }
 
 func (Challenge) TableName() string {
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// cleanupLockKey is the key of the advisory lock taken by the cleanup, so
+// that a single replica deletes expired rows at a time.
+const cleanupLockKey int64 = 0x676f74727565 // "gotrue"
+
+// CleanupTables are the tables the cleanup deletes expired rows from, in
+// the order they are cleaned.
+var CleanupTables = []string{
+	(&pop.Model{Value: FlowState{}}).TableName(),
+	(&pop.Model{Value: SAMLRelayState{}}).TableName(),
+	(&pop.Model{Value: Challenge{}}).TableName(),
+	(&pop.Model{Value: Factor{}}).TableName(),
+	(&pop.Model{Value: RefreshToken{}}).TableName(),
+	(&pop.Model{Value: Session{}}).TableName(),
+	(&pop.Model{Value: WebhookDelivery{}}).TableName(),
+}
+
+// cleanupConditions select the expired rows of the tables, the cutoff being
+// the only argument. Sessions have their own conditions. Revoked refresh
+// tokens of a session are kept as long as the session, so replaying them is
+// still detected as reuse, and deleted with it. Webhook deliveries expire
+// once delivered or dead, pending ones are never deleted.
+var cleanupConditions = map[string]string{
+	(&pop.Model{Value: FlowState{}}).TableName():       "created_at < ?",
+	(&pop.Model{Value: SAMLRelayState{}}).TableName():  "created_at < ?",
+	(&pop.Model{Value: Challenge{}}).TableName():       "created_at < ?",
+	(&pop.Model{Value: Factor{}}).TableName():          "status = '" + FactorStateUnverified.String() + "' and updated_at < ?",
+	(&pop.Model{Value: RefreshToken{}}).TableName():    "revoked = true and session_id is null and updated_at < ?",
+	(&pop.Model{Value: WebhookDelivery{}}).TableName(): "status in ('" + string(WebhookDeliveryDelivered) + "', '" + string(WebhookDeliveryDead) + "') and updated_at < ?",
+}
+
+// TryCleanupLock takes the cleanup lock until the end of the transaction,
+// it returns false when another transaction holds it.
+func TryCleanupLock(tx *storage.Connection) (bool, error) {
+	locked := false
+	if err := tx.Store.Get(&locked, "select pg_try_advisory_xact_lock($1)", cleanupLockKey); err != nil {
+		return false, err
+	}
+	return locked, nil
+}
+
+// DeleteExpiredRows deletes up to limit rows of the table that expired
+// before the cutoff, and returns the number of rows deleted.
+func DeleteExpiredRows(tx *storage.Connection, table string, cutoff time.Time, limit int) (int, error) {
+	condition, ok := cleanupConditions[table]
+	if !ok {
+		return 0, fmt.Errorf("no cleanup for table %q", table)
+	}
+	return tx.RawQuery(
+		"delete from "+table+" where id in (select id from "+table+" where "+condition+" limit ?)",
+		cutoff, limit,
+	).ExecWithCount()
+}
+
+// DeleteExpiredSessions deletes up to limit sessions that expired before
+// the cutoff, either past their not_after time or past the timebox or the
+// inactivity timeout when they aren't zero. Their refresh tokens are
+// deleted with them.
+func DeleteExpiredSessions(tx *storage.Connection, cutoff time.Time, timebox, inactivityTimeout time.Duration, limit int) (int, error) {
+	table := (&pop.Model{Value: Session{}}).TableName()
+	condition := "not_after < ?"
+	args := []interface{}{cutoff}
+	if timebox > 0 {
+		condition += " or created_at < ?"
+		args = append(args, cutoff.Add(-timebox))
+	}
+	if inactivityTimeout > 0 {
+		condition += " or coalesce(refreshed_at, created_at) < ?"
+		args = append(args, cutoff.Add(-inactivityTimeout))
+	}
+	args = append(args, limit)
+	return tx.RawQuery(
+		"delete from "+table+" where id in (select id from "+table+" where "+condition+" limit ?)",
+		args...,
+	).ExecWithCount()
+}
@@ -48,6 +48,10 @@ func TruncateAll(conn *storage.Connection) error {
 			(&pop.Model{Value: SAMLProvider{}}).TableName(),
 			(&pop.Model{Value: SAMLRelayState{}}).TableName(),
 			(&pop.Model{Value: FlowState{}}).TableName(),
+			(&pop.Model{Value: LegacyCredential{}}).TableName(),
+			(&pop.Model{Value: PasswordHistory{}}).TableName(),
+			(&pop.Model{Value: WebhookDelivery{}}).TableName(),
+			(&pop.Model{Value: WebhookEndpoint{}}).TableName(),
 		}
 
 		for _, tableName := range tables {
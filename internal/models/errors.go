@@ -23,6 +23,10 @@ func IsNotFoundError(err error) bool {
 		return true
 	case FlowStateNotFoundError, *FlowStateNotFoundError:
 		return true
+	case WebhookDeliveryNotFoundError, *WebhookDeliveryNotFoundError:
+		return true
+	case WebhookEndpointNotFoundError, *WebhookEndpointNotFoundError:
+		return true
 	}
 	return false
 }
@@ -98,3 +102,19 @@ type FlowStateNotFoundError struct{}
 func (e FlowStateNotFoundError) Error() string {
 	return "Flow State not found"
 }
+
+// WebhookDeliveryNotFoundError represents an error when a webhook delivery
+// can't be found.
+type WebhookDeliveryNotFoundError struct{}
+
+func (e WebhookDeliveryNotFoundError) Error() string {
+	return "Webhook delivery not found"
+}
+
+// WebhookEndpointNotFoundError represents an error when a webhook endpoint
+// can't be found.
+type WebhookEndpointNotFoundError struct{}
+
+func (e WebhookEndpointNotFoundError) Error() string {
+	return "Webhook endpoint not found"
+}
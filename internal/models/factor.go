@@ -29,7 +29,10 @@ func (factorState FactorState) String() string {
 	return ""
 }
 
-const TOTP = "totp"
+const (
+	TOTP     = "totp"
+	WebAuthn = "webauthn"
+)
 
 type AuthenticationMethod int
 
@@ -44,6 +47,8 @@ const (
 	MagicLink
 	EmailSignup
 	EmailChange
+	TokenRefresh
+	WebAuthnSignIn
 )
 
 func (authMethod AuthenticationMethod) String() string {
@@ -68,6 +73,10 @@ func (authMethod AuthenticationMethod) String() string {
 		return "email/signup"
 	case EmailChange:
 		return "email_change"
+	case TokenRefresh:
+		return "token_refresh"
+	case WebAuthnSignIn:
+		return "webauthn"
 	}
 	return ""
 }
@@ -97,6 +106,8 @@ func ParseAuthenticationMethod(authMethod string) (AuthenticationMethod, error)
 		return EmailSignup, nil
 	case "email_change":
 		return EmailChange, nil
+	case "webauthn":
+		return WebAuthnSignIn, nil
 	}
 	return 0, fmt.Errorf("unsupported authentication method %q", authMethod)
 }
@@ -112,6 +123,8 @@ type Factor struct {
 	Secret       string      `json:"-" db:"secret"`
 	FactorType   string      `json:"factor_type" db:"factor_type"`
 	Challenge    []Challenge `json:"-" has_many:"challenges"`
+	// WebAuthnCredential is the credential of a verified webauthn factor.
+	WebAuthnCredential *WebAuthnCredential `json:"-" db:"web_authn_credential"`
 }
 
 func (Factor) TableName() string {
@@ -185,6 +198,13 @@ func (f *Factor) UpdateStatus(tx *storage.Connection, state FactorState) error {
 	return tx.UpdateOnly(f, "status", "updated_at")
 }
 
+// UpdateWebAuthnCredential stores the credential of a webauthn factor, on
+// registration and with the new sign count after each assertion.
+func (f *Factor) UpdateWebAuthnCredential(tx *storage.Connection, credential *WebAuthnCredential) error {
+	f.WebAuthnCredential = credential
+	return tx.UpdateOnly(f, "web_authn_credential", "updated_at")
+}
+
 // UpdateFactorType modifies the factor type
 func (f *Factor) UpdateFactorType(tx *storage.Connection, factorType string) error {
 	f.FactorType = factorType
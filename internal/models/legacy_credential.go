@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gobuffalo/pop/v6"
 	"github.com/gofrs/uuid"
 	"github.com/pkg/errors"
 	"github.com/supabase/gotrue/internal/crypto"
@@ -18,8 +19,10 @@ type LegacyCredential struct {
 	Email             storage.NullString `json:"email" db:"email"`
 	Phone             storage.NullString `json:"phone" db:"phone"`
 	EncryptedPassword string             `json:"-" db:"encrypted_password"`
+	Algorithm         storage.NullString `json:"algorithm" db:"algorithm"`
 	CreatedAt         time.Time          `json:"created_at" db:"created_at"`
 	UpdatedAt         *time.Time         `json:"updated_at" db:"updated_at"`
+	MigratedAt        *time.Time         `json:"migrated_at,omitempty" db:"migrated_at"`
 }
 
 func findLegacyCredential(tx *storage.Connection, query string, args ...interface{}) (*LegacyCredential, error) {
@@ -40,16 +43,62 @@ func (LegacyCredential) TableName() string {
 	return tableName
 }
 
-// FindUserByEmailFromLegacy finds a user with the matching email from legacy credentials datas.
+// FindUserByEmailFromLegacy finds a user with the matching email from legacy
+// credentials datas. Credentials that have already been migrated are ignored.
 func FindUserByEmailFromLegacy(tx *storage.Connection, email string) (*LegacyCredential, error) {
-	return findLegacyCredential(tx, "LOWER(email) = ?", strings.ToLower(email))
+	return findLegacyCredential(tx, "LOWER(email) = ? and migrated_at is null", strings.ToLower(email))
 }
 
-// Authenticate a user from a password
+// FindUserByPhoneFromLegacy finds a user with the matching phone from legacy
+// credentials datas. The phone is expected in the format produced by
+// formatPhoneNumber, stored phones are normalized the same way (leading "+"
+// and whitespace removed) since legacy apps did not enforce E.164. The
+// expression is indexed, it must match legacy_credentials_phone_idx.
+func FindUserByPhoneFromLegacy(tx *storage.Connection, phone string) (*LegacyCredential, error) {
+	return findLegacyCredential(tx, "replace(ltrim(phone, '+'), ' ', '') = ? and migrated_at is null", phone)
+}
+
+// retireLegacyCredentials marks the legacy credentials matching the email or
+// phone of the user as migrated, once the user has a password of their own.
+func retireLegacyCredentials(tx *storage.Connection, user *User) error {
+	tableName := (&pop.Model{Value: LegacyCredential{}}).TableName()
+	now := time.Now()
+	if email := user.GetEmail(); email != "" {
+		if err := tx.RawQuery("update "+tableName+" set migrated_at = ?, updated_at = ? where LOWER(email) = ? and migrated_at is null", now, now, strings.ToLower(email)).Exec(); err != nil {
+			return errors.Wrap(err, "error retiring legacy credentials")
+		}
+	}
+	if phone := user.GetPhone(); phone != "" {
+		if err := tx.RawQuery("update "+tableName+" set migrated_at = ?, updated_at = ? where replace(ltrim(phone, '+'), ' ', '') = ? and migrated_at is null", now, now, phone).Exec(); err != nil {
+			return errors.Wrap(err, "error retiring legacy credentials")
+		}
+	}
+	return nil
+}
+
+// IsMigrated checks if the legacy credential has already been moved into the users table.
+func (u *LegacyCredential) IsMigrated() bool {
+	return u.MigratedAt != nil
+}
+
+// MigrateTo rehashes the password into the user's encrypted_password, which
+// marks the legacy credential as migrated so it is no longer consulted.
+func (u *LegacyCredential) MigrateTo(tx *storage.Connection, user *User, password string) error {
+	if err := user.UpdatePassword(tx, password); err != nil {
+		return errors.Wrap(err, "error migrating legacy password")
+	}
+	now := time.Now()
+	u.MigratedAt = &now
+	u.UpdatedAt = &now
+	return nil
+}
+
+// Authenticate a user from a password, using the verifier for the
+// credential's algorithm or the one matching the hash format.
 func (u *LegacyCredential) Authenticate(password string) bool {
 	if u == nil {
 		return false
 	}
-	err := crypto.CompareLegacyHashAndPassword(context.Background(), u.EncryptedPassword, password)
+	err := crypto.CompareLegacyHashAndPassword(context.Background(), string(u.Algorithm), u.EncryptedPassword, password)
 	return err == nil
 }
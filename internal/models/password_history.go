@@ -0,0 +1,79 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/supabase/gotrue/internal/crypto"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// PasswordHistory is a password hash a user had before changing it
+type PasswordHistory struct {
+	ID                uuid.UUID `json:"id" db:"id"`
+	UserID            uuid.UUID `json:"user_id" db:"user_id"`
+	EncryptedPassword string    `json:"-" db:"encrypted_password"`
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+}
+
+// TableName overrides the table name used by pop
+func (PasswordHistory) TableName() string {
+	tableName := "password_history"
+	return tableName
+}
+
+// RememberPassword adds the user's current password hash to their password
+// history before it is replaced, only the last size hashes are kept.
+func RememberPassword(tx *storage.Connection, user *User, size int) error {
+	if size <= 0 || user.EncryptedPassword == "" {
+		return nil
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return errors.Wrap(err, "error generating unique id")
+	}
+	entry := &PasswordHistory{
+		ID:                id,
+		UserID:            user.ID,
+		EncryptedPassword: user.EncryptedPassword,
+		CreatedAt:         time.Now(),
+	}
+	if err := tx.Create(entry); err != nil {
+		return errors.Wrap(err, "error saving password history")
+	}
+
+	tableName := (&pop.Model{Value: PasswordHistory{}}).TableName()
+	if err := tx.RawQuery("DELETE FROM "+tableName+" WHERE user_id = ? AND id NOT IN (SELECT id FROM "+tableName+" WHERE user_id = ? ORDER BY created_at DESC LIMIT ?)", user.ID, user.ID, size).Exec(); err != nil {
+		return errors.Wrap(err, "error pruning password history")
+	}
+
+	return nil
+}
+
+// IsRecentPassword checks if the password is the user's current password
+// or one of the last size passwords in their history.
+func IsRecentPassword(tx *storage.Connection, user *User, password string, size int) (bool, error) {
+	if size <= 0 {
+		return false, nil
+	}
+	if user.EncryptedPassword != "" && user.Authenticate(password) {
+		return true, nil
+	}
+
+	history := []*PasswordHistory{}
+	if err := tx.Q().Where("user_id = ?", user.ID).Order("created_at desc").Limit(size).All(&history); err != nil {
+		return false, errors.Wrap(err, "error finding password history")
+	}
+
+	for _, h := range history {
+		if err := crypto.CompareHashAndPassword(context.Background(), h.EncryptedPassword, password); err == nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
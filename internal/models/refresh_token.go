@@ -10,6 +10,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/supabase/gotrue/internal/crypto"
 	"github.com/supabase/gotrue/internal/storage"
+	"github.com/supabase/gotrue/internal/utilities"
 )
 
 // RefreshToken is the database model for refresh tokens.
@@ -41,6 +42,24 @@ type GrantParams struct {
 	FactorID *uuid.UUID
 
 	SessionNotAfter *time.Time
+
+	PasswordExpired bool
+
+	// Recovery is set when the grant recovers the account, the single
+	// session policy then revokes the other sessions instead of rejecting it.
+	Recovery bool
+
+	UserAgent   string
+	IP          string
+	DeviceLabel string
+}
+
+// FillGrantParams records the device the request was sent from on the
+// session.
+func (g *GrantParams) FillGrantParams(r *http.Request) {
+	g.UserAgent = r.UserAgent()
+	g.IP = utilities.GetIPAddress(r)
+	g.DeviceLabel = utilities.GetDeviceLabel(r)
 }
 
 // GrantAuthenticatedUser creates a refresh token for the provided user.
@@ -63,7 +82,23 @@ func GrantRefreshTokenSwap(r *http.Request, tx *storage.Connection, user *User,
 		}
 
 		newToken, terr = createRefreshToken(rtx, user, token, &GrantParams{})
-		return terr
+		if terr != nil {
+			return terr
+		}
+
+		if newToken.SessionId != nil {
+			session, terr := FindSessionByID(rtx, *newToken.SessionId)
+			if terr != nil {
+				if IsNotFoundError(terr) {
+					return nil
+				}
+				return terr
+			}
+			if terr = session.UpdateOnRefresh(rtx, r.UserAgent(), utilities.GetIPAddress(r)); terr != nil {
+				return errors.Wrap(terr, "error updating session")
+			}
+		}
+		return nil
 	})
 	return newToken, err
 }
@@ -89,6 +124,23 @@ func RevokeTokenFamily(tx *storage.Connection, token *RefreshToken) error {
 	return nil
 }
 
+// CountTokenFamily returns the number of refresh tokens in the family of
+// the provided token, the tokens of its session or, for tokens without a
+// session, the token and its descendants.
+func CountTokenFamily(tx *storage.Connection, token *RefreshToken) (int, error) {
+	if token.SessionId != nil {
+		return tx.Q().Where("session_id = ?", token.SessionId).Count(&RefreshToken{})
+	}
+	tablename := (&pop.Model{Value: RefreshToken{}}).TableName()
+	return tx.RawQuery(`
+	with recursive token_family as (
+		select id, token from `+tablename+` where token = ?
+		union
+		select r.id, r.token from `+tablename+` r inner join token_family t on t.token = r.parent
+	)
+	select id from token_family`, token.Token).Count(&RefreshToken{})
+}
+
 // GetValidChildToken returns the child token of the token provided if the child is not revoked.
 func GetValidChildToken(tx *storage.Connection, token *RefreshToken) (*RefreshToken, error) {
 	refreshToken := &RefreshToken{}
@@ -142,6 +194,11 @@ func createRefreshToken(tx *storage.Connection, user *User, oldToken *RefreshTok
 			session.NotAfter = params.SessionNotAfter
 		}
 
+		session.PasswordExpired = params.PasswordExpired
+		session.UserAgent = storage.NullString(params.UserAgent)
+		session.IP = storage.NullString(params.IP)
+		session.DeviceLabel = storage.NullString(params.DeviceLabel)
+
 		if err := tx.Create(session); err != nil {
 			return nil, errors.Wrap(err, "error creating new session")
 		}
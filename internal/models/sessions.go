@@ -65,6 +65,14 @@ type Session struct {
 	FactorID  *uuid.UUID `json:"factor_id" db:"factor_id"`
 	AMRClaims []AMRClaim `json:"amr,omitempty" has_many:"amr_claims"`
 	AAL       *string    `json:"aal" db:"aal"`
+	// PasswordExpired restricts the session to changing the password
+	PasswordExpired bool `json:"password_expired" db:"password_expired"`
+
+	// the device the session was created on and last refreshed from
+	UserAgent   storage.NullString `json:"user_agent,omitempty" db:"user_agent"`
+	IP          storage.NullString `json:"ip,omitempty" db:"ip"`
+	DeviceLabel storage.NullString `json:"device_label,omitempty" db:"device_label"`
+	RefreshedAt *time.Time         `json:"refreshed_at,omitempty" db:"refreshed_at"`
 }
 
 func (Session) TableName() string {
@@ -107,6 +115,16 @@ func FindSessionByUserID(tx *storage.Connection, userId uuid.UUID) (*Session, er
 	return session, nil
 }
 
+// FindSessionsByUserID returns the sessions of a user, most recently used
+// first.
+func FindSessionsByUserID(tx *storage.Connection, userId uuid.UUID) ([]*Session, error) {
+	sessions := []*Session{}
+	if err := tx.Q().Where("user_id = ?", userId).Order("coalesce(refreshed_at, created_at) desc").All(&sessions); err != nil {
+		return nil, errors.Wrap(err, "error finding sessions")
+	}
+	return sessions, nil
+}
+
 func FindSessionsByFactorID(tx *storage.Connection, factorID uuid.UUID) ([]*Session, error) {
 	sessions := []*Session{}
 	if err := tx.Q().Where("factor_id = ?", factorID).All(&sessions); err != nil {
@@ -138,11 +156,62 @@ func LogoutAllExceptMe(tx *storage.Connection, sessionId uuid.UUID, userID uuid.
 	return tx.RawQuery("DELETE FROM "+(&pop.Model{Value: Session{}}).TableName()+" WHERE id != ? AND user_id = ?", sessionId, userID).Exec()
 }
 
+// IsExpired checks if the session is past its not_after time, older than
+// the timebox or wasn't refreshed within the inactivity timeout. Zero
+// durations don't limit the session.
+func (s *Session) IsExpired(now time.Time, timebox, inactivityTimeout time.Duration) bool {
+	if s.NotAfter != nil && !s.NotAfter.IsZero() && now.After(*s.NotAfter) {
+		return true
+	}
+	if timebox > 0 && now.After(s.CreatedAt.Add(timebox)) {
+		return true
+	}
+	if inactivityTimeout > 0 {
+		lastActivity := s.CreatedAt
+		if s.RefreshedAt != nil && s.RefreshedAt.After(lastActivity) {
+			lastActivity = *s.RefreshedAt
+		}
+		if now.After(lastActivity.Add(inactivityTimeout)) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateOnRefresh records the time and the device the session was last
+// refreshed from.
+func (s *Session) UpdateOnRefresh(tx *storage.Connection, userAgent, ip string) error {
+	now := time.Now()
+	s.RefreshedAt = &now
+	s.UserAgent = storage.NullString(userAgent)
+	s.IP = storage.NullString(ip)
+	return tx.UpdateOnly(s, "refreshed_at", "user_agent", "ip")
+}
+
 func (s *Session) UpdateAssociatedFactor(tx *storage.Connection, factorID *uuid.UUID) error {
 	s.FactorID = factorID
 	return tx.Update(s)
 }
 
+// MarkRefreshTokenReuseNotified records that the user was told about the
+// reuse of a refresh token of the session, it returns false when they were
+// already told.
+func MarkRefreshTokenReuseNotified(tx *storage.Connection, sessionID uuid.UUID) (bool, error) {
+	tableName := (&pop.Model{Value: Session{}}).TableName()
+	count, err := tx.RawQuery("UPDATE "+tableName+" SET refresh_token_reuse_notified_at = now() WHERE id = ? AND refresh_token_reuse_notified_at IS NULL", sessionID).ExecWithCount()
+	if err != nil {
+		return false, errors.Wrap(err, "error marking refresh token reuse as notified")
+	}
+	return count > 0, nil
+}
+
+// ClearPasswordExpired lifts the restriction of the session once the
+// password has been changed.
+func (s *Session) ClearPasswordExpired(tx *storage.Connection) error {
+	s.PasswordExpired = false
+	return tx.UpdateOnly(s, "password_expired")
+}
+
 func (s *Session) UpdateAssociatedAAL(tx *storage.Connection, aal string) error {
 	s.AAL = &aal
 	return tx.Update(s)
@@ -151,7 +220,7 @@ func (s *Session) UpdateAssociatedAAL(tx *storage.Connection, aal string) error
 func (s *Session) CalculateAALAndAMR(tx *storage.Connection) (aal string, amr []AMREntry, err error) {
 	amr, aal = []AMREntry{}, AAL1.String()
 	for _, claim := range s.AMRClaims {
-		if *claim.AuthenticationMethod == TOTPSignIn.String() {
+		if method := *claim.AuthenticationMethod; method == TOTPSignIn.String() || method == WebAuthnSignIn.String() {
 			aal = AAL2.String()
 		}
 		amr = append(amr, AMREntry{Method: claim.GetAuthenticationMethod(), Timestamp: claim.UpdatedAt.Unix()})
@@ -83,3 +83,29 @@ func (ts *SessionsTestSuite) TestCalculateAALAndAMR() {
 	require.True(ts.T(), found)
 
 }
+
+func TestSessionIsExpired(t *testing.T) {
+	now := time.Now()
+	createdAt := now.Add(-2 * time.Hour)
+	refreshedAt := now.Add(-10 * time.Minute)
+	notAfter := now.Add(-time.Minute)
+
+	for _, c := range []struct {
+		desc              string
+		session           Session
+		timebox           time.Duration
+		inactivityTimeout time.Duration
+		expired           bool
+	}{
+		{"No limits", Session{CreatedAt: createdAt}, 0, 0, false},
+		{"Past not_after", Session{CreatedAt: createdAt, NotAfter: &notAfter}, 0, 0, true},
+		{"Within timebox", Session{CreatedAt: createdAt}, 3 * time.Hour, 0, false},
+		{"Past timebox", Session{CreatedAt: createdAt}, time.Hour, 0, true},
+		{"Never refreshed", Session{CreatedAt: createdAt}, 0, time.Hour, true},
+		{"Recently refreshed", Session{CreatedAt: createdAt, RefreshedAt: &refreshedAt}, 0, time.Hour, false},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			require.Equal(t, c.expired, c.session.IsExpired(now, c.timebox, c.inactivityTimeout))
+		})
+	}
+}
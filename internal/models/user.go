@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base64"
+	"math"
 	"strings"
 	"time"
 
@@ -53,7 +54,8 @@ type User struct {
 	ReauthenticationToken  string     `json:"-" db:"reauthentication_token"`
 	ReauthenticationSentAt *time.Time `json:"reauthentication_sent_at,omitempty" db:"reauthentication_sent_at"`
 
-	LastSignInAt *time.Time `json:"last_sign_in_at,omitempty" db:"last_sign_in_at"`
+	LastSignInAt      *time.Time `json:"last_sign_in_at,omitempty" db:"last_sign_in_at"`
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty" db:"password_changed_at"`
 
 	AppMetaData  JSONMap `json:"app_metadata" db:"raw_app_meta_data"`
 	UserMetaData JSONMap `json:"user_metadata" db:"raw_user_meta_data"`
@@ -66,6 +68,14 @@ type User struct {
 	BannedUntil *time.Time `json:"banned_until,omitempty" db:"banned_until"`
 	DeletedAt   *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
 
+	FailedLoginAttempts int        `json:"failed_login_attempts,omitempty" db:"failed_login_attempts"`
+	LockoutCount        int        `json:"lockout_count,omitempty" db:"lockout_count"`
+	LockedUntil         *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+
+	// StaffType elevates the user's refreshed access tokens, it can only be
+	// set by admins.
+	StaffType storage.NullString `json:"staff_type,omitempty" db:"staff_type"`
+
 	DONTUSEINSTANCEID uuid.UUID `json:"-" db:"instance_id"`
 }
 
@@ -128,6 +138,9 @@ func (u *User) BeforeSave(tx *pop.Connection) error {
 	if u.BannedUntil != nil && u.BannedUntil.IsZero() {
 		u.BannedUntil = nil
 	}
+	if u.LockedUntil != nil && u.LockedUntil.IsZero() {
+		u.LockedUntil = nil
+	}
 	return nil
 }
 
@@ -149,6 +162,12 @@ func (u *User) SetRole(tx *storage.Connection, roleName string) error {
 	return tx.UpdateOnly(u, "role")
 }
 
+// SetStaffType grants the staff type to the user, or revokes it when empty
+func (u *User) SetStaffType(tx *storage.Connection, staffType string) error {
+	u.StaffType = storage.NullString(strings.TrimSpace(staffType))
+	return tx.UpdateOnly(u, "staff_type")
+}
+
 // HasRole returns true when the users role is set to roleName
 func (u *User) HasRole(roleName string) bool {
 	return u.Role == roleName
@@ -242,14 +261,34 @@ func (u *User) SetPhone(tx *storage.Connection, phone string) error {
 	return tx.UpdateOnly(u, "phone")
 }
 
-// UpdatePassword updates the user's password
+// UpdatePassword updates the user's password, and retires the legacy
+// credentials of the user so that their old password no longer signs in.
 func (u *User) UpdatePassword(tx *storage.Connection, password string) error {
 	pw, err := crypto.GenerateFromPassword(context.Background(), password)
 	if err != nil {
 		return err
 	}
+	now := time.Now()
 	u.EncryptedPassword = pw
-	return tx.UpdateOnly(u, "encrypted_password")
+	u.PasswordChangedAt = &now
+	if err := tx.UpdateOnly(u, "encrypted_password", "password_changed_at"); err != nil {
+		return err
+	}
+	return retireLegacyCredentials(tx, u)
+}
+
+// IsPasswordExpired checks if the password is older than maxAge. Passwords
+// of users created without a change time are as old as the user, passwords
+// set before the change time was recorded count from its backfill.
+func (u *User) IsPasswordExpired(maxAge time.Duration) bool {
+	if maxAge <= 0 {
+		return false
+	}
+	changedAt := u.CreatedAt
+	if u.PasswordChangedAt != nil {
+		changedAt = *u.PasswordChangedAt
+	}
+	return time.Since(changedAt) > maxAge
 }
 
 // UpdatePhone updates the user's phone
@@ -612,6 +651,62 @@ func (u *User) UpdateBannedUntil(tx *storage.Connection) error {
 	return tx.UpdateOnly(u, "banned_until")
 }
 
+// IsLocked checks if the user is locked out after too many failed logins
+func (u *User) IsLocked() bool {
+	if u.LockedUntil == nil {
+		return false
+	}
+	return time.Now().Before(*u.LockedUntil)
+}
+
+// RecordFailedLogin counts a failed login of the user and locks the account
+// once maxAttempts consecutive logins failed. The lock lasts lockDuration,
+// doubled for every previous lockout since the last successful login, up to
+// maxLockDuration. It returns true when the account got locked.
+func (u *User) RecordFailedLogin(tx *storage.Connection, maxAttempts int, lockDuration, maxLockDuration time.Duration) (bool, error) {
+	// concurrent logins must not miss each other's attempts
+	current := &User{}
+	if err := tx.RawQuery("SELECT * FROM "+u.TableName()+" WHERE id = ? FOR UPDATE", u.ID).First(current); err != nil {
+		return false, errors.Wrap(err, "error locking user")
+	}
+
+	u.FailedLoginAttempts = current.FailedLoginAttempts + 1
+	u.LockoutCount = current.LockoutCount
+	u.LockedUntil = current.LockedUntil
+
+	locked := false
+	if maxAttempts > 0 && u.FailedLoginAttempts >= maxAttempts {
+		limit := maxLockDuration
+		if limit <= 0 {
+			// uncapped lockouts must still not overflow
+			limit = time.Duration(math.MaxInt64 / 2)
+		}
+		duration := lockDuration
+		for i := 0; i < u.LockoutCount && duration < limit; i++ {
+			duration *= 2
+		}
+		if maxLockDuration > 0 && duration > maxLockDuration {
+			duration = maxLockDuration
+		}
+		lockedUntil := time.Now().Add(duration)
+		u.LockedUntil = &lockedUntil
+		u.LockoutCount++
+		u.FailedLoginAttempts = 0
+		locked = true
+	}
+
+	return locked, tx.UpdateOnly(u, "failed_login_attempts", "lockout_count", "locked_until")
+}
+
+// Unlock clears the failed logins and lockouts of the user, on a successful
+// login or by an admin.
+func (u *User) Unlock(tx *storage.Connection) error {
+	u.FailedLoginAttempts = 0
+	u.LockoutCount = 0
+	u.LockedUntil = nil
+	return tx.UpdateOnly(u, "failed_login_attempts", "lockout_count", "locked_until")
+}
+
 // RemoveUnconfirmedIdentities removes potentially malicious unconfirmed identities from a user (if any)
 func (u *User) RemoveUnconfirmedIdentities(tx *storage.Connection) error {
 	if u.IsConfirmed() {
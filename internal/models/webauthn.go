@@ -0,0 +1,101 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// WebAuthnCredential is the credential of a webauthn factor, registered
+// when the factor is verified.
+type WebAuthnCredential struct {
+	ID              []byte   `json:"id"`
+	PublicKey       []byte   `json:"public_key"`
+	AttestationType string   `json:"attestation_type"`
+	Transports      []string `json:"transports,omitempty"`
+	AAGUID          []byte   `json:"aaguid"`
+	// SignCount is the last signature counter of the authenticator, it
+	// increases with every assertion unless the authenticator doesn't
+	// count them.
+	SignCount uint32 `json:"sign_count"`
+}
+
+func NewWebAuthnCredential(credential *webauthn.Credential) *WebAuthnCredential {
+	transports := make([]string, 0, len(credential.Transport))
+	for _, transport := range credential.Transport {
+		transports = append(transports, string(transport))
+	}
+	return &WebAuthnCredential{
+		ID:              credential.ID,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+	}
+}
+
+// Credential returns the credential for the webauthn ceremonies.
+func (c *WebAuthnCredential) Credential() webauthn.Credential {
+	transports := make([]protocol.AuthenticatorTransport, 0, len(c.Transports))
+	for _, transport := range c.Transports {
+		transports = append(transports, protocol.AuthenticatorTransport(transport))
+	}
+	return webauthn.Credential{
+		ID:              c.ID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transport:       transports,
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    c.AAGUID,
+			SignCount: c.SignCount,
+		},
+	}
+}
+
+func (c WebAuthnCredential) Value() (driver.Value, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return driver.Value(""), err
+	}
+	return driver.Value(string(data)), nil
+}
+
+func (c *WebAuthnCredential) Scan(src interface{}) error {
+	return scanJSON(src, c, "WebAuthnCredential")
+}
+
+// WebAuthnSessionData is the state of the webauthn ceremony of a
+// challenge, checked against the response of the authenticator.
+type WebAuthnSessionData struct {
+	*webauthn.SessionData
+}
+
+func (s WebAuthnSessionData) Value() (driver.Value, error) {
+	data, err := json.Marshal(s.SessionData)
+	if err != nil {
+		return driver.Value(""), err
+	}
+	return driver.Value(string(data)), nil
+}
+
+func (s *WebAuthnSessionData) Scan(src interface{}) error {
+	s.SessionData = &webauthn.SessionData{}
+	return scanJSON(src, s.SessionData, "WebAuthnSessionData")
+}
+
+func scanJSON(src interface{}, v interface{}, name string) error {
+	var source []byte
+	switch value := src.(type) {
+	case string:
+		source = []byte(value)
+	case []byte:
+		source = value
+	default:
+		return errors.New("invalid data type for " + name)
+	}
+	return json.Unmarshal(source, v)
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// WebhookEvents are the events sent to a webhook endpoint, stored as a JSON
+// array.
+type WebhookEvents []string
+
+func (e WebhookEvents) Value() (driver.Value, error) {
+	if e == nil {
+		e = WebhookEvents{}
+	}
+	data, err := json.Marshal([]string(e))
+	if err != nil {
+		return driver.Value(""), err
+	}
+	return driver.Value(string(data)), nil
+}
+
+func (e *WebhookEvents) Scan(src interface{}) error {
+	var source []byte
+	switch v := src.(type) {
+	case string:
+		source = []byte(v)
+	case []byte:
+		source = v
+	case nil:
+		source = []byte("[]")
+	default:
+		return errors.New("invalid data type for WebhookEvents")
+	}
+	return json.Unmarshal(source, (*[]string)(e))
+}
+
+// WebhookSigningMode is how the requests to a webhook endpoint are signed.
+type WebhookSigningMode string
+
+const (
+	// WebhookSigningJWT signs the requests with a JWT carrying the SHA-256
+	// of the payload, in the x-webhook-signature header.
+	WebhookSigningJWT WebhookSigningMode = "jwt"
+	// WebhookSigningStandard signs the requests with the HMAC-SHA256
+	// headers of the Standard Webhooks specification.
+	WebhookSigningStandard WebhookSigningMode = "standard"
+)
+
+// WebhookEndpoint is a webhook receiver managed through the admin API, in
+// addition to the webhook of the configuration.
+type WebhookEndpoint struct {
+	ID     uuid.UUID `json:"id" db:"id"`
+	URL    string    `json:"url" db:"url"`
+	Secret string    `json:"-" db:"secret"`
+	// PreviousSecret also signs the requests until it expires, so that
+	// receivers can switch to a rotated secret without rejecting requests.
+	PreviousSecret          storage.NullString `json:"-" db:"previous_secret"`
+	PreviousSecretExpiresAt *time.Time         `json:"previous_secret_expires_at,omitempty" db:"previous_secret_expires_at"`
+	// Events are the events sent to the endpoint, all of them when empty.
+	Events      WebhookEvents      `json:"events" db:"events"`
+	TimeoutSec  int                `json:"timeout_sec" db:"timeout_sec"`
+	Enabled     bool               `json:"enabled" db:"enabled"`
+	SigningMode WebhookSigningMode `json:"signing_mode" db:"signing_mode"`
+	CreatedAt   time.Time          `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" db:"updated_at"`
+}
+
+// TableName overrides the table name used by pop
+func (WebhookEndpoint) TableName() string {
+	tableName := "webhook_endpoints"
+	return tableName
+}
+
+// NewWebhookEndpoint creates an enabled endpoint receiving the events, all
+// of them when empty.
+func NewWebhookEndpoint(url, secret string, events []string, timeoutSec int) (*WebhookEndpoint, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating unique id")
+	}
+	return &WebhookEndpoint{
+		ID:          id,
+		URL:         url,
+		Secret:      secret,
+		Events:      WebhookEvents(events),
+		TimeoutSec:  timeoutSec,
+		Enabled:     true,
+		SigningMode: WebhookSigningJWT,
+	}, nil
+}
+
+// HasEvent checks if the event is sent to the endpoint.
+func (e *WebhookEndpoint) HasEvent(event string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, name := range e.Events {
+		if name == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Secrets returns the secrets signing the requests at the time, the current
+// secret first.
+func (e *WebhookEndpoint) Secrets(now time.Time) []string {
+	secrets := []string{e.Secret}
+	if e.PreviousSecret != "" && e.PreviousSecretExpiresAt != nil && now.Before(*e.PreviousSecretExpiresAt) {
+		secrets = append(secrets, string(e.PreviousSecret))
+	}
+	return secrets
+}
+
+// RotateSecret replaces the secret of the endpoint, the replaced secret
+// keeps signing the requests during the overlap.
+func (e *WebhookEndpoint) RotateSecret(tx *storage.Connection, secret string, overlap time.Duration) error {
+	expiresAt := time.Now().Add(overlap)
+	e.PreviousSecret = storage.NullString(e.Secret)
+	e.PreviousSecretExpiresAt = &expiresAt
+	e.Secret = secret
+	return tx.UpdateOnly(e, "secret", "previous_secret", "previous_secret_expires_at", "updated_at")
+}
+
+// FindWebhookEndpointByID finds a webhook endpoint.
+func FindWebhookEndpointByID(tx *storage.Connection, id uuid.UUID) (*WebhookEndpoint, error) {
+	endpoint := &WebhookEndpoint{}
+	if err := tx.Find(endpoint, id); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, WebhookEndpointNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding webhook endpoint")
+	}
+	return endpoint, nil
+}
+
+// FindWebhookEndpoints lists the webhook endpoints, oldest first.
+func FindWebhookEndpoints(tx *storage.Connection) ([]*WebhookEndpoint, error) {
+	endpoints := []*WebhookEndpoint{}
+	if err := tx.Q().Order("created_at asc").All(&endpoints); err != nil {
+		return nil, errors.Wrap(err, "error finding webhook endpoints")
+	}
+	return endpoints, nil
+}
+
+// FindEnabledWebhookEndpoints lists the webhook endpoints receiving events.
+func FindEnabledWebhookEndpoints(tx *storage.Connection) ([]*WebhookEndpoint, error) {
+	endpoints := []*WebhookEndpoint{}
+	if err := tx.Q().Where("enabled = ?", true).Order("created_at asc").All(&endpoints); err != nil {
+		return nil, errors.Wrap(err, "error finding webhook endpoints")
+	}
+	return endpoints, nil
+}
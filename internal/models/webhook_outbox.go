@@ -0,0 +1,178 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/gobuffalo/pop/v6"
+	"github.com/gofrs/uuid"
+	"github.com/pkg/errors"
+	"github.com/supabase/gotrue/internal/storage"
+)
+
+// WebhookDeliveryStatus is the state of a webhook delivery in the outbox.
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookDeliveryPending deliveries are waiting for their next attempt.
+	WebhookDeliveryPending WebhookDeliveryStatus = "pending"
+	// WebhookDeliveryDelivered deliveries were accepted by the endpoint.
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	// WebhookDeliveryDead deliveries failed every attempt, they are only
+	// attempted again when replayed.
+	WebhookDeliveryDead WebhookDeliveryStatus = "dead"
+)
+
+const (
+	// WebhookKindWebhook deliveries go to the configured webhook and are
+	// signed with its secret.
+	WebhookKindWebhook = "webhook"
+	// WebhookKindFunctionHook deliveries go to the function hooks of the
+	// request and are signed with the JWT secret.
+	WebhookKindFunctionHook = "function_hook"
+	// WebhookKindEndpoint deliveries go to a webhook endpoint and are
+	// signed with its secrets.
+	WebhookKindEndpoint = "endpoint"
+)
+
+// WebhookDelivery is an event waiting in the outbox to be delivered to a
+// webhook endpoint. It is written in the transaction of the change it
+// reports, so that events are neither lost nor sent for rolled back
+// changes.
+type WebhookDelivery struct {
+	ID    uuid.UUID `json:"id" db:"id"`
+	Event string    `json:"event" db:"event"`
+	// Kind tells the dispatcher which secret signs the requests.
+	Kind string `json:"kind" db:"kind"`
+	// EndpointID is the endpoint of the deliveries of the endpoint kind.
+	EndpointID    *uuid.UUID            `json:"endpoint_id,omitempty" db:"endpoint_id"`
+	URL           string                `json:"url" db:"url"`
+	Payload       JSONMap               `json:"payload" db:"payload"`
+	Status        WebhookDeliveryStatus `json:"status" db:"status"`
+	Attempts      int                   `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time             `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     storage.NullString    `json:"last_error,omitempty" db:"last_error"`
+	DeliveredAt   *time.Time            `json:"delivered_at,omitempty" db:"delivered_at"`
+	CreatedAt     time.Time             `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time             `json:"updated_at" db:"updated_at"`
+}
+
+// TableName overrides the table name used by pop
+func (WebhookDelivery) TableName() string {
+	tableName := "webhook_outbox"
+	return tableName
+}
+
+// NewWebhookDelivery creates a pending delivery of the event payload to the
+// URL, due immediately.
+func NewWebhookDelivery(event, kind, url string, payload map[string]interface{}) (*WebhookDelivery, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating unique id")
+	}
+	now := time.Now()
+	return &WebhookDelivery{
+		ID:            id,
+		Event:         event,
+		Kind:          kind,
+		URL:           url,
+		Payload:       JSONMap(payload),
+		Status:        WebhookDeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}, nil
+}
+
+// CreateForEndpoint writes the delivery unless its endpoint was deleted,
+// the endpoints receiving the events are read from a cache that may be
+// behind.
+func (d *WebhookDelivery) CreateForEndpoint(tx *storage.Connection) error {
+	tableName := (&pop.Model{Value: WebhookDelivery{}}).TableName()
+	endpointsTableName := (&pop.Model{Value: WebhookEndpoint{}}).TableName()
+	return tx.RawQuery(
+		"insert into "+tableName+" (id, event, kind, endpoint_id, url, payload, status, attempts, next_attempt_at, created_at, updated_at) select ?::uuid, ?::text, ?::text, e.id, ?::text, ?::jsonb, ?::text, ?::integer, ?::timestamptz, ?::timestamptz, ?::timestamptz from "+endpointsTableName+" e where e.id = ?",
+		d.ID, d.Event, d.Kind, d.URL, d.Payload, d.Status, d.Attempts, d.NextAttemptAt, d.CreatedAt, d.UpdatedAt, d.EndpointID,
+	).Exec()
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries that are due,
+// and postpones their next attempt until the lease expires so that other
+// dispatchers skip them while they are being delivered. Deliveries to
+// disabled endpoints are left pending until the endpoint is enabled again.
+func ClaimWebhookDeliveries(tx *storage.Connection, now time.Time, lease time.Duration, limit int) ([]*WebhookDelivery, error) {
+	tableName := (&pop.Model{Value: WebhookDelivery{}}).TableName()
+	endpointsTableName := (&pop.Model{Value: WebhookEndpoint{}}).TableName()
+	deliveries := []*WebhookDelivery{}
+	if err := tx.RawQuery(
+		"update "+tableName+" set next_attempt_at = ?, updated_at = ? where id in (select id from "+tableName+" o where status = ? and next_attempt_at <= ? and not exists (select 1 from "+endpointsTableName+" e where e.id = o.endpoint_id and e.enabled = false) order by next_attempt_at limit ? for update skip locked) returning *",
+		now.Add(lease), now, WebhookDeliveryPending, now, limit,
+	).All(&deliveries); err != nil {
+		return nil, errors.Wrap(err, "error claiming webhook deliveries")
+	}
+	return deliveries, nil
+}
+
+// FindWebhookDeliveryByID finds a delivery of the outbox.
+func FindWebhookDeliveryByID(tx *storage.Connection, id uuid.UUID) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{}
+	if err := tx.Find(delivery, id); err != nil {
+		if errors.Cause(err) == sql.ErrNoRows {
+			return nil, WebhookDeliveryNotFoundError{}
+		}
+		return nil, errors.Wrap(err, "error finding webhook delivery")
+	}
+	return delivery, nil
+}
+
+// FindWebhookDeliveries lists the deliveries of the outbox with the status,
+// or all of them when the status is empty, most recent first.
+func FindWebhookDeliveries(tx *storage.Connection, status WebhookDeliveryStatus, pageParams *Pagination) ([]*WebhookDelivery, error) {
+	q := tx.Q().Order("created_at desc")
+	if status != "" {
+		q = q.Where("status = ?", status)
+	}
+
+	deliveries := []*WebhookDelivery{}
+	var err error
+	if pageParams != nil {
+		err = q.Paginate(int(pageParams.Page), int(pageParams.PerPage)).All(&deliveries)
+		pageParams.Count = uint64(q.Paginator.TotalEntriesSize)
+	} else {
+		err = q.All(&deliveries)
+	}
+
+	return deliveries, err
+}
+
+// MarkDelivered records the successful attempt of the delivery.
+func (d *WebhookDelivery) MarkDelivered(tx *storage.Connection) error {
+	now := time.Now()
+	d.Status = WebhookDeliveryDelivered
+	d.Attempts++
+	d.LastError = storage.NullString("")
+	d.DeliveredAt = &now
+	return tx.UpdateOnly(d, "status", "attempts", "last_error", "delivered_at", "updated_at")
+}
+
+// MarkFailed records a failed attempt of the delivery, which is attempted
+// again at nextAttemptAt, or moved to the dead state when it is nil.
+func (d *WebhookDelivery) MarkFailed(tx *storage.Connection, reason string, nextAttemptAt *time.Time) error {
+	d.Attempts++
+	d.LastError = storage.NullString(reason)
+	if nextAttemptAt == nil {
+		d.Status = WebhookDeliveryDead
+	} else {
+		d.NextAttemptAt = *nextAttemptAt
+	}
+	return tx.UpdateOnly(d, "status", "attempts", "last_error", "next_attempt_at", "updated_at")
+}
+
+// Replay moves a dead delivery back to the pending state, with a fresh set
+// of attempts due immediately.
+func (d *WebhookDelivery) Replay(tx *storage.Connection) error {
+	d.Status = WebhookDeliveryPending
+	d.Attempts = 0
+	d.NextAttemptAt = time.Now()
+	return tx.UpdateOnly(d, "status", "attempts", "next_attempt_at", "updated_at")
+}
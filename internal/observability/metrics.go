@@ -11,6 +11,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/supabase/gotrue/internal/conf"
 
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
@@ -30,6 +31,21 @@ func Meter(instrumentationName string, opts ...metric.MeterOption) metric.Meter
 	return metricglobal.Meter(instrumentationName, opts...)
 }
 
+type MetricCounter interface {
+	Add(ctx context.Context, incr int64, attrs ...attribute.KeyValue)
+}
+
+// ObtainMetricCounter returns a counter of the gotrue meter, for the
+// packages counting their own events.
+func ObtainMetricCounter(name, desc string) MetricCounter {
+	counter, err := Meter("gotrue").SyncInt64().Counter(name, metricinstrument.WithDescription(desc))
+	if err != nil {
+		panic(err)
+	}
+
+	return counter
+}
+
 func enablePrometheusMetrics(ctx context.Context, mc *conf.MetricsConfig) error {
 	controller := basicmetriccontroller.New(
 		basicmetricprocessor.NewFactory(
@@ -0,0 +1,77 @@
+package utilities
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DeviceLabelHeader lets clients name the device a session is created on.
+const DeviceLabelHeader = "X-Device-Label"
+
+// maxDeviceLabelLength bounds the labels sent by clients, in characters.
+const maxDeviceLabelLength = 100
+
+// the first match wins, so more specific names come first
+var userAgentBrowsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"Firefox/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"Chrome/", "Chrome"},
+	{"Safari/", "Safari"},
+	{"okhttp/", "Android app"},
+	{"CFNetwork/", "iOS app"},
+	{"Dart/", "Mobile app"},
+}
+
+var userAgentSystems = []struct{ token, name string }{
+	{"iPhone", "iPhone"},
+	{"iPad", "iPad"},
+	{"Android", "Android"},
+	{"Windows", "Windows"},
+	{"Macintosh", "macOS"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+// GetDeviceLabel returns the label of the device the request was sent from,
+// either set by the client in the X-Device-Label header or derived from
+// the user agent.
+func GetDeviceLabel(r *http.Request) string {
+	// headers can carry any bytes, but the label is stored as text
+	if label := strings.TrimSpace(strings.ToValidUTF8(r.Header.Get(DeviceLabelHeader), "")); label != "" {
+		if runes := []rune(label); len(runes) > maxDeviceLabelLength {
+			label = strings.TrimSpace(string(runes[:maxDeviceLabelLength]))
+		}
+		return label
+	}
+	return DeviceLabel(r.UserAgent())
+}
+
+// DeviceLabel returns a human readable label such as "Chrome on Windows"
+// for a user agent, or an empty string when it isn't recognized.
+func DeviceLabel(userAgent string) string {
+	browser, system := "", ""
+	for _, b := range userAgentBrowsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	for _, s := range userAgentSystems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	default:
+		return system
+	}
+}
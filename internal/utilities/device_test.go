@@ -0,0 +1,44 @@
+package utilities
+
+import (
+	"net/http"
+	"strings"
+	tst "testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceLabel(t *tst.T) {
+	examples := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Safari/537.36":                         "Chrome on Windows",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Safari/537.36 Edg/115.0.1901.188":      "Edge on Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1": "Safari on iPhone",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:109.0) Gecko/20100101 Firefox/116.0":                                                    "Firefox on macOS",
+		"okhttp/4.9.2": "Android app",
+		"curl/8.1.2":   "",
+		"":             "",
+	}
+
+	for userAgent, expected := range examples {
+		require.Equal(t, expected, DeviceLabel(userAgent), userAgent)
+	}
+}
+
+func TestGetDeviceLabel(t *tst.T) {
+	req := &http.Request{Header: make(http.Header)}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Linux; Android 13) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/115.0.0.0 Mobile Safari/537.36")
+	require.Equal(t, "Chrome on Android", GetDeviceLabel(req))
+
+	req.Header.Set(DeviceLabelHeader, " Budi's Pixel ")
+	require.Equal(t, "Budi's Pixel", GetDeviceLabel(req))
+
+	// long labels are truncated by characters, invalid UTF-8 is dropped
+	req.Header.Set(DeviceLabelHeader, strings.Repeat("ponsel 📱", 20))
+	label := GetDeviceLabel(req)
+	require.True(t, utf8.ValidString(label))
+	require.Equal(t, maxDeviceLabelLength, utf8.RuneCountInString(label))
+
+	req.Header.Set(DeviceLabelHeader, "Pixel \xff\xfe7")
+	require.Equal(t, "Pixel 7", GetDeviceLabel(req))
+}
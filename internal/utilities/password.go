@@ -1,34 +1,252 @@
 package utilities
 
 import (
-	"regexp"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sethvargo/go-password/password"
+	"github.com/supabase/gotrue/internal/conf"
 )
 
-func ValidatePassword(password string) string {
-	uppercaseRegex := regexp.MustCompile(`[A-Z]`)
-	lowercaseRegex := regexp.MustCompile(`[a-z]`)
-	numberRegex := regexp.MustCompile(`[0-9]`)
-	specialCharRegex := regexp.MustCompile(`[^\w\s]`)
+// MaxPasswordBytes is the length past which bcrypt ignores the rest of a
+// password.
+const MaxPasswordBytes = 72
+
+// PasswordViolation is a machine readable reason why a password does not
+// satisfy the password policy, meant to be localised by clients.
+type PasswordViolation string
 
-	if !uppercaseRegex.MatchString(password) {
-		return "password must contain at least one uppercase letter"
+const (
+	PasswordTooShort           PasswordViolation = "password_too_short"
+	PasswordTooLong            PasswordViolation = "password_too_long"
+	PasswordMissingLowercase   PasswordViolation = "password_missing_lowercase"
+	PasswordMissingUppercase   PasswordViolation = "password_missing_uppercase"
+	PasswordMissingDigit       PasswordViolation = "password_missing_digit"
+	PasswordMissingSymbol      PasswordViolation = "password_missing_symbol"
+	PasswordTooWeak            PasswordViolation = "password_too_weak"
+	PasswordContainsBannedWord PasswordViolation = "password_contains_banned_word"
+	PasswordContainsEmail      PasswordViolation = "password_contains_email"
+	PasswordBreached           PasswordViolation = "password_breached"
+	PasswordReused             PasswordViolation = "password_reused"
+)
+
+// Message returns an English description of the violation.
+func (v PasswordViolation) Message(policy *conf.PasswordPolicyConfiguration) string {
+	switch v {
+	case PasswordTooShort:
+		return fmt.Sprintf("Password should be at least %d characters", policy.MinLength)
+	case PasswordTooLong:
+		return fmt.Sprintf("Password should be at most %d characters and %d bytes", policy.MaxLength, MaxPasswordBytes)
+	case PasswordMissingLowercase:
+		return "Password must contain at least one lowercase letter"
+	case PasswordMissingUppercase:
+		return "Password must contain at least one uppercase letter"
+	case PasswordMissingDigit:
+		return "Password must contain at least one numeric digit"
+	case PasswordMissingSymbol:
+		return "Password must contain at least one special character"
+	case PasswordTooWeak:
+		return "Password is too easy to guess"
+	case PasswordContainsBannedWord:
+		return "Password contains a word that is not allowed"
+	case PasswordContainsEmail:
+		return "Password must not contain your email address"
+	case PasswordBreached:
+		return "Password has appeared in a data breach, please choose a different one"
+	case PasswordReused:
+		return "Password has been used recently, please choose a different one"
 	}
+	return "Password does not satisfy the password policy"
+}
 
-	if !lowercaseRegex.MatchString(password) {
-		return "password must contain at least one lowercase letter"
+// ValidatePassword checks the password against every rule of the policy and
+// returns all the rules it violates. The email is optional, it is used to
+// reject passwords containing the email's local part.
+func ValidatePassword(policy *conf.PasswordPolicyConfiguration, password, email string) []PasswordViolation {
+	var violations []PasswordViolation
+
+	if utf8.RuneCountInString(password) < policy.MinLength {
+		violations = append(violations, PasswordTooShort)
+	}
+	// bcrypt ignores anything past 72 bytes, so longer passwords are
+	// rejected whatever the max length in characters
+	if (policy.MaxLength > 0 && utf8.RuneCountInString(password) > policy.MaxLength) || len(password) > MaxPasswordBytes {
+		violations = append(violations, PasswordTooLong)
 	}
 
-	if !numberRegex.MatchString(password) {
-		return "password must contain at least one numeric digit"
+	var hasLower, hasUpper, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case !unicode.IsSpace(r) && !unicode.IsLetter(r):
+			hasSymbol = true
+		}
+	}
+	if policy.RequireLowercase && !hasLower {
+		violations = append(violations, PasswordMissingLowercase)
+	}
+	if policy.RequireUppercase && !hasUpper {
+		violations = append(violations, PasswordMissingUppercase)
+	}
+	if policy.RequireDigits && !hasDigit {
+		violations = append(violations, PasswordMissingDigit)
+	}
+	if policy.RequireSymbols && !hasSymbol {
+		violations = append(violations, PasswordMissingSymbol)
+	}
+
+	lower := strings.ToLower(password)
+	for _, word := range policy.BannedWords {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" && strings.Contains(lower, word) {
+			violations = append(violations, PasswordContainsBannedWord)
+			break
+		}
 	}
 
-	if !specialCharRegex.MatchString(password) {
-		return "password must contain at least one special character"
+	localPart := emailLocalPart(email)
+	if policy.DisallowEmailLocalPart && len(localPart) >= 3 && strings.Contains(lower, localPart) {
+		violations = append(violations, PasswordContainsEmail)
 	}
 
-	if len(password) > 30 {
-		return "password must be 30 characters or less"
+	if policy.MinStrength > 0 {
+		userInputs := append([]string{localPart}, policy.BannedWords...)
+		if PasswordStrength(password, userInputs...) < policy.MinStrength {
+			violations = append(violations, PasswordTooWeak)
+		}
 	}
 
+	return violations
+}
+
+func emailLocalPart(email string) string {
+	if i := strings.LastIndex(email, "@"); i > 0 {
+		return strings.ToLower(email[:i])
+	}
 	return ""
 }
+
+// commonPasswords are guessed first by any attacker, so they only count for
+// a few bits of entropy. Longer entries come first so they are matched
+// before their prefixes.
+var commonPasswords = []string{
+	"qwertyuiop", "1234567890", "trustno1", "superman", "sunshine",
+	"starwars", "princess", "password", "passw0rd", "football",
+	"baseball", "iloveyou", "welcome", "letmein", "monkey", "dragon",
+	"master", "shadow", "qwerty", "azerty", "asdfgh", "zxcvbn", "123456",
+	"111111", "abc123", "admin", "login",
+}
+
+// PasswordStrength estimates how hard the password is to guess, on the same
+// 0 (too guessable) to 4 (very unguessable) scale as zxcvbn. It is a much
+// simpler estimate: common passwords and the given user inputs count as a
+// single guess from a small dictionary, repeated or sequential characters
+// count for one bit and every other character for the size of the character
+// classes used in the password.
+func PasswordStrength(password string, userInputs ...string) int {
+	if password == "" {
+		return 0
+	}
+
+	charset := 0
+	var hasLower, hasUpper, hasDigit, hasSymbol, hasOther bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			hasLower = true
+		case r >= 'A' && r <= 'Z':
+			hasUpper = true
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case r < utf8.RuneSelf:
+			hasSymbol = true
+		default:
+			hasOther = true
+		}
+	}
+	for _, c := range []struct {
+		present bool
+		size    int
+	}{{hasLower, 26}, {hasUpper, 26}, {hasDigit, 10}, {hasSymbol, 33}, {hasOther, 100}} {
+		if c.present {
+			charset += c.size
+		}
+	}
+	charBits := math.Log2(float64(charset))
+
+	// replace dictionary words with a placeholder worth a few bits
+	const placeholder = '\x00'
+	const dictionaryBits = 5.0
+	lower := strings.ToLower(password)
+	dictionary := commonPasswords
+	for _, input := range userInputs {
+		if input = strings.ToLower(strings.TrimSpace(input)); len(input) >= 3 {
+			dictionary = append(dictionary, input)
+		}
+	}
+	for _, word := range dictionary {
+		lower = strings.ReplaceAll(lower, word, string(placeholder))
+	}
+
+	bits := 0.0
+	var prev rune = -1
+	for _, r := range lower {
+		switch {
+		case r == placeholder:
+			bits += dictionaryBits
+		case r == prev || r == prev+1 || r == prev-1:
+			bits += 1
+		default:
+			bits += charBits
+		}
+		prev = r
+	}
+
+	// same thresholds as zxcvbn, on log10 of the number of guesses
+	guesses := bits * math.Log10(2)
+	switch {
+	case guesses < 3:
+		return 0
+	case guesses < 6:
+		return 1
+	case guesses < 8:
+		return 2
+	case guesses < 10:
+		return 3
+	}
+	return 4
+}
+
+// GeneratePassword generates a random password that satisfies the policy,
+// for users that are signed up without choosing a password.
+func GeneratePassword(policy *conf.PasswordPolicyConfiguration) (string, error) {
+	length := 30
+	if policy.MinLength > length {
+		length = policy.MinLength
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		length = policy.MaxLength
+	}
+
+	digits, symbols := length/3, 1
+	for i := 0; i < 10; i++ {
+		p, err := password.Generate(length, digits, symbols, false, true)
+		if err != nil {
+			return "", err
+		}
+		if len(ValidatePassword(policy, p, "")) == 0 {
+			return p, nil
+		}
+	}
+
+	return "", errors.New("unable to generate a password satisfying the password policy")
+}
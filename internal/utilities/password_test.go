@@ -0,0 +1,150 @@
+package utilities
+
+import (
+	"strings"
+	tst "testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/supabase/gotrue/internal/conf"
+)
+
+func defaultPasswordPolicy() *conf.PasswordPolicyConfiguration {
+	return &conf.PasswordPolicyConfiguration{
+		MinLength:        8,
+		MaxLength:        72,
+		RequireLowercase: true,
+		RequireUppercase: true,
+		RequireDigits:    true,
+		RequireSymbols:   true,
+	}
+}
+
+func TestValidatePassword(t *tst.T) {
+	cases := []struct {
+		desc       string
+		policy     func(p *conf.PasswordPolicyConfiguration)
+		password   string
+		email      string
+		violations []PasswordViolation
+	}{
+		{
+			desc:     "valid password",
+			password: "C0rrect-horse",
+		},
+		{
+			desc:       "too short",
+			password:   "Ab1!",
+			violations: []PasswordViolation{PasswordTooShort},
+		},
+		{
+			desc:       "min length counts characters not bytes",
+			password:   "Ééééé1!",
+			violations: []PasswordViolation{PasswordTooShort},
+		},
+		{
+			desc:       "too long",
+			password:   "Aa1!" + string(make([]byte, 70)),
+			violations: []PasswordViolation{PasswordTooLong},
+		},
+		{
+			desc:     "max length counts characters not bytes",
+			policy:   func(p *conf.PasswordPolicyConfiguration) { p.MaxLength = 20 },
+			password: "Aa1!" + strings.Repeat("é", 16),
+		},
+		{
+			desc:       "bcrypt limit of 72 bytes whatever the max length",
+			password:   "Aa1!" + strings.Repeat("é", 68),
+			violations: []PasswordViolation{PasswordTooLong},
+		},
+		{
+			desc:     "missing every character class",
+			password: "        ",
+			violations: []PasswordViolation{
+				PasswordMissingLowercase,
+				PasswordMissingUppercase,
+				PasswordMissingDigit,
+				PasswordMissingSymbol,
+			},
+		},
+		{
+			desc: "character classes not required",
+			policy: func(p *conf.PasswordPolicyConfiguration) {
+				p.RequireUppercase = false
+				p.RequireSymbols = false
+			},
+			password: "correct1horse",
+		},
+		{
+			desc: "banned word",
+			policy: func(p *conf.PasswordPolicyConfiguration) {
+				p.BannedWords = []string{"acme"}
+			},
+			password:   "Welcome2ACME!",
+			violations: []PasswordViolation{PasswordContainsBannedWord},
+		},
+		{
+			desc: "email local part",
+			policy: func(p *conf.PasswordPolicyConfiguration) {
+				p.DisallowEmailLocalPart = true
+			},
+			password:   "Johnny.Doe-99",
+			email:      "johnny.doe@example.com",
+			violations: []PasswordViolation{PasswordContainsEmail},
+		},
+		{
+			desc: "email local part allowed",
+			policy: func(p *conf.PasswordPolicyConfiguration) {
+				p.DisallowEmailLocalPart = false
+			},
+			password: "Johnny.Doe-99",
+			email:    "johnny.doe@example.com",
+		},
+		{
+			desc: "too weak",
+			policy: func(p *conf.PasswordPolicyConfiguration) {
+				p.MinStrength = 3
+			},
+			password:   "Password1!",
+			violations: []PasswordViolation{PasswordTooWeak},
+		},
+		{
+			desc: "strong enough",
+			policy: func(p *conf.PasswordPolicyConfiguration) {
+				p.MinStrength = 3
+			},
+			password: "k8#Vq2!mZr4w",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.desc, func(t *tst.T) {
+			policy := defaultPasswordPolicy()
+			if c.policy != nil {
+				c.policy(policy)
+			}
+			require.Equal(t, c.violations, ValidatePassword(policy, c.password, c.email))
+		})
+	}
+}
+
+func TestPasswordStrength(t *tst.T) {
+	require.Equal(t, 0, PasswordStrength(""))
+	require.Equal(t, 0, PasswordStrength("password"))
+	require.LessOrEqual(t, PasswordStrength("aaaaaaaaaaaa"), 1)
+	require.LessOrEqual(t, PasswordStrength("abcdefghijkl"), 1)
+	require.Equal(t, 4, PasswordStrength("k8#Vq2!mZr4w"))
+
+	// user inputs are as guessable as common passwords
+	require.Greater(t, PasswordStrength("johnnydoe"), PasswordStrength("johnnydoe", "johnnydoe"))
+}
+
+func TestGeneratePassword(t *tst.T) {
+	policy := defaultPasswordPolicy()
+	policy.MinLength = 40
+	policy.MinStrength = 4
+
+	p, err := GeneratePassword(policy)
+	require.NoError(t, err)
+	require.Len(t, p, 40)
+	require.Empty(t, ValidatePassword(policy, p, ""))
+}
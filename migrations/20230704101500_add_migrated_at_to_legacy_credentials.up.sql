@@ -0,0 +1,4 @@
+alter table {{ index .Options "Namespace" }}.legacy_credentials
+add column if not exists migrated_at timestamptz null default null;
+
+comment on column {{ index .Options "Namespace" }}.legacy_credentials.migrated_at is 'Auth: Set once the legacy password has been rehashed into auth.users on a successful login.';
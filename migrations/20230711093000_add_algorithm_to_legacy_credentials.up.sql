@@ -0,0 +1,4 @@
+alter table {{ index .Options "Namespace" }}.legacy_credentials
+add column if not exists algorithm text null default null;
+
+comment on column {{ index .Options "Namespace" }}.legacy_credentials.algorithm is 'Auth: Hash format of encrypted_password. Detected from the hash when null.';
@@ -0,0 +1,12 @@
+-- auth.password_history definition
+create table if not exists {{ index .Options "Namespace" }}.password_history(
+       id uuid not null,
+       user_id uuid not null,
+       encrypted_password varchar(255) not null,
+       created_at timestamptz not null,
+       constraint password_history_pkey primary key(id),
+       constraint password_history_user_id_fkey foreign key (user_id) references {{ index .Options "Namespace" }}.users(id) on delete cascade
+);
+comment on table {{ index .Options "Namespace" }}.password_history is 'auth: stores previous password hashes to prevent their reuse';
+
+create index if not exists password_history_user_id_created_at_idx on {{ index .Options "Namespace" }}.password_history (user_id, created_at desc);
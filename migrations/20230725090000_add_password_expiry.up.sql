@@ -0,0 +1,3 @@
+-- adds password_changed_at to users and password_expired to sessions for password expiry
+alter table {{ index .Options "Namespace" }}.users add column if not exists password_changed_at timestamptz null;
+alter table {{ index .Options "Namespace" }}.sessions add column if not exists password_expired boolean not null default false;
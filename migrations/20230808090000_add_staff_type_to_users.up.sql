@@ -0,0 +1,6 @@
+-- adds staff_type to users, replacing the elevation of users by the type in their user_metadata
+alter table {{ index .Options "Namespace" }}.users add column if not exists staff_type text null;
+
+update {{ index .Options "Namespace" }}.users
+  set staff_type = raw_user_meta_data->>'type'
+  where staff_type is null and raw_user_meta_data->>'type' in ('BOS', 'AMBO');
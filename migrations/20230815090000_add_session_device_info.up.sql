@@ -0,0 +1,5 @@
+-- adds the device a session was created from, shown to users listing their sessions
+alter table {{ index .Options "Namespace" }}.sessions add column if not exists user_agent text null;
+alter table {{ index .Options "Namespace" }}.sessions add column if not exists ip text null;
+alter table {{ index .Options "Namespace" }}.sessions add column if not exists refreshed_at timestamptz null;
+alter table {{ index .Options "Namespace" }}.sessions add column if not exists device_label text null;
@@ -0,0 +1,19 @@
+-- auth.webhook_outbox definition
+create table if not exists {{ index .Options "Namespace" }}.webhook_outbox(
+       id uuid not null,
+       event text not null,
+       kind text not null,
+       url text not null,
+       payload jsonb not null,
+       status text not null default 'pending',
+       attempts integer not null default 0,
+       next_attempt_at timestamptz not null,
+       last_error text null,
+       delivered_at timestamptz null,
+       created_at timestamptz not null,
+       updated_at timestamptz not null,
+       constraint webhook_outbox_pkey primary key(id)
+);
+comment on table {{ index .Options "Namespace" }}.webhook_outbox is 'auth: stores webhook events written with the changes they report, until they are delivered';
+
+create index if not exists webhook_outbox_status_next_attempt_at_idx on {{ index .Options "Namespace" }}.webhook_outbox (status, next_attempt_at);
@@ -0,0 +1,28 @@
+-- auth.webhook_endpoints definition
+create table if not exists {{ index .Options "Namespace" }}.webhook_endpoints(
+       id uuid not null,
+       url text not null,
+       secret text not null,
+       previous_secret text null,
+       previous_secret_expires_at timestamptz null,
+       events jsonb not null default '[]',
+       timeout_sec integer not null default 0,
+       enabled boolean not null default true,
+       created_at timestamptz not null,
+       updated_at timestamptz not null,
+       constraint webhook_endpoints_pkey primary key(id)
+);
+comment on table {{ index .Options "Namespace" }}.webhook_endpoints is 'auth: stores the webhook endpoints managed through the admin API';
+
+alter table {{ index .Options "Namespace" }}.webhook_outbox add column if not exists endpoint_id uuid null;
+do $$
+begin
+  if not exists(select *
+    from information_schema.constraint_column_usage
+    where table_schema = '{{ index .Options "Namespace" }}' and table_name='webhook_endpoints' and constraint_name='webhook_outbox_endpoint_id_fkey')
+  then
+    alter table {{ index .Options "Namespace" }}.webhook_outbox add constraint webhook_outbox_endpoint_id_fkey foreign key (endpoint_id) references {{ index .Options "Namespace" }}.webhook_endpoints(id) on delete cascade;
+  end if;
+end $$;
+
+create index if not exists webhook_outbox_endpoint_id_idx on {{ index .Options "Namespace" }}.webhook_outbox (endpoint_id);
@@ -0,0 +1,2 @@
+-- adds how the requests to a webhook endpoint are signed, jwt or the standard webhooks headers
+alter table {{ index .Options "Namespace" }}.webhook_endpoints add column if not exists signing_mode text not null default 'jwt';
@@ -0,0 +1,3 @@
+-- adds the credential of webauthn factors, with its public key and sign count, and the session data of their ceremonies
+alter table {{ index .Options "Namespace" }}.mfa_factors add column if not exists web_authn_credential jsonb null;
+alter table {{ index .Options "Namespace" }}.mfa_challenges add column if not exists web_authn_session_data jsonb null;
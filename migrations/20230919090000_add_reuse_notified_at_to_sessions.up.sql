@@ -0,0 +1,2 @@
+-- adds when the user was told about the reuse of a refresh token of the session, so they are told once per token family
+alter table {{ index .Options "Namespace" }}.sessions add column if not exists refresh_token_reuse_notified_at timestamptz null;
@@ -0,0 +1,3 @@
+-- adds indexes matching the lookups of legacy credentials on password logins, phones are compared without their leading "+" and spaces
+create index if not exists legacy_credentials_phone_idx on {{ index .Options "Namespace" }}.legacy_credentials (replace(ltrim(phone, '+'), ' ', '')) where migrated_at is null;
+create index if not exists legacy_credentials_email_idx on {{ index .Options "Namespace" }}.legacy_credentials (lower(email)) where migrated_at is null;
@@ -0,0 +1,2 @@
+-- backfills password_changed_at to the time of the deploy, so that enabling a max password age doesn't expire every existing password at once
+update {{ index .Options "Namespace" }}.users set password_changed_at = now() where password_changed_at is null;
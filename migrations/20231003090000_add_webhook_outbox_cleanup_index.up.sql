@@ -0,0 +1,2 @@
+-- adds an index matching the cleanup of delivered and dead webhook deliveries
+create index if not exists webhook_outbox_status_updated_at_idx on {{ index .Options "Namespace" }}.webhook_outbox (status, updated_at);